@@ -0,0 +1,88 @@
+package mflags
+
+import (
+	"os"
+	"time"
+)
+
+// CommandLine is the default set of command-line flags, parsed from os.Args.
+// The package-level functions such as Bool, String, and Parse operate on it.
+// They mirror the standard flag package and are intended for simple
+// single-command tools that don't need a Dispatcher.
+var CommandLine = NewFlagSet(os.Args[0])
+
+// BoolVar defines a bool flag on CommandLine. See FlagSet.BoolVar.
+func BoolVar(p *bool, name string, short rune, value bool, usage string) {
+	CommandLine.BoolVar(p, name, short, value, usage)
+}
+
+// Bool defines a bool flag on CommandLine. See FlagSet.Bool.
+func Bool(name string, short rune, value bool, usage string) *bool {
+	return CommandLine.Bool(name, short, value, usage)
+}
+
+// StringVar defines a string flag on CommandLine. See FlagSet.StringVar.
+func StringVar(p *string, name string, short rune, value string, usage string) {
+	CommandLine.StringVar(p, name, short, value, usage)
+}
+
+// String defines a string flag on CommandLine. See FlagSet.String.
+func String(name string, short rune, value string, usage string) *string {
+	return CommandLine.String(name, short, value, usage)
+}
+
+// IntVar defines an int flag on CommandLine. See FlagSet.IntVar.
+func IntVar(p *int, name string, short rune, value int, usage string) {
+	CommandLine.IntVar(p, name, short, value, usage)
+}
+
+// Int defines an int flag on CommandLine. See FlagSet.Int.
+func Int(name string, short rune, value int, usage string) *int {
+	return CommandLine.Int(name, short, value, usage)
+}
+
+// DurationVar defines a time.Duration flag on CommandLine. See FlagSet.DurationVar.
+func DurationVar(p *time.Duration, name string, short rune, value time.Duration, usage string) {
+	CommandLine.DurationVar(p, name, short, value, usage)
+}
+
+// Duration defines a time.Duration flag on CommandLine. See FlagSet.Duration.
+func Duration(name string, short rune, value time.Duration, usage string) *time.Duration {
+	return CommandLine.Duration(name, short, value, usage)
+}
+
+// Parse parses the command-line flags from arguments, typically os.Args[1:].
+// Must be called after all flags are defined and before flags are accessed by the program.
+func Parse(arguments []string) error {
+	return CommandLine.Parse(arguments)
+}
+
+// Args returns the non-flag command-line arguments.
+func Args() []string {
+	return CommandLine.Args()
+}
+
+// Parsed reports whether the command-line flags have been parsed.
+func Parsed() bool {
+	return CommandLine.Parsed()
+}
+
+// Lookup returns the Flag with the given name from CommandLine, or nil if not found.
+func Lookup(name string) *Flag {
+	return CommandLine.Lookup(name)
+}
+
+// VisitAll calls fn for each command-line flag in lexicographical order.
+func VisitAll(fn func(*Flag)) {
+	CommandLine.VisitAll(fn)
+}
+
+// Visit calls fn in lexicographical order for each command-line flag that was set.
+func Visit(fn func(*Flag)) {
+	CommandLine.Visit(fn)
+}
+
+// Changed reports whether the named command-line flag was set.
+func Changed(name string) bool {
+	return CommandLine.Changed(name)
+}
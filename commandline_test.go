@@ -0,0 +1,44 @@
+package mflags
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandLine(t *testing.T) {
+	old := CommandLine
+	defer func() { CommandLine = old }()
+	CommandLine = NewFlagSet("test")
+
+	verbose := Bool("verbose", 'v', false, "verbose output")
+	name := String("name", 'n', "default", "name")
+	count := Int("count", 'c', 1, "count")
+	timeout := Duration("timeout", 't', time.Second, "timeout")
+
+	assert.False(t, Parsed())
+
+	err := Parse([]string{"-v", "--name", "test", "-c", "3", "--timeout", "5s", "file.txt"})
+	assert.NoError(t, err)
+	assert.True(t, Parsed())
+	assert.True(t, *verbose)
+	assert.Equal(t, "test", *name)
+	assert.Equal(t, 3, *count)
+	assert.Equal(t, 5*time.Second, *timeout)
+	assert.Equal(t, []string{"file.txt"}, Args())
+	assert.NotNil(t, Lookup("name"))
+
+	var names []string
+	VisitAll(func(f *Flag) {
+		names = append(names, f.Name)
+	})
+	assert.Equal(t, []string{"count", "name", "timeout", "verbose"}, names)
+
+	var set []string
+	Visit(func(f *Flag) {
+		set = append(set, f.Name)
+	})
+	assert.Equal(t, []string{"count", "name", "timeout", "verbose"}, set)
+	assert.True(t, Changed("name"))
+}
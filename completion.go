@@ -2,6 +2,7 @@ package mflags
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"strings"
@@ -9,16 +10,194 @@ import (
 
 // Completion represents a single completion suggestion
 type Completion struct {
-	Value       string // The completion value (e.g., "--verbose" or "-v")
-	Description string // Optional description for the completion
-	IsBool      bool   // Whether this flag takes no argument
+	Value       string              // The completion value (e.g., "--verbose" or "-v")
+	Description string              // Optional description for the completion
+	IsBool      bool                // Whether this flag takes no argument
+	Directive   CompletionDirective // Hints for how the shell should treat this completion
+}
+
+// CompletionDirective is a bitmask telling the shell how to handle a set of completions.
+// Bash completion output carries the combined directive as a trailing ":<n>" line,
+// which the generated scripts interpret.
+type CompletionDirective int
+
+const (
+	// DirectiveDefault lets the shell apply its default behavior, falling back
+	// to file completion when there are no suggestions
+	DirectiveDefault CompletionDirective = 0
+	// DirectiveNoSpace prevents the shell from adding a space after the completion
+	DirectiveNoSpace CompletionDirective = 1 << (iota - 1)
+	// DirectiveNoFileComp disables the fallback to file completion
+	DirectiveNoFileComp
+	// DirectiveFiles completes file names
+	DirectiveFiles
+	// DirectiveDirs completes directory names only
+	DirectiveDirs
+)
+
+// SetCompletionDirective sets the directive used when completing the value of the named flag,
+// such as DirectiveFiles for a flag that takes a path.
+func (f *FlagSet) SetCompletionDirective(name string, directive CompletionDirective) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.directive = directive
+	}
+}
+
+// valueFlag returns the flag that arg names if it takes a value, or nil otherwise
+func (f *FlagSet) valueFlag(arg string) *Flag {
+	if !strings.HasPrefix(arg, "-") {
+		return nil
+	}
+
+	// Check long flags
+	if flag, ok := f.longFlag(strings.TrimLeft(arg, "-")); ok && !flag.disabled && !flag.Value.IsBool() && !flag.optional {
+		return flag
+	}
+
+	// Check short flags
+	if len(arg) == 2 {
+		if flag, ok := f.shortMap[rune(arg[1])]; ok && !flag.disabled && !flag.Value.IsBool() && !flag.optional {
+			return flag
+		}
+	}
+
+	return nil
+}
+
+// SetCompletionFunc sets a function that suggests values for the named flag.
+// It is called with the partial value being completed, such as to list git branches
+// for a --branch flag.
+func (f *FlagSet) SetCompletionFunc(name string, fn func(prefix string) []string) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.completionFunc = fn
+	}
+}
+
+// valueCompletions returns suggested values for the flag: its allowed choices that
+// start with prefix, followed by the results of its completion func, if any
+func valueCompletions(flag *Flag, prefix string) []Completion {
+	var completions []Completion
+	for _, choice := range flag.choices {
+		if strings.HasPrefix(choice, prefix) {
+			completions = append(completions, Completion{Value: choice})
+		}
+	}
+	if flag.completionFunc != nil {
+		for _, value := range flag.completionFunc(prefix) {
+			completions = append(completions, Completion{Value: value})
+		}
+	}
+	return completions
+}
+
+// printBashCompletions writes completions one per line, followed by the
+// combined directive line if any directive is set
+func printBashCompletions(w io.Writer, completions []Completion, directive CompletionDirective) {
+	for _, comp := range completions {
+		fmt.Fprintln(w, comp.Value)
+		directive |= comp.Directive
+	}
+	if directive != DirectiveDefault {
+		fmt.Fprintf(w, ":%d\n", directive)
+	}
+}
+
+// printZshCompletions writes completions one per line as value:description, with
+// colons in values escaped for _describe, followed by the combined directive line
+// if any directive is set
+func printZshCompletions(w io.Writer, completions []Completion, directive CompletionDirective) {
+	for _, comp := range completions {
+		value := strings.ReplaceAll(comp.Value, ":", `\:`)
+		if comp.Description != "" {
+			fmt.Fprintf(w, "%s:%s\n", value, comp.Description)
+		} else {
+			fmt.Fprintln(w, value)
+		}
+		directive |= comp.Directive
+	}
+	if directive != DirectiveDefault {
+		fmt.Fprintf(w, ":%d\n", directive)
+	}
+}
+
+// zshDynamicCompletion writes the body of a zsh completion function that calls the
+// program with --complete-zsh and applies the directive in its trailing ":<n>" line
+func zshDynamicCompletion(sb *strings.Builder, programName, indent string) {
+	lines := []string{
+		"local -a completions",
+		fmt.Sprintf("completions=( ${(f)\"$(%s --complete-zsh \"${(@)words[2,CURRENT]}\")\"} )", programName),
+		"# A trailing \":<n>\" line carries the completion directive bitmask",
+		"local directive=0",
+		"if (( ${#completions} > 0 )) && [[ \"${completions[-1]}\" == :<-> ]]; then",
+		"    directive=${completions[-1]#:}",
+		"    completions=( \"${(@)completions[1,-2]}\" )",
+		"fi",
+		"local -a nospace",
+		fmt.Sprintf("if (( directive & %d )); then", DirectiveNoSpace),
+		"    nospace=( -S '' )",
+		"fi",
+		fmt.Sprintf("if (( directive & %d )); then", DirectiveFiles),
+		"    _files \"${nospace[@]}\"",
+		fmt.Sprintf("elif (( directive & %d )); then", DirectiveDirs),
+		"    _files -/ \"${nospace[@]}\"",
+		"elif (( ${#completions} > 0 )); then",
+		"    _describe 'completion' completions \"${nospace[@]}\"",
+		fmt.Sprintf("elif (( !(directive & %d) )); then", DirectiveNoFileComp),
+		"    _files",
+		"fi",
+	}
+	for _, line := range lines {
+		sb.WriteString(indent + line + "\n")
+	}
+}
+
+// bashCompletionScript returns a bash completion script that calls the program with --complete-bash
+func bashCompletionScript(programName string) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# Bash completion for %s\n", programName))
+	sb.WriteString(fmt.Sprintf("_%s_completion() {\n", programName))
+	sb.WriteString("    local cur prev words cword\n")
+	sb.WriteString("    _init_completion || return\n\n")
+	sb.WriteString("    # Completions are newline-separated and may contain spaces\n")
+	sb.WriteString("    local IFS=$'\\n'\n")
+	sb.WriteString("    # Get completions from the program\n")
+	sb.WriteString(fmt.Sprintf("    local completions=( $(%s --complete-bash \"${COMP_WORDS[@]:1:$COMP_CWORD}\") )\n\n", programName))
+	sb.WriteString("    # A trailing \":<n>\" line carries the completion directive bitmask\n")
+	sb.WriteString("    local directive=0\n")
+	sb.WriteString("    local count=${#completions[@]}\n")
+	sb.WriteString("    if (( count > 0 )) && [[ \"${completions[count-1]}\" =~ ^:[0-9]+$ ]]; then\n")
+	sb.WriteString("        directive=${completions[count-1]#:}\n")
+	sb.WriteString("        unset 'completions[count-1]'\n")
+	sb.WriteString("    fi\n\n")
+	sb.WriteString(fmt.Sprintf("    if (( directive & %d )); then\n", DirectiveFiles))
+	sb.WriteString("        COMPREPLY=( $(compgen -f -- \"$cur\") )\n")
+	sb.WriteString(fmt.Sprintf("    elif (( directive & %d )); then\n", DirectiveDirs))
+	sb.WriteString("        COMPREPLY=( $(compgen -d -- \"$cur\") )\n")
+	sb.WriteString("    else\n")
+	sb.WriteString("        COMPREPLY=( $(compgen -W \"${completions[*]}\" -- \"$cur\") )\n")
+	sb.WriteString("    fi\n\n")
+	sb.WriteString(fmt.Sprintf("    if (( directive & %d )); then\n", DirectiveNoSpace))
+	sb.WriteString("        compopt -o nospace\n")
+	sb.WriteString("    fi\n")
+	sb.WriteString(fmt.Sprintf("    if (( ${#COMPREPLY[@]} == 0 && !(directive & %d) )); then\n", DirectiveNoFileComp))
+	sb.WriteString("        compopt -o default\n")
+	sb.WriteString("    fi\n")
+	sb.WriteString("}\n\n")
+	sb.WriteString(fmt.Sprintf("complete -F _%s_completion %s\n", programName, programName))
+
+	return sb.String()
 }
 
 // VisitAll calls fn for each flag in lexicographical order
 func (f *FlagSet) VisitAll(fn func(*Flag)) {
-	// Make a copy of allFlags for sorting
-	flags := make([]*Flag, len(f.allFlags))
-	copy(flags, f.allFlags)
+	// Make a copy of allFlags for sorting, skipping disabled experimental flags
+	flags := make([]*Flag, 0, len(f.allFlags))
+	for _, flag := range f.allFlags {
+		if !flag.disabled {
+			flags = append(flags, flag)
+		}
+	}
 
 	// Sort by name, or by short rune if name is empty
 	sort.Slice(flags, func(i, j int) bool {
@@ -44,11 +223,21 @@ func (f *FlagSet) VisitAll(fn func(*Flag)) {
 	}
 }
 
+// Visit calls fn in lexicographical order for each flag that was set during the
+// last Parse, either on the command line or from its environment variable
+func (f *FlagSet) Visit(fn func(*Flag)) {
+	f.VisitAll(func(flag *Flag) {
+		if flag.isSet() {
+			fn(flag)
+		}
+	})
+}
+
 // GetLongFlags returns all long flag names with "--" prefix
 func (f *FlagSet) GetLongFlags() []string {
 	var flags []string
-	for name := range f.flags {
-		if name != "" {
+	for name, flag := range f.flags {
+		if name != "" && !flag.disabled {
 			flags = append(flags, "--"+name)
 		}
 	}
@@ -61,8 +250,8 @@ func (f *FlagSet) GetShortFlags() []string {
 	var flags []string
 	seen := make(map[rune]bool)
 
-	for r := range f.shortMap {
-		if r != 0 && !seen[r] {
+	for r, flag := range f.shortMap {
+		if r != 0 && !seen[r] && !flag.disabled {
 			flags = append(flags, fmt.Sprintf("-%c", r))
 			seen[r] = true
 		}
@@ -71,16 +260,25 @@ func (f *FlagSet) GetShortFlags() []string {
 	return flags
 }
 
-// GetFlagCompletions returns completions for the current context
+// GetFlagCompletions returns completions for the current context.
+// Long flags are listed first in alphabetical order, followed by short flags.
 func (f *FlagSet) GetFlagCompletions(prefix string) []Completion {
 	var completions []Completion
 
 	// Handle different prefix types
-	if strings.HasPrefix(prefix, "--") {
+	if name, value, ok := strings.Cut(prefix, "="); ok && strings.HasPrefix(name, "--") {
+		// Value completion for --name=value
+		if flag, exists := f.longFlag(name[2:]); exists && !flag.disabled {
+			for _, comp := range valueCompletions(flag, value) {
+				comp.Value = name + "=" + comp.Value
+				completions = append(completions, comp)
+			}
+		}
+	} else if strings.HasPrefix(prefix, "--") {
 		// Long flag completion
 		search := prefix[2:]
 		for name, flag := range f.flags {
-			if name != "" && strings.HasPrefix(name, search) {
+			if name != "" && !flag.disabled && strings.HasPrefix(name, search) {
 				completions = append(completions, Completion{
 					Value:       "--" + name,
 					Description: flag.Usage,
@@ -93,6 +291,9 @@ func (f *FlagSet) GetFlagCompletions(prefix string) []Completion {
 		if len(prefix) == 1 {
 			// Show all short flags
 			for r, flag := range f.shortMap {
+				if flag.disabled {
+					continue
+				}
 				completions = append(completions, Completion{
 					Value:       fmt.Sprintf("-%c", r),
 					Description: flag.Usage,
@@ -102,7 +303,7 @@ func (f *FlagSet) GetFlagCompletions(prefix string) []Completion {
 		} else {
 			// Filter by the character after -
 			search := rune(prefix[1])
-			if flag, ok := f.shortMap[search]; ok {
+			if flag, ok := f.shortMap[search]; ok && !flag.disabled {
 				completions = append(completions, Completion{
 					Value:       prefix,
 					Description: flag.Usage,
@@ -113,7 +314,7 @@ func (f *FlagSet) GetFlagCompletions(prefix string) []Completion {
 	} else if prefix == "" {
 		// No prefix, show all flags
 		for name, flag := range f.flags {
-			if name != "" {
+			if name != "" && !flag.disabled {
 				completions = append(completions, Completion{
 					Value:       "--" + name,
 					Description: flag.Usage,
@@ -122,6 +323,9 @@ func (f *FlagSet) GetFlagCompletions(prefix string) []Completion {
 			}
 		}
 		for r, flag := range f.shortMap {
+			if flag.disabled {
+				continue
+			}
 			completions = append(completions, Completion{
 				Value:       fmt.Sprintf("-%c", r),
 				Description: flag.Usage,
@@ -130,14 +334,25 @@ func (f *FlagSet) GetFlagCompletions(prefix string) []Completion {
 		}
 	}
 
-	// Sort completions
-	sort.Slice(completions, func(i, j int) bool {
-		return completions[i].Value < completions[j].Value
-	})
+	sortFlagCompletions(completions)
 
 	return completions
 }
 
+// sortFlagCompletions orders flag completions with long flags first in
+// alphabetical order, followed by short flags in alphabetical order.
+// All completion output (GetFlagCompletions, bash, and zsh) uses this ordering.
+func sortFlagCompletions(completions []Completion) {
+	sort.SliceStable(completions, func(i, j int) bool {
+		iLong := strings.HasPrefix(completions[i].Value, "--")
+		jLong := strings.HasPrefix(completions[j].Value, "--")
+		if iLong != jLong {
+			return iLong
+		}
+		return completions[i].Value < completions[j].Value
+	})
+}
+
 // PrintBashCompletions outputs completions in bash format
 func (f *FlagSet) PrintBashCompletions(args []string) {
 	// Determine what we're completing
@@ -153,25 +368,10 @@ func (f *FlagSet) PrintBashCompletions(args []string) {
 
 	// Check if we're completing a flag value
 	if len(args) >= 2 {
-		prevArg := args[len(args)-2]
-		if strings.HasPrefix(prevArg, "-") {
-			// Check if previous arg was a flag that needs a value
-			flagName := strings.TrimLeft(prevArg, "-")
-
-			// Check long flags
-			if flag, ok := f.flags[flagName]; ok && !flag.Value.IsBool() {
-				// We're completing a value for this flag
-				// For now, we don't provide value completions
-				return
-			}
-
-			// Check short flags
-			if len(prevArg) == 2 {
-				if flag, ok := f.shortMap[rune(prevArg[1])]; ok && !flag.Value.IsBool() {
-					// We're completing a value for this flag
-					return
-				}
-			}
+		if flag := f.valueFlag(args[len(args)-2]); flag != nil {
+			// We're completing a value for this flag
+			printBashCompletions(f.output(), valueCompletions(flag, currentWord), flag.directive)
+			return
 		}
 	}
 
@@ -179,41 +379,26 @@ func (f *FlagSet) PrintBashCompletions(args []string) {
 	completions := f.GetFlagCompletions(currentWord)
 
 	// Print completions (one per line for bash)
-	for _, comp := range completions {
-		fmt.Println(comp.Value)
-	}
+	printBashCompletions(f.output(), completions, DirectiveDefault)
 }
 
 // PrintZshCompletions outputs completions in zsh format
 func (f *FlagSet) PrintZshCompletions(args []string) {
-	// Get all completions
-	completions := f.GetFlagCompletions("")
-
-	// Print in zsh format with descriptions
-	for _, comp := range completions {
-		if comp.Description != "" {
-			fmt.Printf("%s:%s\n", comp.Value, comp.Description)
-		} else {
-			fmt.Println(comp.Value)
+	// Check if we're completing a flag value
+	if len(args) >= 2 {
+		if flag := f.valueFlag(args[len(args)-2]); flag != nil {
+			printZshCompletions(f.output(), valueCompletions(flag, args[len(args)-1]), flag.directive)
+			return
 		}
 	}
+
+	// Print all flags in zsh format with descriptions
+	printZshCompletions(f.output(), f.GetFlagCompletions(""), DirectiveDefault)
 }
 
 // GenerateBashCompletion generates a bash completion script
 func (f *FlagSet) GenerateBashCompletion(programName string) string {
-	var sb strings.Builder
-
-	sb.WriteString(fmt.Sprintf("# Bash completion for %s\n", programName))
-	sb.WriteString(fmt.Sprintf("_%s_completion() {\n", programName))
-	sb.WriteString("    local cur prev words cword\n")
-	sb.WriteString("    _init_completion || return\n\n")
-	sb.WriteString("    # Get flag completions from the program\n")
-	sb.WriteString(fmt.Sprintf("    local completions=$(%s --complete-bash \"${COMP_WORDS[@]:1:$COMP_CWORD}\")\n", programName))
-	sb.WriteString("    COMPREPLY=( $(compgen -W \"$completions\" -- \"$cur\") )\n")
-	sb.WriteString("}\n\n")
-	sb.WriteString(fmt.Sprintf("complete -F _%s_completion %s\n", programName, programName))
-
-	return sb.String()
+	return bashCompletionScript(programName)
 }
 
 // GenerateZshCompletion generates a zsh completion script
@@ -225,25 +410,22 @@ func (f *FlagSet) GenerateZshCompletion(programName string) string {
 	sb.WriteString("    local -a flags\n")
 	sb.WriteString("    flags=(\n")
 
-	// Add all flags with descriptions
-	f.VisitAll(func(flag *Flag) {
-		if flag.Name != "" {
-			desc := strings.ReplaceAll(flag.Usage, "'", "'\"'\"'")
-			if flag.Value.IsBool() {
-				sb.WriteString(fmt.Sprintf("        '--%s[%s]'\n", flag.Name, desc))
-			} else {
-				sb.WriteString(fmt.Sprintf("        '--%s=[%s]:value'\n", flag.Name, desc))
-			}
+	// Add all flags with descriptions, in the same order as GetFlagCompletions
+	for _, comp := range f.GetFlagCompletions("") {
+		desc := strings.ReplaceAll(comp.Description, "'", "'\"'\"'")
+		var action string
+		if flag := f.valueFlag(comp.Value); flag != nil {
+			action = zshValueAction(flag)
 		}
-		if flag.Short != 0 {
-			desc := strings.ReplaceAll(flag.Usage, "'", "'\"'\"'")
-			if flag.Value.IsBool() {
-				sb.WriteString(fmt.Sprintf("        '-%c[%s]'\n", flag.Short, desc))
-			} else {
-				sb.WriteString(fmt.Sprintf("        '-%c[%s]:value'\n", flag.Short, desc))
-			}
+		switch {
+		case comp.IsBool:
+			sb.WriteString(fmt.Sprintf("        '%s[%s]'\n", comp.Value, desc))
+		case strings.HasPrefix(comp.Value, "--"):
+			sb.WriteString(fmt.Sprintf("        '%s=[%s]:value%s'\n", comp.Value, desc, action))
+		default:
+			sb.WriteString(fmt.Sprintf("        '%s[%s]:value%s'\n", comp.Value, desc, action))
 		}
-	})
+	}
 
 	sb.WriteString("    )\n")
 	sb.WriteString("    _arguments -s $flags\n")
@@ -253,6 +435,30 @@ func (f *FlagSet) GenerateZshCompletion(programName string) string {
 	return sb.String()
 }
 
+// zshValueAction returns the _arguments action suffix for a flag's value,
+// based on its choices or completion directive. Like the bash script, values
+// without suggestions fall back to file names unless DirectiveNoFileComp is set.
+func zshValueAction(flag *Flag) string {
+	nospace := ""
+	if flag.directive&DirectiveNoSpace != 0 {
+		nospace = ` -S ""`
+	}
+	switch {
+	case len(flag.choices) > 0 && nospace != "":
+		return ":{compadd" + nospace + " -- " + strings.Join(flag.choices, " ") + "}"
+	case len(flag.choices) > 0:
+		return ":(" + strings.Join(flag.choices, " ") + ")"
+	case flag.directive&DirectiveFiles != 0:
+		return ":_files" + nospace
+	case flag.directive&DirectiveDirs != 0:
+		return ":_files -/" + nospace
+	case flag.directive&DirectiveNoFileComp != 0:
+		return ""
+	default:
+		return ":_files"
+	}
+}
+
 // HandleCompletion checks for completion requests and handles them
 // Returns true if a completion request was handled
 func (f *FlagSet) HandleCompletion(args []string) bool {
@@ -277,14 +483,14 @@ func (f *FlagSet) HandleCompletion(args []string) bool {
 			if f.name != "" {
 				programName = f.name
 			}
-			fmt.Print(f.GenerateBashCompletion(programName))
+			fmt.Fprint(f.output(), f.GenerateBashCompletion(programName))
 			return true
 		case "--generate-zsh-completion":
 			programName := "program"
 			if f.name != "" {
 				programName = f.name
 			}
-			fmt.Print(f.GenerateZshCompletion(programName))
+			fmt.Fprint(f.output(), f.GenerateZshCompletion(programName))
 			return true
 		}
 	}
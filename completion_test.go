@@ -243,6 +243,7 @@ func TestGenerateBashCompletion(t *testing.T) {
 	assert.Contains(t, script, "myapp_completion")
 	assert.Contains(t, script, "complete -F _myapp_completion myapp")
 	assert.Contains(t, script, "COMPREPLY")
+	assert.Contains(t, script, "local IFS=$'\\n'")
 }
 
 func TestGenerateZshCompletion(t *testing.T) {
@@ -336,3 +337,169 @@ func TestCompletionSorting(t *testing.T) {
 
 	assert.Equal(t, []string{"--alpha", "--middle", "--zebra"}, longFlags[:3])
 }
+
+func TestCompletionOrdering(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.Bool("zebra", 'z', false, "zebra")
+	fs.String("alpha", 'c', "", "alpha")
+	fs.Bool("", 'b', false, "short only")
+	fs.Int("middle", 0, 0, "middle")
+
+	expected := []string{"--alpha", "--middle", "--zebra", "-b", "-c", "-z"}
+
+	var values []string
+	for _, c := range fs.GetFlagCompletions("") {
+		values = append(values, c.Value)
+	}
+	assert.Equal(t, expected, values)
+
+	// Bash output uses the same ordering
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	fs.PrintBashCompletions([]string{""})
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	assert.Equal(t, expected, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+
+	// Zsh script lists flags in the same order
+	script := fs.GenerateZshCompletion("test")
+	lastIndex := -1
+	for _, value := range expected {
+		idx := strings.Index(script, "'"+value+"[")
+		if idx < 0 {
+			idx = strings.Index(script, "'"+value+"=[")
+		}
+		assert.Greater(t, idx, lastIndex, "expected %s after previous flag", value)
+		lastIndex = idx
+	}
+}
+
+func TestCompletionDirectives(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.String("config", 'c', "", "config file")
+	fs.String("workdir", 'w', "", "working directory")
+	fs.String("name", 'n', "", "name")
+	fs.String("id", 0, "", "identifier")
+	fs.String("level", 0, "", "level")
+	fs.SetCompletionDirective("config", DirectiveFiles)
+	fs.SetCompletionDirective("workdir", DirectiveDirs|DirectiveNoSpace)
+	fs.SetCompletionDirective("id", DirectiveNoFileComp)
+	fs.SetCompletionDirective("level", DirectiveNoSpace)
+	fs.SetChoices("level", []string{"low", "high"})
+
+	capture := func(args []string) string {
+		old := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		fs.PrintBashCompletions(args)
+
+		w.Close()
+		os.Stdout = old
+
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		return buf.String()
+	}
+
+	assert.Equal(t, ":4\n", capture([]string{"--config", ""}))
+	assert.Equal(t, ":4\n", capture([]string{"-c", ""}))
+	assert.Equal(t, ":9\n", capture([]string{"--workdir", ""}))
+	assert.Equal(t, "", capture([]string{"--name", ""}))
+	assert.NotContains(t, capture([]string{"--"}), ":")
+
+	bashScript := fs.GenerateBashCompletion("test")
+	assert.Contains(t, bashScript, "directive & 4")
+	assert.Contains(t, bashScript, "compgen -f")
+	assert.Contains(t, bashScript, "compgen -d")
+	assert.Contains(t, bashScript, "compopt -o nospace")
+
+	zshScript := fs.GenerateZshCompletion("test")
+	assert.Contains(t, zshScript, "'--config=[config file]:value:_files'")
+	assert.Contains(t, zshScript, `'--workdir=[working directory]:value:_files -/ -S ""'`)
+	assert.Contains(t, zshScript, "'--name=[name]:value:_files'")
+	assert.Contains(t, zshScript, "'--id=[identifier]:value'")
+	assert.Contains(t, zshScript, `'--level=[level]:value:{compadd -S "" -- low high}'`)
+
+	// Zsh completion output carries the directive line too
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	fs.PrintZshCompletions([]string{"--level", "h"})
+	assert.Equal(t, "high\n:1\n", buf.String())
+
+	buf.Reset()
+	fs.PrintZshCompletions([]string{"--id", ""})
+	assert.Equal(t, ":2\n", buf.String())
+}
+
+func TestChoiceCompletions(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.String("log-level", 'l', "info", "log level")
+	fs.SetChoices("log-level", []string{"debug", "info", "warn", "error"})
+
+	completions := fs.GetFlagCompletions("--log-level=")
+	var values []string
+	for _, comp := range completions {
+		values = append(values, comp.Value)
+	}
+	assert.Equal(t, []string{"--log-level=debug", "--log-level=error", "--log-level=info", "--log-level=warn"}, values)
+
+	completions = fs.GetFlagCompletions("--log-level=d")
+	assert.Len(t, completions, 1)
+	assert.Equal(t, "--log-level=debug", completions[0].Value)
+
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	fs.PrintBashCompletions([]string{"-l", "w"})
+	assert.Equal(t, "warn\n", buf.String())
+
+	zshScript := fs.GenerateZshCompletion("test")
+	assert.Contains(t, zshScript, "'--log-level=[log level]:value:(debug info warn error)'")
+}
+
+func TestCompletionFunc(t *testing.T) {
+	branches := func(prefix string) []string {
+		var matches []string
+		for _, b := range []string{"main", "feature/login", "fix/typo"} {
+			if strings.HasPrefix(b, prefix) {
+				matches = append(matches, b)
+			}
+		}
+		return matches
+	}
+
+	fs := NewFlagSet("checkout")
+	fs.String("branch", 'b', "", "branch to check out")
+	fs.Bool("force", 'f', false, "force checkout")
+	fs.SetCompletionFunc("branch", branches)
+
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	fs.PrintBashCompletions([]string{"--branch", "f"})
+	assert.Equal(t, "feature/login\nfix/typo\n", buf.String())
+
+	buf.Reset()
+	fs.PrintBashCompletions([]string{"-b", ""})
+	assert.Equal(t, "main\nfeature/login\nfix/typo\n", buf.String())
+
+	completions := fs.GetFlagCompletions("--branch=m")
+	assert.Len(t, completions, 1)
+	assert.Equal(t, "--branch=main", completions[0].Value)
+
+	t.Run("dispatcher", func(t *testing.T) {
+		d := NewDispatcher("git")
+		d.Dispatch("checkout", NewCommand(fs,
+			func(flags *FlagSet, args []string) error { return nil }))
+
+		var buf bytes.Buffer
+		d.SetOutput(&buf)
+		d.PrintBashCompletions([]string{"checkout", "--branch", "ma"})
+		assert.Equal(t, "main\n", buf.String())
+	})
+}
@@ -1,10 +1,19 @@
 package mflags
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"runtime/debug"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Command is an interface for executable commands
@@ -25,20 +34,67 @@ type OutputFormatter interface {
 	OutputFormat() OutputFormat
 }
 
+// OutputWriter is an interface for commands that write their output to explicit
+// writers rather than os.Stdout and os.Stderr. Callers that capture output, such
+// as the MCP server, use ExecuteWith to run these commands without
+// redirecting the process-wide streams.
+type OutputWriter interface {
+	// RunWithOutput executes the command like Run, writing to stdout and stderr
+	RunWithOutput(fs *FlagSet, args []string, stdout, stderr io.Writer) error
+}
+
+// ContextRunner is an interface for commands that accept a context. The dispatcher
+// calls RunContext instead of Run, passing the context given to ExecuteContext or
+// ExecuteWithContext, or context.Background() for the other Execute methods.
+type ContextRunner interface {
+	// RunContext executes the command like Run, with ctx for cancellation and deadlines
+	RunContext(ctx context.Context, fs *FlagSet, args []string) error
+}
+
+// ContextOutputWriter is an interface for commands that take both a context and
+// explicit output writers. The dispatcher prefers it over OutputWriter and
+// ContextRunner, so the command always receives both.
+type ContextOutputWriter interface {
+	// RunContextWithOutput executes the command like Run, with ctx for cancellation
+	// and deadlines, writing to stdout and stderr
+	RunContextWithOutput(ctx context.Context, fs *FlagSet, args []string, stdout, stderr io.Writer) error
+}
+
 // OutputFormat defines how a command formats its output
 type OutputFormat string
 
 const (
 	OutputFormatRaw  OutputFormat = "raw"
 	OutputFormatJSON OutputFormat = "json"
+	OutputFormatYAML OutputFormat = "yaml"
 )
 
+// outputFormatMimeTypes maps output formats to the MIME type of their content
+var outputFormatMimeTypes = map[OutputFormat]string{
+	OutputFormatJSON: "application/json",
+	OutputFormatYAML: "application/yaml",
+}
+
+// MimeType returns the MIME type of output in this format, or an empty
+// string for raw and unknown formats
+func (f OutputFormat) MimeType() string {
+	return outputFormatMimeTypes[f]
+}
+
+// CommandFunc is the signature of a command handler
+type CommandFunc func(fs *FlagSet, args []string) error
+
+// Middleware wraps a command handler with additional behavior, such as
+// authentication, panic recovery, or metrics
+type Middleware func(next CommandFunc) CommandFunc
+
 // funcCommand is a basic implementation of Command interface
 type funcCommand struct {
 	flags        *FlagSet
 	handler      func(fs *FlagSet, args []string) error
 	usage        string
 	outputFormat OutputFormat
+	strictArgs   bool
 }
 
 // CommandOption is a functional option for configuring a command
@@ -58,6 +114,15 @@ func WithOutputFormat(format OutputFormat) CommandOption {
 	}
 }
 
+// WithStrictArgs makes the command fail with ErrTooManyArgs when given non-flag
+// arguments that no positional field takes, instead of leaving them unused.
+// It has no effect on commands whose FlagSet defines a rest field.
+func WithStrictArgs() CommandOption {
+	return func(c *funcCommand) {
+		c.strictArgs = true
+	}
+}
+
 // NewCommand creates a new command with the given options
 func NewCommand(fs *FlagSet, handler func(fs *FlagSet, args []string) error, opts ...CommandOption) Command {
 	c := &funcCommand{
@@ -71,6 +136,9 @@ func NewCommand(fs *FlagSet, handler func(fs *FlagSet, args []string) error, opt
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.strictArgs && fs != nil {
+		fs.SetStrictArgs(true)
+	}
 
 	return c
 }
@@ -112,16 +180,291 @@ type CommandEntry struct {
 
 // Dispatcher manages command routing and execution
 type Dispatcher struct {
-	commands map[string]*CommandEntry
-	name     string
+	commands            map[string]*CommandEntry
+	name                string
+	out                 io.Writer                 // Destination for help and completion output; nil means os.Stdout
+	suggestionThreshold int                       // Maximum edit distance for "Did you mean" suggestions; 0 disables them
+	defaultCommand      string                    // Command run when no other command matches; empty means none
+	globalFlags         *FlagSet                  // Flags shared by every command; nil until GlobalFlags is called
+	middleware          []Middleware              // Wrappers applied around every command, outermost first
+	version             string                    // Printed by the built-in version command; empty disables it
+	helpWidth           int                       // Width help output is wrapped to; 0 means the terminal width
+	groups              map[string]*CommandGroup  // Command groups by path; nil until Group is called
+	recoverPanics       bool                      // Whether command panics are returned as *PanicError
+	notFound            func(args []string) error // Called for unknown commands; nil means return an error
+	helpFlags           []string                  // Arguments that request help
+	helpCommand         string                    // Command name that requests help; empty disables it
+}
+
+// PanicError is returned by Execute when a command panics and panic recovery
+// is enabled with SetRecoverPanics
+type PanicError struct {
+	Value any    // The value the command panicked with
+	Stack []byte // Stack trace of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("command panicked: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
 }
 
+// defaultSuggestionThreshold is the maximum edit distance for suggesting a command
+const defaultSuggestionThreshold = 2
+
+// defaultHelpWidth is the width help output is wrapped to when the terminal width is unknown
+const defaultHelpWidth = 80
+
+// minHelpTextWidth is the narrowest column help text is wrapped into; narrower
+// terminals get unwrapped text rather than a column of single words
+const minHelpTextWidth = 20
+
 // NewDispatcher creates a new command dispatcher
 func NewDispatcher(name string) *Dispatcher {
 	return &Dispatcher{
-		commands: make(map[string]*CommandEntry),
-		name:     name,
+		commands:            make(map[string]*CommandEntry),
+		name:                name,
+		suggestionThreshold: defaultSuggestionThreshold,
+		helpFlags:           []string{"-h", "--help"},
+		helpCommand:         "help",
+	}
+}
+
+// SetOutput sets the destination for help and completion output.
+// If w is nil, output goes to os.Stdout.
+func (d *Dispatcher) SetOutput(w io.Writer) {
+	d.out = w
+}
+
+// output returns the destination for help and completion output
+func (d *Dispatcher) output() io.Writer {
+	if d.out == nil {
+		return os.Stdout
+	}
+	return d.out
+}
+
+// SetHelpWidth sets the width that usage text in help output is wrapped to.
+// By default the width of the terminal on standard output is used, falling back
+// to the COLUMNS environment variable, or 80 columns if neither is available.
+func (d *Dispatcher) SetHelpWidth(width int) {
+	d.helpWidth = width
+}
+
+// width returns the width help output is wrapped to
+func (d *Dispatcher) width() int {
+	if d.helpWidth > 0 {
+		return d.helpWidth
+	}
+	return terminalWidth()
+}
+
+// terminalSize returns the width of the terminal on standard output; tests replace it
+var terminalSize = stdoutWidth
+
+// terminalWidth returns the width of the terminal on standard output, or the
+// COLUMNS environment variable if that isn't a terminal, or defaultHelpWidth
+func terminalWidth() int {
+	if width, ok := terminalSize(); ok && width > 0 {
+		return width
+	}
+	if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+		return width
+	}
+	return defaultHelpWidth
+}
+
+// printWrapped prints prefix followed by text word-wrapped to width, measured in
+// runes. Each line of a multi-line text is wrapped as its own paragraph, and
+// continuation lines are indented by indent columns so they align under the
+// start of the text.
+func printWrapped(out io.Writer, prefix string, indent int, text string, width int) {
+	for i, paragraph := range strings.Split(text, "\n") {
+		if i > 0 {
+			prefix = strings.Repeat(" ", indent)
+		}
+		if strings.TrimSpace(paragraph) == "" {
+			fmt.Fprintln(out)
+			continue
+		}
+		if width-indent < minHelpTextWidth {
+			fmt.Fprintln(out, prefix+strings.TrimSpace(paragraph))
+			continue
+		}
+
+		line := prefix
+		lineStart := utf8.RuneCountInString(prefix)
+		lineWidth := lineStart
+		for _, word := range strings.Fields(paragraph) {
+			wordWidth := utf8.RuneCountInString(word)
+			if lineWidth > lineStart && lineWidth+1+wordWidth > width {
+				fmt.Fprintln(out, line)
+				line = strings.Repeat(" ", indent)
+				lineStart = indent
+				lineWidth = indent
+			}
+			if lineWidth > lineStart {
+				line += " "
+				lineWidth++
+			}
+			line += word
+			lineWidth += wordWidth
+		}
+		fmt.Fprintln(out, line)
+	}
+}
+
+// SetHelpFlags replaces the flags that request help, -h and --help by default.
+// Use it to free a flag for another purpose, such as -h for --host. With no
+// flags, only the help command requests help.
+func (d *Dispatcher) SetHelpFlags(flags ...string) {
+	d.helpFlags = flags
+}
+
+// SetHelpCommand sets the command name that requests help, "help" by default.
+// An empty name disables the help command.
+func (d *Dispatcher) SetHelpCommand(name string) {
+	d.helpCommand = name
+}
+
+// isHelpFlag reports whether flag is one of the dispatcher's help flags
+func (d *Dispatcher) isHelpFlag(flag string) bool {
+	return slices.Contains(d.helpFlags, flag)
+}
+
+// isHelpArg reports whether arg requests help, as a help flag or the help command
+func (d *Dispatcher) isHelpArg(arg string) bool {
+	return d.isHelpFlag(arg) || (d.helpCommand != "" && arg == d.helpCommand)
+}
+
+// printHelpHint prints how to get help for the commands under path
+func (d *Dispatcher) printHelpHint(out io.Writer, path string) {
+	if len(d.helpFlags) == 0 {
+		return
+	}
+	// Prefer a long help flag in the hint
+	flag := d.helpFlags[0]
+	for _, f := range d.helpFlags {
+		if strings.HasPrefix(f, "--") {
+			flag = f
+			break
+		}
+	}
+	command := "<command>"
+	if path != "" {
+		command = path + " " + command
 	}
+	fmt.Fprintf(out, "\nUse '%s %s' for more information about a command.\n", command, flag)
+}
+
+// SetSuggestionThreshold sets the maximum edit distance between an unknown command
+// and a registered one for the latter to be suggested. A value of 0 or less disables suggestions.
+func (d *Dispatcher) SetSuggestionThreshold(n int) {
+	d.suggestionThreshold = n
+}
+
+// SetDefaultCommand sets the command that Execute runs when the arguments don't
+// match any registered command and don't start with a flag, including when there
+// are no arguments at all. The original arguments are passed to it unchanged.
+// Help flags still show the general help.
+func (d *Dispatcher) SetDefaultCommand(path string) {
+	d.defaultCommand = normalizeCommandPath(path)
+}
+
+// SetNotFoundHandler sets a function Execute calls, instead of returning an
+// "unknown command" error, when the arguments don't match any command. It receives
+// the arguments unchanged and its result is returned from Execute, so it can print
+// suggestions, run a fallback such as an external "myapp-<command>" program, or
+// exit. Help flags and a default command set with SetDefaultCommand take
+// precedence. Pass nil to restore the default error.
+func (d *Dispatcher) SetNotFoundHandler(fn func(args []string) error) {
+	d.notFound = fn
+}
+
+// GlobalFlags returns the FlagSet for flags shared by every command, such as --config.
+// Global flags are merged into each command's FlagSet before it is parsed, shown in help
+// or completion, or described as an MCP tool, so handlers can look them up on the FlagSet
+// they are passed. A command flag with the same long name takes precedence over the global
+// one; if only the short name is taken, the global flag is merged without it. After a
+// command runs, Changed and Source on the global FlagSet report how it set each flag.
+func (d *Dispatcher) GlobalFlags() *FlagSet {
+	if d.globalFlags == nil {
+		d.globalFlags = NewFlagSet(d.name)
+	}
+	return d.globalFlags
+}
+
+// isGlobalFlag reports whether flag was defined in, or merged from, the dispatcher's
+// global flags
+func (d *Dispatcher) isGlobalFlag(flag *Flag) bool {
+	if flag.origin != nil {
+		flag = flag.origin
+	}
+	return d.globalFlags != nil && slices.Contains(d.globalFlags.allFlags, flag)
+}
+
+// isSharedFlag reports whether flag was defined in, or merged from, the global flags
+// or the flags of a group containing path
+func (d *Dispatcher) isSharedFlag(path string, flag *Flag) bool {
+	if flag.origin != nil {
+		flag = flag.origin
+	}
+	for _, shared := range d.sharedFlags(path) {
+		if slices.Contains(shared.allFlags, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetVersion enables a built-in "version" command and top-level --version and -V
+// flags that print version and return. The version may span multiple lines to
+// include build metadata such as a commit hash or build date; its first line is
+// also reported as the server version when the dispatcher is served over MCP.
+// A registered "version" command takes precedence over the built-in one.
+func (d *Dispatcher) SetVersion(version string) {
+	d.version = version
+}
+
+// showVersion prints the version string to out
+func (d *Dispatcher) showVersion(out io.Writer) error {
+	fmt.Fprintln(out, strings.TrimRight(d.version, "\n"))
+	return nil
+}
+
+// isVersionRequest reports whether args ask for the built-in version output
+func (d *Dispatcher) isVersionRequest(args []string) bool {
+	if d.version == "" || len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "--version", "-V":
+		return true
+	case "version":
+		_, registered := d.commands["version"]
+		return !registered
+	}
+	return false
+}
+
+// SetRecoverPanics sets whether Execute recovers from a panic in a command,
+// including its middleware, and returns it as a *PanicError carrying the panic
+// value and stack trace. It is off by default, so panics crash the program as usual.
+// The MCP server always recovers panics in tool calls, whatever this setting.
+func (d *Dispatcher) SetRecoverPanics(enabled bool) {
+	d.recoverPanics = enabled
+}
+
+// Use adds middleware that wraps every command run by Execute.
+// Middleware registered first is the outermost wrapper.
+func (d *Dispatcher) Use(mw Middleware) {
+	d.middleware = append(d.middleware, mw)
 }
 
 // Dispatch registers a command
@@ -136,15 +479,150 @@ func (d *Dispatcher) Dispatch(path string, cmd Command) {
 	}
 }
 
+// CommandGroup builds a tree of commands sharing a path prefix. Commands added to
+// a group are registered with the dispatcher under the group's path, so they run
+// and can be looked up exactly like commands registered with Dispatch.
+type CommandGroup struct {
+	d     *Dispatcher
+	path  string
+	usage string
+	flags *FlagSet
+}
+
+// Group returns the command group for path, creating it if needed. Calling Group
+// again with the same path returns the same group.
+func (d *Dispatcher) Group(path string) *CommandGroup {
+	path = normalizeCommandPath(path)
+	if g, ok := d.groups[path]; ok {
+		return g
+	}
+	if d.groups == nil {
+		d.groups = make(map[string]*CommandGroup)
+	}
+	g := &CommandGroup{d: d, path: path}
+	d.groups[path] = g
+	return g
+}
+
+// Path returns the group's command path
+func (g *CommandGroup) Path() string {
+	return g.path
+}
+
+// Add registers cmd as the named child of the group and returns the group for chaining
+func (g *CommandGroup) Add(name string, cmd Command) *CommandGroup {
+	g.d.Dispatch(g.path+" "+name, cmd)
+	return g
+}
+
+// Group returns the named child group, creating it if needed
+func (g *CommandGroup) Group(name string) *CommandGroup {
+	return g.d.Group(g.path + " " + name)
+}
+
+// SetUsage sets the description of the group and returns the group for chaining
+func (g *CommandGroup) SetUsage(usage string) *CommandGroup {
+	g.usage = usage
+	return g
+}
+
+// Usage returns the description of the group
+func (g *CommandGroup) Usage() string {
+	return g.usage
+}
+
+// Flags returns the FlagSet for flags shared by every command in the group and its
+// child groups. They are merged into each command's FlagSet when it runs, like global
+// flags. A command flag takes precedence over a group flag with the same name, and a
+// group flag over one of an enclosing group or a global flag.
+func (g *CommandGroup) Flags() *FlagSet {
+	if g.flags == nil {
+		g.flags = NewFlagSet(g.path)
+	}
+	return g.flags
+}
+
+// groupFlags returns the flags of the groups containing path, innermost first
+func (d *Dispatcher) groupFlags(path string) []*FlagSet {
+	var sets []*FlagSet
+	parts := strings.Fields(path)
+	for i := len(parts); i > 0; i-- {
+		if g, ok := d.groups[strings.Join(parts[:i], " ")]; ok && g.flags != nil {
+			sets = append(sets, g.flags)
+		}
+	}
+	return sets
+}
+
+// sharedFlags returns the group and global flags merged into the command at path,
+// in order of precedence
+func (d *Dispatcher) sharedFlags(path string) []*FlagSet {
+	sets := d.groupFlags(path)
+	if d.globalFlags != nil {
+		sets = append(sets, d.globalFlags)
+	}
+	return sets
+}
+
+// execution holds the settings for a single run of the dispatcher
+type execution struct {
+	ctx            context.Context
+	out            io.Writer // Destination for help, version, and completion output
+	stdout, stderr io.Writer // Writers passed to OutputWriter commands
+	recoverPanics  bool      // Whether a command panic is returned as *PanicError
+}
+
 // Execute runs the dispatcher with the given arguments
 func (d *Dispatcher) Execute(args []string) error {
+	return d.ExecuteContext(context.Background(), args)
+}
+
+// ExecuteContext is like Execute, but passes ctx to commands implementing ContextRunner
+func (d *Dispatcher) ExecuteContext(ctx context.Context, args []string) error {
+	return d.execute(args, execution{
+		ctx:           ctx,
+		out:           d.output(),
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
+		recoverPanics: d.recoverPanics,
+	})
+}
+
+// ExecuteWith is like Execute, but for this call writes the dispatcher's own
+// output, such as help, version, and completions, to out instead of the writer
+// set with SetOutput. Commands implementing OutputWriter receive out and errOut
+// instead of the process-wide streams. Errors, including unknown commands, are
+// returned rather than printed. Commands that write to os.Stdout directly are
+// not redirected.
+func (d *Dispatcher) ExecuteWith(out, errOut io.Writer, args []string) error {
+	return d.ExecuteWithContext(context.Background(), out, errOut, args)
+}
+
+// ExecuteWithContext is like ExecuteWith, but passes ctx to commands implementing
+// ContextRunner or ContextOutputWriter
+func (d *Dispatcher) ExecuteWithContext(ctx context.Context, out, errOut io.Writer, args []string) error {
+	return d.execute(args, execution{
+		ctx:           ctx,
+		out:           out,
+		stdout:        out,
+		stderr:        errOut,
+		recoverPanics: d.recoverPanics,
+	})
+}
+
+// execute implements Execute with the writers and settings of ex
+func (d *Dispatcher) execute(args []string, ex execution) error {
 	// Check for completion requests first
-	if d.HandleCompletion(args) {
+	if d.handleCompletion(ex.out, args) {
 		return nil
 	}
 
-	if len(args) == 0 {
-		return d.showHelp()
+	if len(args) == 0 && d.defaultCommand == "" {
+		return d.showHelp(ex.out)
+	}
+
+	if d.isVersionRequest(args) {
+		return d.showVersion(ex.out)
 	}
 
 	// Check for help flags anywhere in the arguments, but stop at --
@@ -154,7 +632,7 @@ func (d *Dispatcher) Execute(args []string) error {
 			// Stop processing flags after --
 			break
 		}
-		if arg == "-h" || arg == "--help" || arg == "help" {
+		if d.isHelpArg(arg) {
 			hasHelp = true
 			break
 		}
@@ -177,36 +655,207 @@ func (d *Dispatcher) Execute(args []string) error {
 	}
 
 	if entry == nil {
+		// A prefix of registered commands lists them, with or without help flags
+		if path := d.commandPrefix(args); path != "" {
+			return d.showGroupHelp(ex.out, path)
+		}
 		// No command found, check for help flags
 		if hasHelp {
-			return d.showHelp()
+			return d.showHelp(ex.out)
+		}
+		if d.defaultCommand != "" && (len(args) == 0 || !strings.HasPrefix(args[0], "-")) {
+			entry = d.commands[d.defaultCommand]
+			if entry == nil {
+				return fmt.Errorf("unknown default command: %s", d.defaultCommand)
+			}
+			return d.run(ex, entry, args)
+		}
+		if d.notFound != nil {
+			return d.notFound(args)
+		}
+		if suggestion := d.suggestCommand(args); suggestion != "" {
+			return fmt.Errorf("unknown command: %s. Did you mean: %s?", strings.Join(args, " "), suggestion)
 		}
 		return fmt.Errorf("unknown command: %s", strings.Join(args, " "))
 	}
 
 	// If help is requested, show command-specific help
 	// BUT if the command allows unknown flags and there are other args, don't show help
-	fs := entry.Command.FlagSet()
+	fs := d.commandFlags(entry.Path, entry.Command)
+	if fs != nil && fs.noInterspersed {
+		// Without interspersed flags, a help flag after the first argument is positional
+		hasHelp = false
+		for i := 0; i < len(allArgs); i++ {
+			arg := allArgs[i]
+			if arg == "--" || arg == "-" || !strings.HasPrefix(arg, "-") {
+				break
+			}
+			if d.isHelpArg(arg) {
+				hasHelp = true
+				break
+			}
+			if fs.takesNextArg(arg) {
+				i++
+			}
+		}
+	}
 	shouldShowHelp := hasHelp
 	if fs != nil && fs.allowUnknownFlags && hasOtherArgs {
 		shouldShowHelp = false
 	}
 
 	if shouldShowHelp {
-		return d.showCommandHelp(entry)
+		return d.showCommandHelp(ex.out, entry)
+	}
+
+	return d.run(ex, entry, allArgs)
+}
+
+// run parses args with the command's flags and executes it
+func (d *Dispatcher) run(ex execution, entry *CommandEntry, args []string) (err error) {
+	if ex.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
 	}
 
+	fs := d.commandFlags(entry.Path, entry.Command)
+
 	// Parse flags for this command
 	// Disable automatic help in the FlagSet since the Dispatcher already handled it
 	if fs != nil {
 		fs.disableAutoHelp = true
 	}
-	if err := fs.Parse(allArgs); err != nil {
+	err = fs.Parse(args)
+	syncSharedFlags(fs)
+	if err != nil {
 		return fmt.Errorf("error parsing flags: %w", err)
 	}
 
+	// Wrap the command in middleware, innermost last
+	run := CommandFunc(entry.Command.Run)
+	switch c := entry.Command.(type) {
+	case ContextOutputWriter:
+		run = func(fs *FlagSet, args []string) error {
+			return c.RunContextWithOutput(ex.ctx, fs, args, ex.stdout, ex.stderr)
+		}
+	case OutputWriter:
+		run = func(fs *FlagSet, args []string) error {
+			return c.RunWithOutput(fs, args, ex.stdout, ex.stderr)
+		}
+	case ContextRunner:
+		run = func(fs *FlagSet, args []string) error {
+			return c.RunContext(ex.ctx, fs, args)
+		}
+	}
+	for i := len(d.middleware) - 1; i >= 0; i-- {
+		run = d.middleware[i](run)
+	}
+
 	// Execute the command with the parsed flagset and remaining args
-	return entry.Command.Run(fs, fs.Args())
+	return run(fs, fs.Args())
+}
+
+// commandFlags returns the FlagSet of the command at path with its group and global
+// flags merged in. Merging is repeated on every call so flags defined since the last
+// one are picked up, and it never changes the result of an earlier merge, so every
+// caller sees the same flags no matter which commands have run.
+func (d *Dispatcher) commandFlags(path string, cmd Command) *FlagSet {
+	fs := cmd.FlagSet()
+	if fs != nil {
+		for _, shared := range d.sharedFlags(path) {
+			mergeSharedFlags(fs, shared)
+		}
+	}
+	return fs
+}
+
+// mergeSharedFlags adds a copy of each global or group flag to fs, with the same Value
+// so handlers and the shared FlagSet see what was parsed. A flag whose long name is
+// already defined in fs, following fs's case and name normalization, is skipped; one
+// whose short name alone is taken is added without it. Flags merged by an earlier call
+// are skipped too.
+func mergeSharedFlags(fs *FlagSet, shared *FlagSet) {
+	merged := make(map[*Flag]bool)
+	for _, flag := range fs.allFlags {
+		if flag.origin != nil {
+			merged[flag.origin] = true
+		}
+	}
+
+	for _, flag := range shared.allFlags {
+		if merged[flag] {
+			continue
+		}
+		name := fs.canonicalName(flag.Name)
+		if _, exists := fs.flags[name]; exists && name != "" {
+			continue
+		}
+		short := flag.Short
+		if _, exists := fs.shortMap[short]; exists && short != 0 {
+			if name == "" {
+				continue
+			}
+			short = 0
+		}
+
+		copied := *flag
+		copied.Name = name
+		copied.Short = short
+		copied.origin = flag
+		if name != "" {
+			fs.flags[name] = &copied
+		}
+		if short != 0 {
+			fs.shortMap[short] = &copied
+		}
+		fs.allFlags = append(fs.allFlags, &copied)
+	}
+}
+
+// syncSharedFlags copies the parse state of flags merged into fs back to the global
+// or group flags they came from, so Changed and Source work on the shared FlagSet
+func syncSharedFlags(fs *FlagSet) {
+	if fs == nil {
+		return
+	}
+	for _, flag := range fs.allFlags {
+		if flag.origin != nil {
+			flag.origin.changed = flag.changed
+			flag.origin.envSet = flag.envSet
+			flag.origin.configSet = flag.configSet
+		}
+	}
+}
+
+// ExecuteMap runs the named command with flag and argument values taken from m.
+// See FlagSet.ArgsFromMap for how map entries are converted into arguments.
+// The values are data, not command-line input, so help, version, and completion
+// requests are not recognized in them.
+func (d *Dispatcher) ExecuteMap(name string, m map[string]any) error {
+	entry := d.GetCommandEntry(name)
+	if entry == nil {
+		return fmt.Errorf("unknown command: %s", name)
+	}
+
+	var args []string
+	if fs := d.commandFlags(entry.Path, entry.Command); fs != nil && len(m) > 0 {
+		var err error
+		args, err = fs.ArgsFromMap(m)
+		if err != nil {
+			return fmt.Errorf("error building arguments: %w", err)
+		}
+	}
+
+	return d.run(execution{
+		ctx:           context.Background(),
+		out:           d.output(),
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
+		recoverPanics: d.recoverPanics,
+	}, entry, args)
 }
 
 // Run is an alias for Execute
@@ -297,7 +946,7 @@ func (d *Dispatcher) findCommandWithInterspersedFlags(args []string) (*CommandEn
 		testPath := normalizeCommandPath(strings.Join(commandParts[:j], " "))
 		if entry, ok := d.commands[testPath]; ok {
 			// We found a command! Now build the args for it
-			fs := entry.Command.FlagSet()
+			fs := d.commandFlags(entry.Path, entry.Command)
 
 			// Figure out where the command ends in the original args
 			lastCommandIndex := -1
@@ -342,13 +991,28 @@ func (d *Dispatcher) findCommandWithInterspersedFlags(args []string) (*CommandEn
 					if (len(flagName) == 1 && f.Short == rune(flagName[0])) || f.Name == flagName {
 						flagFound = true
 						// Check if our assumption about the flag taking a value was correct
-						if fi.hasValue && f.Value.IsBool() {
+						if fi.hasValue && (f.Value.IsBool() || f.optional) {
 							valid = false // Bool flags don't take values
 						}
 					}
 				})
 
-				if !flagFound && !isHelpFlag(fi.flag) {
+				// Group and global flags may also appear before the command
+				for _, shared := range d.sharedFlags(entry.Path) {
+					if flagFound {
+						break
+					}
+					shared.VisitAll(func(f *Flag) {
+						if (len(flagName) == 1 && f.Short == rune(flagName[0])) || f.Name == flagName {
+							flagFound = true
+							if fi.hasValue && (f.Value.IsBool() || f.optional) {
+								valid = false
+							}
+						}
+					})
+				}
+
+				if !flagFound && !d.isHelpFlag(fi.flag) {
 					// Unknown flag (unless it's a help flag which is always valid)
 					valid = false
 				}
@@ -364,11 +1028,6 @@ func (d *Dispatcher) findCommandWithInterspersedFlags(args []string) (*CommandEn
 	return nil, args
 }
 
-// isHelpFlag checks if a flag is a help flag
-func isHelpFlag(flag string) bool {
-	return flag == "-h" || flag == "--help"
-}
-
 // normalizeCommandPath normalizes a command path for consistent lookup
 func normalizeCommandPath(path string) string {
 	// Split by spaces, filter empty strings, and rejoin
@@ -376,10 +1035,10 @@ func normalizeCommandPath(path string) string {
 	return strings.Join(parts, " ")
 }
 
-// showHelp displays available commands
-func (d *Dispatcher) showHelp() error {
-	fmt.Printf("Usage: %s <command> [arguments]\n\n", d.name)
-	fmt.Println("Available commands:")
+// showHelp displays available commands on out
+func (d *Dispatcher) showHelp(out io.Writer) error {
+	fmt.Fprintf(out, "Usage: %s <command> [arguments]\n\n", d.name)
+	fmt.Fprintln(out, "Available commands:")
 
 	// Collect and sort command paths
 	var paths []string
@@ -406,80 +1065,202 @@ func (d *Dispatcher) showHelp() error {
 	for _, path := range sortedPaths {
 		entry := d.commands[path]
 		if entry.Usage != "" {
-			fmt.Printf("  %-*s  %s\n", maxLen+2, path, entry.Usage)
+			prefix := fmt.Sprintf("  %-*s  ", maxLen+2, path)
+			printWrapped(out, prefix, len(prefix), entry.Usage, d.width())
+		} else {
+			fmt.Fprintf(out, "  %s\n", path)
+		}
+	}
+
+	d.printGlobalOptions(out)
+
+	d.printHelpHint(out, "")
+	return nil
+}
+
+// commandPrefix returns the path formed by the non-flag arguments before any --
+// if it is a strict prefix of registered commands but not itself registered, or
+// "" otherwise. The help command is ignored.
+func (d *Dispatcher) commandPrefix(args []string) string {
+	var parts []string
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") && !d.isHelpArg(arg) {
+			parts = append(parts, arg)
+		}
+	}
+	path := normalizeCommandPath(strings.Join(parts, " "))
+	if path == "" {
+		return ""
+	}
+	if _, ok := d.commands[path]; ok {
+		return ""
+	}
+	for cmdPath := range d.commands {
+		if strings.HasPrefix(cmdPath, path+" ") {
+			return path
+		}
+	}
+	return ""
+}
+
+// showGroupHelp lists the commands directly under path, a prefix of registered
+// commands that isn't a command itself. Children that only lead to deeper
+// commands are listed with the usage of their group, if any.
+func (d *Dispatcher) showGroupHelp(out io.Writer, path string) error {
+	fmt.Fprintf(out, "Usage: %s %s <command> [arguments]\n", d.name, path)
+	if g, ok := d.groups[path]; ok && g.usage != "" {
+		fmt.Fprintf(out, "\n%s\n", g.usage)
+	}
+	fmt.Fprintln(out, "\nAvailable commands:")
+
+	usages := make(map[string]string)
+	maxLen := 0
+	for cmdPath := range d.commands {
+		rest, ok := strings.CutPrefix(cmdPath, path+" ")
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(rest, " ")
+		childPath := path + " " + name
+		if entry, ok := d.commands[childPath]; ok {
+			usages[name] = entry.Usage
+		} else if g, ok := d.groups[childPath]; ok {
+			usages[name] = g.usage
+		} else {
+			usages[name] = ""
+		}
+		maxLen = max(maxLen, len(name))
+	}
+
+	names := make([]string, 0, len(usages))
+	for name := range usages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if usage := usages[name]; usage != "" {
+			prefix := fmt.Sprintf("  %-*s  ", maxLen+2, name)
+			printWrapped(out, prefix, len(prefix), usage, d.width())
 		} else {
-			fmt.Printf("  %s\n", path)
+			fmt.Fprintf(out, "  %s\n", name)
 		}
 	}
 
-	fmt.Println("\nUse '<command> --help' for more information about a command.")
+	d.printGroupOptions(out, path)
+	d.printGlobalOptions(out)
+
+	d.printHelpHint(out, path)
 	return nil
 }
 
-// showCommandHelp displays help for a specific command
-func (d *Dispatcher) showCommandHelp(entry *CommandEntry) error {
-	fmt.Printf("Usage: %s %s [options]", d.name, entry.Path)
-	fs := entry.Command.FlagSet()
+// printGlobalOptions prints the global flags under a "Global options" heading, if any are defined
+func (d *Dispatcher) printGlobalOptions(out io.Writer) {
+	if d.globalFlags == nil {
+		return
+	}
+	hasFlags := false
+	d.globalFlags.VisitAll(func(flag *Flag) {
+		if !hasFlags {
+			fmt.Fprintln(out, "\nGlobal options:")
+			hasFlags = true
+		}
+		printFlagHelp(out, flag, d.width())
+	})
+}
+
+// printGroupOptions prints the flags of each group containing path under a
+// heading naming the group, innermost group first
+func (d *Dispatcher) printGroupOptions(out io.Writer, path string) {
+	for _, shared := range d.groupFlags(path) {
+		hasFlags := false
+		shared.VisitAll(func(flag *Flag) {
+			if !hasFlags {
+				fmt.Fprintf(out, "\n%s options:\n", shared.name)
+				hasFlags = true
+			}
+			printFlagHelp(out, flag, d.width())
+		})
+	}
+}
+
+// printFlagHelp prints a single flag line for command help, wrapping the usage
+// text to width
+func printFlagHelp(out io.Writer, flag *Flag, width int) {
+	// Format flag display
+	var flagStr string
+	if flag.Short != 0 && flag.Name != "" {
+		flagStr = fmt.Sprintf("  -%c, --%s", flag.Short, flag.Name)
+	} else if flag.Short != 0 {
+		flagStr = fmt.Sprintf("  -%c", flag.Short)
+	} else {
+		flagStr = fmt.Sprintf("      --%s", flag.Name)
+	}
+
+	// Add value placeholder for non-boolean flags
+	if flag.optional {
+		flagStr += fmt.Sprintf("[=<%s>]", flag.Value.Type())
+	} else if !flag.Value.IsBool() {
+		flagStr += fmt.Sprintf(" <%s>", flag.Value.Type())
+	}
+
+	// Print flag with usage
+	if flag.Usage != "" {
+		usage := flag.Usage
+		if def := flag.helpDefault(); def != "" {
+			usage += fmt.Sprintf(" (default: %s)", def)
+		}
+		printWrapped(out, fmt.Sprintf("%-30s ", flagStr), 31, usage, width)
+	} else {
+		fmt.Fprintln(out, flagStr)
+	}
+}
+
+// showCommandHelp displays help for a specific command on out
+func (d *Dispatcher) showCommandHelp(out io.Writer, entry *CommandEntry) error {
+	fmt.Fprintf(out, "Usage: %s %s [options]", d.name, entry.Path)
+	fs := d.commandFlags(entry.Path, entry.Command)
 	if fs != nil {
 		// Check if there are positional arguments expected
 		hasPositional := false
 		if len(fs.posFields) > 0 {
 			hasPositional = true
 		}
-		if fs.restField != nil {
+		if fs.HasRestArgs() {
 			hasPositional = true
 		}
 		if hasPositional {
-			fmt.Print(" [arguments]")
+			fmt.Fprint(out, " [arguments]")
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(out)
 
 	if entry.Usage != "" {
-		fmt.Printf("\n%s\n", entry.Usage)
+		fmt.Fprintf(out, "\n%s\n", entry.Usage)
 	}
 
-	// Show flags if any are defined
+	// Show flags if any are defined, by section. Group and global flags merged
+	// in by an earlier run are listed separately.
 	if fs != nil {
-		hasFlags := false
-		fs.VisitAll(func(flag *Flag) {
-			if !hasFlags {
-				fmt.Println("\nOptions:")
-				hasFlags = true
-			}
-
-			// Format flag display
-			var flagStr string
-			if flag.Short != 0 && flag.Name != "" {
-				flagStr = fmt.Sprintf("  -%c, --%s", flag.Short, flag.Name)
-			} else if flag.Short != 0 {
-				flagStr = fmt.Sprintf("  -%c", flag.Short)
-			} else {
-				flagStr = fmt.Sprintf("      --%s", flag.Name)
-			}
-
-			// Add value placeholder for non-boolean flags
-			if !flag.Value.IsBool() {
-				flagStr += fmt.Sprintf(" <%s>", flag.Value.Type())
-			}
-
-			// Print flag with usage
-			if flag.Usage != "" {
-				fmt.Printf("%-30s %s", flagStr, flag.Usage)
-				if flag.DefValue != "" && flag.DefValue != "false" && flag.DefValue != "0" {
-					fmt.Printf(" (default: %s)", flag.DefValue)
-				}
-				fmt.Println()
-			} else {
-				fmt.Println(flagStr)
+		isShared := func(flag *Flag) bool { return d.isSharedFlag(entry.Path, flag) }
+		fs.visitGrouped(isShared, func(group string, flags []*Flag) {
+			fmt.Fprintf(out, "\n%s:\n", group)
+			for _, flag := range flags {
+				printFlagHelp(out, flag, d.width())
 			}
 		})
 	}
 
+	d.printGroupOptions(out, entry.Path)
+	d.printGlobalOptions(out)
+
 	// Show sub-commands if any exist
 	subCommands := d.getSubCommands(entry.Path)
 	if len(subCommands) > 0 {
-		fmt.Println("\nSub-commands:")
+		fmt.Fprintln(out, "\nSub-commands:")
 
 		// Find the maximum length for alignment
 		maxLen := 0
@@ -496,9 +1277,10 @@ func (d *Dispatcher) showCommandHelp(entry *CommandEntry) error {
 			// Display the sub-command name without the parent prefix
 			subCmdName := strings.TrimPrefix(subCmd.Path, entry.Path+" ")
 			if subCmd.Usage != "" {
-				fmt.Printf("  %-*s  %s\n", maxLen+2, subCmdName, subCmd.Usage)
+				prefix := fmt.Sprintf("  %-*s  ", maxLen+2, subCmdName)
+				printWrapped(out, prefix, len(prefix), subCmd.Usage, d.width())
 			} else {
-				fmt.Printf("  %s\n", subCmdName)
+				fmt.Fprintf(out, "  %s\n", subCmdName)
 			}
 		}
 	}
@@ -568,6 +1350,100 @@ func (d *Dispatcher) Remove(path string) {
 	delete(d.commands, normalizedPath)
 }
 
+// DumpOption configures the output of DumpConfig
+type DumpOption func(*dumpOptions)
+
+type dumpOptions struct {
+	keyValue bool
+	sources  bool
+}
+
+// DumpKeyValue makes DumpConfig write key=value lines in the format read by
+// FlagSet.ParseWithConfig instead of a JSON object
+func DumpKeyValue() DumpOption {
+	return func(o *dumpOptions) { o.keyValue = true }
+}
+
+// DumpSources makes DumpConfig report where each value came from, as reported by
+// FlagSet.Source: "flag", "env", "config", or "default". In JSON each flag maps to
+// an object with "value" and "source" fields; in key=value output each line is
+// preceded by a "# source: <source>" comment.
+func DumpSources() DumpOption {
+	return func(o *dumpOptions) { o.sources = true }
+}
+
+// DumpConfig serializes the effective values of all flags in fs as a JSON object
+// keyed by long flag name (or the short flag when no long name is defined).
+// Values implementing Getter are emitted using their natural JSON types where
+// possible; others use their String form. See DumpKeyValue and DumpSources for
+// other output.
+func (d *Dispatcher) DumpConfig(fs *FlagSet, opts ...DumpOption) ([]byte, error) {
+	var o dumpOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	config := make(map[string]any)
+	var buf bytes.Buffer
+	if fs != nil {
+		fs.VisitAll(func(flag *Flag) {
+			key := flag.Name
+			if key == "" {
+				key = string(flag.Short)
+			}
+			if o.keyValue {
+				if o.sources {
+					fmt.Fprintf(&buf, "# source: %s\n", flag.source())
+				}
+				fmt.Fprintf(&buf, "%s=%s\n", key, configValue(flag.Value.String()))
+				return
+			}
+			value := flagJSONValue(flag.Value)
+			if o.sources {
+				value = map[string]any{"value": value, "source": flag.source().String()}
+			}
+			config[key] = value
+		})
+	}
+	if o.keyValue {
+		return buf.Bytes(), nil
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// configValue quotes a key=value config value if it would not read back as is
+func configValue(v string) string {
+	if v != strings.TrimSpace(v) || strings.HasPrefix(v, `"`) || strings.ContainsAny(v, "\n\r") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// flagJSONValue returns the value of a flag as a JSON-friendly Go value: booleans,
+// numbers, lists, and maps keep their type, while values that have a String form of
+// their own, such as durations and addresses, use the flag's String form
+func flagJSONValue(v Value) any {
+	g, ok := v.(Getter)
+	if !ok {
+		return v.String()
+	}
+	val := g.Get()
+	if val == nil {
+		return nil
+	}
+	if _, ok := val.(fmt.Stringer); ok {
+		return v.String()
+	}
+	switch reflect.ValueOf(val).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64, reflect.Slice, reflect.Map:
+		return val
+	}
+	return v.String()
+}
+
 // GetCommandCompletions returns completions for commands based on the prefix
 func (d *Dispatcher) GetCommandCompletions(prefix string) []Completion {
 	var completions []Completion
@@ -597,10 +1473,15 @@ func (d *Dispatcher) GetCommandCompletions(prefix string) []Completion {
 // HandleCompletion handles shell completion requests for the dispatcher
 // Returns true if a completion request was handled
 func (d *Dispatcher) HandleCompletion(args []string) bool {
+	return d.handleCompletion(d.output(), args)
+}
+
+// handleCompletion implements HandleCompletion, writing completions to out
+func (d *Dispatcher) handleCompletion(out io.Writer, args []string) bool {
 	// Check for bash completion mode
 	if os.Getenv("COMP_LINE") != "" {
 		// We're being called by bash completion
-		d.PrintBashCompletions(args)
+		d.printBashCompletions(out, args)
 		return true
 	}
 
@@ -608,16 +1489,16 @@ func (d *Dispatcher) HandleCompletion(args []string) bool {
 	if len(args) > 0 {
 		switch args[0] {
 		case "--complete-bash":
-			d.PrintBashCompletions(args[1:])
+			d.printBashCompletions(out, args[1:])
 			return true
 		case "--complete-zsh":
-			d.PrintZshCompletions(args[1:])
+			d.printZshCompletions(out, args[1:])
 			return true
 		case "--generate-bash-completion":
-			fmt.Print(d.GenerateBashCompletion())
+			fmt.Fprint(out, d.GenerateBashCompletion())
 			return true
 		case "--generate-zsh-completion":
-			fmt.Print(d.GenerateZshCompletion())
+			fmt.Fprint(out, d.GenerateZshCompletion())
 			return true
 		}
 	}
@@ -627,13 +1508,16 @@ func (d *Dispatcher) HandleCompletion(args []string) bool {
 
 // PrintBashCompletions outputs completions in bash format
 func (d *Dispatcher) PrintBashCompletions(args []string) {
+	d.printBashCompletions(d.output(), args)
+}
+
+// printBashCompletions implements PrintBashCompletions, writing to out
+func (d *Dispatcher) printBashCompletions(out io.Writer, args []string) {
 	// Determine what we're completing
 	if len(args) == 0 {
 		// Complete commands
 		completions := d.GetCommandCompletions("")
-		for _, comp := range completions {
-			fmt.Println(comp.Value)
-		}
+		printBashCompletions(out, completions, DirectiveDefault)
 		return
 	}
 
@@ -650,93 +1534,62 @@ func (d *Dispatcher) PrintBashCompletions(args []string) {
 		// No exact command match, show command completions
 		prefix := strings.Join(args, " ")
 		completions := d.GetCommandCompletions(prefix)
-		for _, comp := range completions {
-			fmt.Println(comp.Value)
-		}
+		printBashCompletions(out, completions, DirectiveDefault)
 	} else {
 		// We have a command, complete its flags
-		fs := entry.Command.FlagSet()
+		fs := d.commandFlags(entry.Path, entry.Command)
 		if fs != nil {
 			// Check if we need to complete a flag value
 			if len(remainingArgs) >= 2 {
-				prevArg := remainingArgs[len(remainingArgs)-2]
-				if strings.HasPrefix(prevArg, "-") {
-					// Check if previous arg was a flag that needs a value
-					flagName := strings.TrimLeft(prevArg, "-")
-
-					// Check long flags
-					if flag, ok := fs.flags[flagName]; ok && !flag.Value.IsBool() {
-						// We're completing a value for this flag
-						return
-					}
-
-					// Check short flags
-					if len(prevArg) == 2 {
-						if flag, ok := fs.shortMap[rune(prevArg[1])]; ok && !flag.Value.IsBool() {
-							// We're completing a value for this flag
-							return
-						}
-					}
+				if flag := fs.valueFlag(remainingArgs[len(remainingArgs)-2]); flag != nil {
+					// We're completing a value for this flag
+					printBashCompletions(out, valueCompletions(flag, currentWord), flag.directive)
+					return
 				}
 			}
 
 			// Get flag completions
 			completions := fs.GetFlagCompletions(currentWord)
-			for _, comp := range completions {
-				fmt.Println(comp.Value)
-			}
+			printBashCompletions(out, completions, DirectiveDefault)
 		}
 	}
 }
 
 // PrintZshCompletions outputs completions in zsh format
 func (d *Dispatcher) PrintZshCompletions(args []string) {
-	// Get all command completions
-	commandCompletions := d.GetCommandCompletions("")
+	d.printZshCompletions(d.output(), args)
+}
 
-	// Print command completions
-	for _, comp := range commandCompletions {
-		if comp.Description != "" {
-			fmt.Printf("%s:%s\n", comp.Value, comp.Description)
-		} else {
-			fmt.Println(comp.Value)
-		}
+// printZshCompletions implements PrintZshCompletions, writing to out
+func (d *Dispatcher) printZshCompletions(out io.Writer, args []string) {
+	entry, remainingArgs := d.findCommand(args)
+	if entry == nil {
+		// No exact command match, show command completions
+		printZshCompletions(out, d.GetCommandCompletions(strings.Join(args, " ")), DirectiveDefault)
+		return
 	}
 
-	// If we have a specific command, also show its flags
+	// We have a command, complete its flags or the value of one
+	fs := d.commandFlags(entry.Path, entry.Command)
+	if fs == nil {
+		return
+	}
+	currentWord := ""
 	if len(args) > 0 {
-		entry, _ := d.findCommand(args)
-		if entry != nil {
-			fs := entry.Command.FlagSet()
-			if fs != nil {
-				flagCompletions := fs.GetFlagCompletions("")
-				for _, comp := range flagCompletions {
-					if comp.Description != "" {
-						fmt.Printf("%s:%s\n", comp.Value, comp.Description)
-					} else {
-						fmt.Println(comp.Value)
-					}
-				}
-			}
+		currentWord = args[len(args)-1]
+	}
+	if len(remainingArgs) >= 2 {
+		if flag := fs.valueFlag(remainingArgs[len(remainingArgs)-2]); flag != nil {
+			printZshCompletions(out, valueCompletions(flag, currentWord), flag.directive)
+			return
 		}
 	}
+	printZshCompletions(out, fs.GetFlagCompletions(currentWord), DirectiveDefault)
 }
 
 // GenerateBashCompletion generates a bash completion script for the dispatcher
 func (d *Dispatcher) GenerateBashCompletion() string {
-	var sb strings.Builder
-
-	sb.WriteString(fmt.Sprintf("# Bash completion for %s\n", d.name))
-	sb.WriteString(fmt.Sprintf("_%s_completion() {\n", d.name))
-	sb.WriteString("    local cur prev words cword\n")
-	sb.WriteString("    _init_completion || return\n\n")
-	sb.WriteString("    # Get completions from the program\n")
-	sb.WriteString(fmt.Sprintf("    local completions=$(%s --complete-bash \"${COMP_WORDS[@]:1:$COMP_CWORD}\")\n", d.name))
-	sb.WriteString("    COMPREPLY=( $(compgen -W \"$completions\" -- \"$cur\") )\n")
-	sb.WriteString("}\n\n")
-	sb.WriteString(fmt.Sprintf("complete -F _%s_completion %s\n", d.name, d.name))
-
-	return sb.String()
+	return bashCompletionScript(d.name)
 }
 
 // GenerateZshCompletion generates a zsh completion script for the dispatcher
@@ -748,22 +1601,21 @@ func (d *Dispatcher) GenerateZshCompletion() string {
 	sb.WriteString("    local -a commands\n")
 	sb.WriteString("    commands=(\n")
 
-	// Add all commands with descriptions
-	for path, entry := range d.commands {
-		desc := strings.ReplaceAll(entry.Usage, "'", "'\"'\"'")
+	// Add all commands with descriptions, sorted by path
+	for _, comp := range d.GetCommandCompletions("") {
+		desc := strings.ReplaceAll(comp.Description, "'", "'\"'\"'")
 		if desc != "" {
-			sb.WriteString(fmt.Sprintf("        '%s[%s]'\n", path, desc))
+			sb.WriteString(fmt.Sprintf("        '%s[%s]'\n", comp.Value, desc))
 		} else {
-			sb.WriteString(fmt.Sprintf("        '%s'\n", path))
+			sb.WriteString(fmt.Sprintf("        '%s'\n", comp.Value))
 		}
 	}
 
 	sb.WriteString("    )\n\n")
-	sb.WriteString("    # If we have a command, complete its flags\n")
+	sb.WriteString("    # Past the command name, ask the program for flags and values\n")
 	sb.WriteString("    if (( CURRENT > 2 )); then\n")
-	sb.WriteString("        # Get the command\n")
-	sb.WriteString("        local cmd=\"${words[2]}\"\n")
-	sb.WriteString("        # TODO: Add flag completion for specific commands\n")
+	zshDynamicCompletion(&sb, d.name, "        ")
+	sb.WriteString("        return\n")
 	sb.WriteString("    fi\n\n")
 	sb.WriteString("    _describe 'command' commands\n")
 	sb.WriteString("}\n\n")
@@ -771,3 +1623,68 @@ func (d *Dispatcher) GenerateZshCompletion() string {
 
 	return sb.String()
 }
+
+// suggestCommand returns the registered command path closest to the command words in args,
+// or "" if none is within the suggestion threshold. Each path is compared against the same
+// number of leading words, so typos in any part of a multi-word command are found.
+func (d *Dispatcher) suggestCommand(args []string) string {
+	if d.suggestionThreshold <= 0 {
+		return ""
+	}
+
+	var words []string
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			words = append(words, arg)
+		}
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	best := ""
+	bestDist := d.suggestionThreshold + 1
+	for path := range d.commands {
+		n := len(strings.Fields(path))
+		if n > len(words) {
+			n = len(words)
+		}
+		dist := levenshtein(strings.Join(words[:n], " "), path)
+		if dist < bestDist || (dist == bestDist && path < best) {
+			best = path
+			bestDist = dist
+		}
+	}
+
+	if bestDist > d.suggestionThreshold {
+		return ""
+	}
+	return best
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(br)]
+}
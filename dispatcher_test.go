@@ -2,10 +2,16 @@ package mflags
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -196,6 +202,42 @@ func TestDispatcherCommandHelp(t *testing.T) {
 	assert.Contains(t, output, "verbose output")
 }
 
+func TestDispatcherSetOutput(t *testing.T) {
+	d := NewDispatcher("myapp")
+
+	fs := NewFlagSet("build")
+	fs.Bool("verbose", 'v', false, "verbose output")
+
+	d.Dispatch("build", NewCommand(fs,
+		func(flags *FlagSet, args []string) error { return nil },
+		WithUsage("Build the project")))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+
+	// General help
+	err := d.Execute([]string{"help"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Available commands:")
+	assert.Contains(t, buf.String(), "Build the project")
+
+	// Command help
+	buf.Reset()
+	err = d.Execute([]string{"build", "--help"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Usage: myapp build")
+	assert.Contains(t, buf.String(), "-v, --verbose")
+
+	// Completions
+	buf.Reset()
+	d.PrintBashCompletions([]string{"bu"})
+	assert.Equal(t, "build\n", buf.String())
+
+	buf.Reset()
+	d.PrintZshCompletions(nil)
+	assert.Equal(t, "build:Build the project\n", buf.String())
+}
+
 func TestDispatcherErrorHandling(t *testing.T) {
 	d := NewDispatcher("myapp")
 
@@ -574,6 +616,43 @@ func TestDispatcherGenerateCompletionScripts(t *testing.T) {
 	assert.Contains(t, zshScript, "#compdef myapp")
 	assert.Contains(t, zshScript, "_myapp()")
 	assert.Contains(t, zshScript, "build[Build the project]")
+	assert.Contains(t, zshScript, "myapp --complete-zsh")
+	assert.Contains(t, zshScript, "_files -/")
+	assert.Contains(t, zshScript, "nospace=( -S '' )")
+	assert.NotContains(t, zshScript, "TODO")
+}
+
+func TestDispatcherZshCompletions(t *testing.T) {
+	d := NewDispatcher("myapp")
+	fs := NewFlagSet("deploy")
+	fs.String("config", 'c', "", "config file")
+	fs.String("region", 0, "", "region")
+	fs.SetCompletionDirective("config", DirectiveFiles)
+	fs.SetCompletionFunc("region", func(prefix string) []string {
+		return []string{"us:east", "us:west"}
+	})
+	fs.SetCompletionDirective("region", DirectiveNoFileComp)
+	d.Dispatch("deploy", NewCommand(fs, func(fs *FlagSet, args []string) error { return nil },
+		WithUsage("Deploy the app")))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+
+	d.PrintZshCompletions([]string{"dep"})
+	assert.Equal(t, "deploy:Deploy the app\n", buf.String())
+
+	buf.Reset()
+	d.PrintZshCompletions([]string{"deploy", "--con"})
+	assert.Equal(t, "--config:config file\n", buf.String())
+
+	buf.Reset()
+	d.PrintZshCompletions([]string{"deploy", "--config", ""})
+	assert.Equal(t, ":4\n", buf.String())
+
+	// Colons in values are escaped for _describe
+	buf.Reset()
+	d.PrintZshCompletions([]string{"deploy", "--region", ""})
+	assert.Equal(t, "us\\:east\nus\\:west\n:2\n", buf.String())
 }
 
 func TestDispatcherHelpWithInterspersedFlags(t *testing.T) {
@@ -935,6 +1014,37 @@ func TestDispatcherHelpAfterDoubleHyphen(t *testing.T) {
 	assert.False(t, executed, "Command should not execute when help is requested")
 }
 
+func TestDispatcherHelpWithoutInterspersed(t *testing.T) {
+	d := NewDispatcher("myapp")
+
+	fs := NewFlagSet("exec")
+	fs.SetInterspersed(false)
+	fs.String("container", 'c', "", "container name")
+
+	var executed bool
+	var capturedArgs []string
+
+	cmd := NewCommand(fs, func(flags *FlagSet, args []string) error {
+		executed = true
+		capturedArgs = args
+		return nil
+	}, WithUsage("Run in a pod"))
+
+	d.Dispatch("exec", cmd)
+
+	err := d.Execute([]string{"exec", "pod", "ls", "-h"})
+	assert.NoError(t, err)
+	assert.True(t, executed, "-h after the first argument belongs to the command")
+	assert.Equal(t, []string{"pod", "ls", "-h"}, capturedArgs)
+
+	executed = false
+	var out bytes.Buffer
+	err = d.ExecuteWith(&out, &out, []string{"exec", "-c", "app", "--help"})
+	assert.NoError(t, err)
+	assert.False(t, executed, "Command should not execute when help is requested")
+	assert.Contains(t, out.String(), "Usage:")
+}
+
 func TestDispatcherHelpWithAllowUnknownFlags(t *testing.T) {
 	d := NewDispatcher("myapp")
 
@@ -1032,3 +1142,929 @@ func TestDispatcherHelpWithAllowUnknownFlags(t *testing.T) {
 		assert.Contains(t, buf.String(), "Usage:")
 	})
 }
+
+func TestDispatcherDumpConfig(t *testing.T) {
+	d := NewDispatcher("myapp")
+
+	fs := NewFlagSet("deploy")
+	fs.Bool("verbose", 'v', false, "verbose output")
+	fs.String("env", 'e', "dev", "target environment")
+	fs.Int("replicas", 0, 1, "replica count")
+	fs.StringArray("tags", 0, nil, "tags")
+	fs.Duration("timeout", 0, 30*time.Second, "timeout")
+	fs.Bool("", 'q', false, "quiet")
+
+	err := fs.Parse([]string{"-v", "--replicas", "3", "--tags", "a,b"})
+	assert.NoError(t, err)
+
+	data, err := d.DumpConfig(fs)
+	assert.NoError(t, err)
+
+	var config map[string]any
+	assert.NoError(t, json.Unmarshal(data, &config))
+	assert.Equal(t, true, config["verbose"])
+	assert.Equal(t, "dev", config["env"])
+	assert.Equal(t, float64(3), config["replicas"])
+	assert.Equal(t, []any{"a", "b"}, config["tags"])
+	assert.Equal(t, "30s", config["timeout"])
+	assert.Equal(t, false, config["q"])
+}
+
+func TestDispatcherDumpConfigSources(t *testing.T) {
+	d := NewDispatcher("myapp")
+
+	fs := NewFlagSet("deploy")
+	fs.String("env", 0, "dev", "target environment")
+	fs.Int("replicas", 0, 1, "replica count")
+	fs.String("note", 0, "", "note")
+	fs.StringMap("labels", 0, "labels")
+	fs.IP("bind", 0, net.IPv4(127, 0, 0, 1), "bind address")
+	fs.SetEnv("env", "TEST_DUMP_ENV")
+	t.Setenv("TEST_DUMP_ENV", "prod")
+
+	err := fs.Parse([]string{"--replicas", "3", "--note", " padded ", "--labels", "a=b"})
+	assert.NoError(t, err)
+
+	data, err := d.DumpConfig(fs, DumpSources())
+	assert.NoError(t, err)
+
+	var config map[string]map[string]any
+	assert.NoError(t, json.Unmarshal(data, &config))
+	assert.Equal(t, map[string]any{"value": "prod", "source": "env"}, config["env"])
+	assert.Equal(t, map[string]any{"value": float64(3), "source": "flag"}, config["replicas"])
+	assert.Equal(t, map[string]any{"value": map[string]any{"a": "b"}, "source": "flag"}, config["labels"])
+	assert.Equal(t, map[string]any{"value": "127.0.0.1", "source": "default"}, config["bind"])
+
+	data, err = d.DumpConfig(fs, DumpKeyValue())
+	assert.NoError(t, err)
+	assert.Equal(t, "bind=127.0.0.1\nenv=prod\nlabels=a=b\nnote=\" padded \"\nreplicas=3\n", string(data))
+
+	data, err = d.DumpConfig(fs, DumpKeyValue(), DumpSources())
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "# source: default\nbind=127.0.0.1\n# source: env\nenv=prod\n"))
+
+	// Key=value output reads back as a config file
+	path := t.TempDir() + "/deploy.conf"
+	data, err = d.DumpConfig(fs, DumpKeyValue())
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+	fs.SetEnv("env", "")
+	err = fs.ParseWithConfig(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, " padded ", fs.Lookup("note").Value.String())
+	assert.Equal(t, SourceConfig, fs.Source("replicas"))
+}
+
+func TestDispatcherBashCompletionMultiWordCommands(t *testing.T) {
+	d := NewDispatcher("myapp")
+	d.Dispatch("test unit", NewCommand(NewFlagSet("unit"),
+		func(fs *FlagSet, args []string) error { return nil }))
+	d.Dispatch("test integration", NewCommand(NewFlagSet("integration"),
+		func(fs *FlagSet, args []string) error { return nil }))
+
+	// The generated script must split completions on newlines only
+	script := d.GenerateBashCompletion()
+	assert.Contains(t, script, "local IFS=$'\\n'")
+
+	// Capture stdout
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	d.PrintBashCompletions([]string{"test"})
+
+	w.Close()
+	os.Stdout = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	// Splitting on newlines, as the script does, keeps each command path intact
+	candidates := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{"test integration", "test unit"}, candidates)
+}
+
+func TestDispatcherExecuteMap(t *testing.T) {
+	d := NewDispatcher("myapp")
+
+	var gotName string
+	var gotArgs []string
+	fs := NewFlagSet("greet")
+	name := fs.String("name", 'n', "", "name to greet")
+	d.Dispatch("say hello", NewCommand(fs, func(fs *FlagSet, args []string) error {
+		gotName = *name
+		gotArgs = args
+		return nil
+	}))
+
+	err := d.ExecuteMap("say hello", map[string]any{
+		"name":      "world",
+		"arguments": []any{"a", "b"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "world", gotName)
+	assert.Equal(t, []string{"a", "b"}, gotArgs)
+
+	err = d.ExecuteMap("missing", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown command")
+
+	err = d.ExecuteMap("say hello", map[string]any{"bogus": 1})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	// Values that look like help or version requests are passed to the command
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+	d.SetVersion("1.0.0")
+	err = d.ExecuteMap("say hello", map[string]any{
+		"name":      "help",
+		"arguments": []any{"-h", "--version"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "help", gotName)
+	assert.Equal(t, []string{"-h", "--version"}, gotArgs)
+
+	err = d.ExecuteMap("say hello", map[string]any{"name": "-h"})
+	assert.NoError(t, err)
+	assert.Equal(t, "-h", gotName)
+	assert.Empty(t, buf.String())
+}
+
+func TestDispatcherSuggestions(t *testing.T) {
+	noop := func(fs *FlagSet, args []string) error { return nil }
+
+	d := NewDispatcher("myapp")
+	d.Dispatch("build", NewCommand(NewFlagSet("build"), noop))
+	d.Dispatch("test", NewCommand(NewFlagSet("test"), noop))
+	d.Dispatch("remote add", NewCommand(NewFlagSet("remote add"), noop))
+	d.Dispatch("remote remove", NewCommand(NewFlagSet("remote remove"), noop))
+
+	err := d.Execute([]string{"biuld"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown command: biuld")
+	assert.Contains(t, err.Error(), "Did you mean: build?")
+
+	err = d.Execute([]string{"remote", "ad", "origin"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Did you mean: remote add?")
+
+	err = d.Execute([]string{"deploy"})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "Did you mean")
+
+	d.SetSuggestionThreshold(0)
+	err = d.Execute([]string{"biuld"})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "Did you mean")
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("build", "build"))
+	assert.Equal(t, 1, levenshtein("buld", "build"))
+	assert.Equal(t, 2, levenshtein("biuld", "build"))
+	assert.Equal(t, 3, levenshtein("", "abc"))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+}
+
+func TestDispatcherDefaultCommand(t *testing.T) {
+	var ran string
+	var gotArgs []string
+
+	d := NewDispatcher("mytool")
+
+	runFS := NewFlagSet("run")
+	verbose := runFS.Bool("verbose", 'v', false, "verbose output")
+	d.Dispatch("run", NewCommand(runFS, func(fs *FlagSet, args []string) error {
+		ran = "run"
+		gotArgs = args
+		return nil
+	}))
+	d.Dispatch("version", NewCommand(NewFlagSet("version"), func(fs *FlagSet, args []string) error {
+		ran = "version"
+		return nil
+	}))
+	d.SetDefaultCommand("run")
+
+	// Unmatched args fall through to the default command
+	err := d.Execute([]string{"script.txt", "-v"})
+	assert.NoError(t, err)
+	assert.Equal(t, "run", ran)
+	assert.Equal(t, []string{"script.txt"}, gotArgs)
+	assert.True(t, *verbose)
+
+	// Registered commands still take priority
+	err = d.Execute([]string{"version"})
+	assert.NoError(t, err)
+	assert.Equal(t, "version", ran)
+
+	// Bare invocation runs the default command
+	ran = ""
+	err = d.Execute([]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "run", ran)
+	assert.Empty(t, gotArgs)
+
+	// Leading flags don't fall through
+	ran = ""
+	err = d.Execute([]string{"--unknown"})
+	assert.Error(t, err)
+	assert.Empty(t, ran)
+
+	// Help still shows the general help
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+	ran = ""
+	err = d.Execute([]string{"--help"})
+	assert.NoError(t, err)
+	assert.Empty(t, ran)
+	assert.Contains(t, buf.String(), "Available commands:")
+}
+
+func TestDispatcherGlobalFlags(t *testing.T) {
+	d := NewDispatcher("myapp")
+	config := d.GlobalFlags().String("config", 'c', "app.yaml", "config file")
+	debug := d.GlobalFlags().Bool("debug", 0, false, "debug output")
+	d.GlobalFlags().String("output", 'o', "text", "global output format")
+
+	var gotConfig string
+	deployFS := NewFlagSet("deploy")
+	output := deployFS.String("output", 'o', "json", "deploy output")
+	d.Dispatch("deploy", NewCommand(deployFS, func(fs *FlagSet, args []string) error {
+		gotConfig = fs.Lookup("config").Value.String()
+		return nil
+	}, WithUsage("Deploy the app")))
+
+	// Global flags after the command
+	err := d.Execute([]string{"deploy", "--config", "prod.yaml", "--debug"})
+	assert.NoError(t, err)
+	assert.Equal(t, "prod.yaml", *config)
+	assert.Equal(t, "prod.yaml", gotConfig)
+	assert.True(t, *debug)
+
+	// Global flags before the command
+	err = d.Execute([]string{"-c", "staging.yaml", "deploy"})
+	assert.NoError(t, err)
+	assert.Equal(t, "staging.yaml", gotConfig)
+
+	// Command flags take precedence on collisions
+	err = d.Execute([]string{"deploy", "-o", "yaml"})
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml", *output)
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+
+	err = d.Execute([]string{"help"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Global options:")
+	assert.Contains(t, buf.String(), "--config <string>")
+
+	buf.Reset()
+	err = d.Execute([]string{"deploy", "--help"})
+	assert.NoError(t, err)
+	help := buf.String()
+	options := help[strings.Index(help, "Options:"):strings.Index(help, "Global options:")]
+	assert.Contains(t, options, "deploy output")
+	assert.NotContains(t, options, "--config")
+	assert.Contains(t, help[strings.Index(help, "Global options:"):], "--config <string>")
+}
+
+func TestDispatcherGlobalFlagsMerge(t *testing.T) {
+	d := NewDispatcher("myapp")
+	verbose := d.GlobalFlags().Bool("verbose", 'v', false, "verbose output")
+	d.GlobalFlags().String("log_level", 0, "info", "log level")
+
+	deployFS := NewFlagSet("deploy")
+	deployFS.SetFlagNormalizer(UnderscoreToHyphen)
+	deployFS.SetCaseInsensitive(true)
+	deployFS.String("version", 'v', "", "version to deploy")
+	d.Dispatch("deploy", NewCommand(deployFS, func(fs *FlagSet, args []string) error {
+		return nil
+	}))
+
+	// Global flags are part of the command before anything runs
+	entry := d.GetCommandEntry("deploy")
+	schema := d.commandFlags(entry.Path, entry.Command).JSONSchema()
+	assert.Contains(t, schema.Properties, "verbose")
+	assert.Contains(t, schema.Properties, "log-level")
+
+	// Merged names follow the command's normalizer and case insensitivity
+	err := d.Execute([]string{"deploy", "--LOG-LEVEL", "debug", "--verbose"})
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, "debug", d.GlobalFlags().Lookup("log_level").Value.String())
+
+	// A short name collision keeps the global flag's long name
+	err = d.Execute([]string{"deploy", "-v", "1.2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.2", deployFS.Lookup("version").Value.String())
+	assert.NotNil(t, deployFS.Lookup("verbose"))
+
+	// The global FlagSet reports how the last command set its flags
+	assert.False(t, d.GlobalFlags().Changed("verbose"))
+	err = d.Execute([]string{"deploy", "--verbose"})
+	assert.NoError(t, err)
+	assert.True(t, d.GlobalFlags().Changed("verbose"))
+	assert.Equal(t, SourceFlag, d.GlobalFlags().Source("verbose"))
+	assert.Equal(t, SourceDefault, d.GlobalFlags().Source("log_level"))
+}
+
+func TestDispatcherMiddleware(t *testing.T) {
+	var calls []string
+
+	d := NewDispatcher("myapp")
+	d.Dispatch("build", NewCommand(NewFlagSet("build"), func(fs *FlagSet, args []string) error {
+		calls = append(calls, "build")
+		return nil
+	}))
+
+	trace := func(name string) Middleware {
+		return func(next CommandFunc) CommandFunc {
+			return func(fs *FlagSet, args []string) error {
+				calls = append(calls, name+" before")
+				err := next(fs, args)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	d.Use(trace("outer"))
+	d.Use(trace("inner"))
+
+	err := d.Execute([]string{"build"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer before", "inner before", "build", "inner after", "outer after"}, calls)
+
+	// Middleware can short-circuit the command
+	calls = nil
+	d.Use(func(next CommandFunc) CommandFunc {
+		return func(fs *FlagSet, args []string) error {
+			return fmt.Errorf("not authorized")
+		}
+	})
+	err = d.Execute([]string{"build"})
+	assert.EqualError(t, err, "not authorized")
+	assert.NotContains(t, calls, "build")
+}
+
+func TestDispatcherVersion(t *testing.T) {
+	d := NewDispatcher("myapp")
+	d.Dispatch("build", NewCommand(NewFlagSet("build"),
+		func(fs *FlagSet, args []string) error { return nil }))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+
+	// Without a version, "version" is just an unknown command
+	err := d.Execute([]string{"version"})
+	assert.Error(t, err)
+
+	d.SetVersion("1.2.3\ncommit: abc123\nbuilt: 2024-01-01\n")
+
+	for _, args := range [][]string{{"version"}, {"--version"}, {"-V"}} {
+		buf.Reset()
+		err := d.Execute(args)
+		assert.NoError(t, err, "args: %v", args)
+		assert.Equal(t, "1.2.3\ncommit: abc123\nbuilt: 2024-01-01\n", buf.String(), "args: %v", args)
+	}
+
+	// A registered version command takes precedence
+	ran := false
+	d.Dispatch("version", NewCommand(NewFlagSet("version"), func(fs *FlagSet, args []string) error {
+		ran = true
+		return nil
+	}))
+	buf.Reset()
+	err = d.Execute([]string{"version"})
+	assert.NoError(t, err)
+	assert.True(t, ran)
+	assert.Empty(t, buf.String())
+}
+
+// writerCommand is a Command that writes its output through OutputWriter
+type writerCommand struct {
+	fs  *FlagSet
+	ran bool
+}
+
+func (c *writerCommand) FlagSet() *FlagSet { return c.fs }
+func (c *writerCommand) Usage() string     { return "write a greeting" }
+
+func (c *writerCommand) Run(fs *FlagSet, args []string) error {
+	c.ran = true
+	return nil
+}
+
+func (c *writerCommand) RunWithOutput(fs *FlagSet, args []string, stdout, stderr io.Writer) error {
+	fmt.Fprintf(stdout, "hello %s", strings.Join(args, " "))
+	fmt.Fprint(stderr, "done")
+	return nil
+}
+
+func TestDispatcherOutputWriter(t *testing.T) {
+	d := NewDispatcher("test")
+	cmd := &writerCommand{fs: NewFlagSet("greet")}
+	d.Dispatch("greet", cmd)
+
+	var stdout, stderr bytes.Buffer
+	err := d.ExecuteWith(&stdout, &stderr, []string{"greet", "world"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", stdout.String())
+	assert.Equal(t, "done", stderr.String())
+	assert.False(t, cmd.ran, "Run should not be called for an OutputWriter")
+
+	// Middleware still wraps OutputWriter commands
+	var called bool
+	d.Use(func(next CommandFunc) CommandFunc {
+		return func(fs *FlagSet, args []string) error {
+			called = true
+			return next(fs, args)
+		}
+	})
+	stdout.Reset()
+	err = d.ExecuteWith(&stdout, &stderr, []string{"greet", "again"})
+	assert.NoError(t, err)
+	assert.True(t, called)
+	assert.Equal(t, "hello again", stdout.String())
+}
+
+// contextWriterCommand receives both a context and writers through ContextOutputWriter
+type contextWriterCommand struct {
+	writerCommand
+	ctx context.Context
+}
+
+func (c *contextWriterCommand) RunContextWithOutput(ctx context.Context, fs *FlagSet, args []string, stdout, stderr io.Writer) error {
+	c.ctx = ctx
+	return c.RunWithOutput(fs, args, stdout, stderr)
+}
+
+func TestDispatcherContextOutputWriter(t *testing.T) {
+	type ctxKey struct{}
+
+	d := NewDispatcher("test")
+	cmd := &contextWriterCommand{writerCommand: writerCommand{fs: NewFlagSet("greet")}}
+	d.Dispatch("greet", cmd)
+
+	// Redirected output and the caller's context reach the command together
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	var stdout, stderr bytes.Buffer
+	err := d.ExecuteWithContext(ctx, &stdout, &stderr, []string{"greet", "world"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", stdout.String())
+	assert.Equal(t, "done", stderr.String())
+	if assert.NotNil(t, cmd.ctx) {
+		assert.Equal(t, "value", cmd.ctx.Value(ctxKey{}))
+	}
+	assert.False(t, cmd.ran)
+}
+
+func TestDispatcherHelpFlagGroups(t *testing.T) {
+	type serveConfig struct {
+		Host    string `long:"host" group:"Network options" usage:"listen host"`
+		Port    int    `long:"port" group:"Network options" usage:"listen port"`
+		Format  string `long:"format" group:"Output options" usage:"output format"`
+		Verbose bool   `long:"verbose" usage:"verbose output"`
+		Debug   bool   `long:"debug" usage:"debug output"`
+	}
+
+	fs := NewFlagSet("serve")
+	err := fs.FromStruct(&serveConfig{})
+	assert.NoError(t, err)
+
+	d := NewDispatcher("myapp")
+	d.Dispatch("serve", NewCommand(fs, nil))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+	err = d.Execute([]string{"serve", "--help"})
+	assert.NoError(t, err)
+
+	output := buf.String()
+	options := strings.Index(output, "\nOptions:\n")
+	network := strings.Index(output, "\nNetwork options:\n")
+	outputOpts := strings.Index(output, "\nOutput options:\n")
+	assert.True(t, options >= 0 && options < network && network < outputOpts, output)
+
+	// Within a section, flags keep alphabetical order
+	assert.Less(t, strings.Index(output, "--debug"), strings.Index(output, "--verbose"))
+	assert.Less(t, strings.Index(output, "--verbose"), network)
+	assert.Less(t, network, strings.Index(output, "--host"))
+	assert.Less(t, strings.Index(output, "--host"), strings.Index(output, "--port"))
+	assert.Less(t, outputOpts, strings.Index(output, "--format"))
+
+	// Moving the last flag out of a section drops its heading
+	fs.SetFlagGroup("format", "")
+	buf.Reset()
+	err = d.Execute([]string{"serve", "--help"})
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "Output options:")
+}
+
+func TestDispatcherHelpWrapping(t *testing.T) {
+	fs := NewFlagSet("sync")
+	fs.String("dest", 'd', "", "destination directory that receives the synchronized files from every configured source")
+
+	d := NewDispatcher("myapp")
+	d.SetHelpWidth(60)
+	d.Dispatch("sync", NewCommand(fs, nil,
+		WithUsage("synchronize files between the configured sources and destinations")))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+	err := d.Execute([]string{"sync", "--help"})
+	assert.NoError(t, err)
+
+	assert.Contains(t, buf.String(), ""+
+		"  -d, --dest <string>          destination directory that\n"+
+		"                               receives the synchronized\n"+
+		"                               files from every configured\n"+
+		"                               source\n")
+
+	buf.Reset()
+	err = d.Execute(nil)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), ""+
+		"  sync    synchronize files between the configured sources\n"+
+		"          and destinations\n")
+
+	// Every line fits within the width
+	for _, line := range strings.Split(buf.String(), "\n") {
+		assert.LessOrEqual(t, len(line), 60, line)
+	}
+}
+
+func TestTerminalWidth(t *testing.T) {
+	saved := terminalSize
+	defer func() { terminalSize = saved }()
+	terminalSize = func() (int, bool) { return 0, false }
+
+	t.Setenv("COLUMNS", "120")
+	assert.Equal(t, 120, terminalWidth())
+
+	t.Setenv("COLUMNS", "")
+	assert.Equal(t, defaultHelpWidth, terminalWidth())
+
+	// The terminal size takes precedence over COLUMNS
+	terminalSize = func() (int, bool) { return 100, true }
+	t.Setenv("COLUMNS", "120")
+	assert.Equal(t, 100, terminalWidth())
+}
+
+func TestPrintWrapped(t *testing.T) {
+	var buf bytes.Buffer
+
+	// Width is measured in runes, not bytes
+	printWrapped(&buf, "  ", 2, "ééééé ééééé ééééé ééééé ééééé ééééé", 24)
+	assert.Equal(t, ""+
+		"  ééééé ééééé ééééé\n"+
+		"  ééééé ééééé ééééé\n", buf.String())
+
+	// Each line of a multi-line text is wrapped separately
+	buf.Reset()
+	printWrapped(&buf, "cmd  ", 5, "the first paragraph, which wraps\n\nsecond one", 30)
+	assert.Equal(t, ""+
+		"cmd  the first paragraph,\n"+
+		"     which wraps\n"+
+		"\n"+
+		"     second one\n", buf.String())
+}
+
+func TestDispatcherHelpDefaults(t *testing.T) {
+	type runConfig struct {
+		Timeout time.Duration `long:"timeout" default:"30s" usage:"request timeout"`
+		Wait    time.Duration `long:"wait" usage:"wait between attempts"`
+		Tags    []string      `long:"tags" default:"tag1,tag2" usage:"tags to apply"`
+		Exclude []string      `long:"exclude" usage:"tags to skip"`
+		Retries int           `long:"retries" usage:"retry count"`
+		Offset  int           `long:"offset" showdefault:"true" usage:"starting offset"`
+		Prefix  string        `long:"prefix" usage:"name prefix"`
+	}
+
+	fs := NewFlagSet("run")
+	err := fs.FromStruct(&runConfig{})
+	assert.NoError(t, err)
+	fs.ShowDefault("prefix")
+
+	d := NewDispatcher("myapp")
+	d.Dispatch("run", NewCommand(fs, nil))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+	err = d.Execute([]string{"run", "--help"})
+	assert.NoError(t, err)
+
+	lines := make(map[string]string)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+			lines[fields[0]] = line
+		}
+	}
+
+	assert.Contains(t, lines["--timeout"], "(default: 30s)")
+	assert.NotContains(t, lines["--wait"], "default")
+	assert.Contains(t, lines["--tags"], "(default: tag1,tag2)")
+	assert.NotContains(t, lines["--exclude"], "default")
+	assert.NotContains(t, lines["--retries"], "default")
+	assert.Contains(t, lines["--offset"], "(default: 0)")
+	assert.Contains(t, lines["--prefix"], `(default: "")`)
+}
+
+func TestDispatcherExecuteWith(t *testing.T) {
+	d := NewDispatcher("myapp")
+	d.SetVersion("1.0.0")
+	d.Dispatch("greet", &writerCommand{fs: NewFlagSet("greet")})
+
+	var configured bytes.Buffer
+	d.SetOutput(&configured)
+
+	var out, errOut bytes.Buffer
+	err := d.ExecuteWith(&out, &errOut, []string{"--help"})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Available commands:")
+
+	out.Reset()
+	err = d.ExecuteWith(&out, &errOut, []string{"--version"})
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0\n", out.String())
+
+	out.Reset()
+	err = d.ExecuteWith(&out, &errOut, []string{"greet", "world"})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", out.String())
+	assert.Equal(t, "done", errOut.String())
+
+	err = d.ExecuteWith(&out, &errOut, []string{"gret"})
+	assert.EqualError(t, err, "unknown command: gret. Did you mean: greet?")
+
+	// The writer set with SetOutput is untouched and restored afterwards
+	assert.Empty(t, configured.String())
+	err = d.Execute([]string{"--help"})
+	assert.NoError(t, err)
+	assert.Contains(t, configured.String(), "Available commands:")
+}
+
+func TestDispatcherCommandGroup(t *testing.T) {
+	d := NewDispatcher("myapp")
+
+	var ran []string
+	cmd := func(name string) Command {
+		return NewCommand(NewFlagSet(name), func(fs *FlagSet, args []string) error {
+			ran = append(ran, name)
+			return nil
+		}, WithUsage("Run "+name))
+	}
+
+	db := d.Group("db").SetUsage("Database commands")
+	db.Add("migrate", cmd("migrate")).Add("seed", cmd("seed"))
+	db.Group("backup").Add("create", cmd("create"))
+
+	// Flat registration keeps working alongside groups
+	d.Dispatch("status", cmd("status"))
+
+	assert.Same(t, db, d.Group(" db "))
+	assert.Equal(t, "db backup", db.Group("backup").Path())
+	assert.Equal(t, "Database commands", db.Usage())
+	assert.True(t, d.HasCommand("db migrate"))
+	assert.True(t, d.HasCommand("db backup create"))
+
+	for _, args := range [][]string{{"db", "migrate"}, {"db", "seed"}, {"db", "backup", "create"}, {"status"}} {
+		assert.NoError(t, d.Execute(args))
+	}
+	assert.Equal(t, []string{"migrate", "seed", "create", "status"}, ran)
+}
+
+func TestDispatcherCommandGroupFlags(t *testing.T) {
+	d := NewDispatcher("myapp")
+	d.GlobalFlags().String("host", 0, "global", "global host")
+
+	db := d.Group("db")
+	host := db.Flags().String("host", 'H', "localhost", "database host")
+	backup := db.Group("backup")
+	bucket := backup.Flags().String("bucket", 0, "default", "backup bucket")
+
+	var gotHost string
+	d.Dispatch("status", NewCommand(NewFlagSet("status"), func(fs *FlagSet, args []string) error {
+		return nil
+	}))
+	db.Add("migrate", NewCommand(NewFlagSet("migrate"), func(fs *FlagSet, args []string) error {
+		gotHost = fs.Lookup("host").Value.String()
+		return nil
+	}))
+	backup.Add("create", NewCommand(NewFlagSet("create"), func(fs *FlagSet, args []string) error {
+		return nil
+	}, WithUsage("Create a backup")))
+
+	// Group flags take precedence over global flags, before or after the command
+	err := d.Execute([]string{"db", "migrate", "--host", "db.internal"})
+	assert.NoError(t, err)
+	assert.Equal(t, "db.internal", *host)
+	assert.Equal(t, "db.internal", gotHost)
+
+	err = d.Execute([]string{"db", "-H", "replica", "migrate"})
+	assert.NoError(t, err)
+	assert.Equal(t, "replica", gotHost)
+
+	// Child groups inherit the flags of enclosing groups
+	err = d.Execute([]string{"db", "backup", "create", "--bucket", "nightly", "--host", "primary"})
+	assert.NoError(t, err)
+	assert.Equal(t, "nightly", *bucket)
+	assert.Equal(t, "primary", *host)
+
+	// Group flags don't leak outside the group
+	err = d.Execute([]string{"status", "--bucket", "x"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+	err = d.Execute([]string{"db", "backup", "create", "--help"})
+	assert.NoError(t, err)
+	help := buf.String()
+	assert.NotContains(t, help, "\nOptions:")
+	assert.Contains(t, help, "db backup options:\n      --bucket <string>")
+	assert.Contains(t, help, "db options:\n  -H, --host <string>")
+	assert.Less(t, strings.Index(help, "db backup options:"), strings.Index(help, "db options:"))
+}
+
+func TestDispatcherGroupPrefixHelp(t *testing.T) {
+	d := NewDispatcher("myapp")
+	noop := func(fs *FlagSet, args []string) error { return nil }
+
+	d.Dispatch("foo bar", NewCommand(NewFlagSet("bar"), noop, WithUsage("Run bar")))
+	d.Dispatch("foo baz", NewCommand(NewFlagSet("baz"), noop))
+	d.Dispatch("foo deep leaf", NewCommand(NewFlagSet("leaf"), noop))
+	d.Group("foo deep").SetUsage("Deeper commands")
+	d.Group("foo").SetUsage("Foo commands")
+	d.Dispatch("food", NewCommand(NewFlagSet("food"), noop))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+
+	err := d.Execute([]string{"foo"})
+	assert.NoError(t, err)
+	help := buf.String()
+	assert.Contains(t, help, "Usage: myapp foo <command> [arguments]")
+	assert.Contains(t, help, "Foo commands")
+	assert.Contains(t, help, "  bar     Run bar\n  baz\n  deep    Deeper commands\n")
+	assert.NotContains(t, help, "food")
+	assert.NotContains(t, help, "leaf")
+
+	// Help flags show the same listing
+	buf.Reset()
+	err = d.Execute([]string{"foo", "--help"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Usage: myapp foo <command> [arguments]")
+
+	buf.Reset()
+	err = d.Execute([]string{"foo", "deep"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "  leaf\n")
+
+	// Arguments that aren't a prefix are still unknown
+	err = d.Execute([]string{"foo", "qux"})
+	assert.ErrorContains(t, err, "unknown command: foo qux")
+	err = d.Execute([]string{"fo"})
+	assert.ErrorContains(t, err, "unknown command: fo")
+}
+
+func TestDispatcherRecoverPanics(t *testing.T) {
+	d := NewDispatcher("myapp")
+	cause := errors.New("connection lost")
+	d.Dispatch("crash", NewCommand(NewFlagSet("crash"), func(fs *FlagSet, args []string) error {
+		panic(cause)
+	}))
+
+	// Off by default
+	assert.PanicsWithValue(t, cause, func() {
+		d.Execute([]string{"crash"})
+	})
+
+	d.SetRecoverPanics(true)
+	err := d.Execute([]string{"crash"})
+	var panicErr *PanicError
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, cause, panicErr.Value)
+		assert.Contains(t, string(panicErr.Stack), "TestDispatcherRecoverPanics")
+	}
+	assert.EqualError(t, err, "command panicked: connection lost")
+	assert.ErrorIs(t, err, cause)
+
+	// Panics in middleware are recovered too
+	d.Dispatch("ok", NewCommand(NewFlagSet("ok"), func(fs *FlagSet, args []string) error {
+		return nil
+	}))
+	d.Use(func(next CommandFunc) CommandFunc {
+		return func(fs *FlagSet, args []string) error {
+			panic("middleware failed")
+		}
+	})
+	err = d.Execute([]string{"ok"})
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, "middleware failed", panicErr.Value)
+		assert.Nil(t, panicErr.Unwrap())
+	}
+}
+
+func TestDispatcherNotFoundHandler(t *testing.T) {
+	d := NewDispatcher("myapp")
+	d.Dispatch("build", NewCommand(NewFlagSet("build"), func(fs *FlagSet, args []string) error {
+		return nil
+	}))
+
+	var got []string
+	errExternal := errors.New("external command failed")
+	d.SetNotFoundHandler(func(args []string) error {
+		got = args
+		return errExternal
+	})
+
+	err := d.Execute([]string{"lint", "--fix", "./..."})
+	assert.Equal(t, errExternal, err)
+	assert.Equal(t, []string{"lint", "--fix", "./..."}, got)
+
+	// Registered commands and help are unaffected
+	got = nil
+	assert.NoError(t, d.Execute([]string{"build"}))
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+	assert.NoError(t, d.Execute([]string{"--help"}))
+	assert.Nil(t, got)
+
+	// Clearing the handler restores the default error
+	d.SetNotFoundHandler(nil)
+	err = d.Execute([]string{"lint"})
+	assert.EqualError(t, err, "unknown command: lint")
+}
+
+func TestDispatcherStrictArgs(t *testing.T) {
+	d := NewDispatcher("myapp")
+	ran := false
+	d.Dispatch("status", NewCommand(NewFlagSet("status"), func(fs *FlagSet, args []string) error {
+		ran = true
+		return nil
+	}, WithStrictArgs()))
+
+	type Config struct {
+		Name string `position:"0"`
+	}
+	d.Dispatch("show", Infer(func(config *Config) error {
+		return nil
+	}, WithStrictArgs()))
+
+	assert.NoError(t, d.Execute([]string{"status"}))
+	assert.True(t, ran)
+
+	ran = false
+	err := d.Execute([]string{"status", "now"})
+	assert.ErrorIs(t, err, ErrTooManyArgs)
+	assert.False(t, ran)
+
+	assert.NoError(t, d.Execute([]string{"show", "api"}))
+	err = d.Execute([]string{"show", "api", "web"})
+	assert.ErrorIs(t, err, ErrTooManyArgs)
+}
+
+func TestDispatcherCustomHelp(t *testing.T) {
+	d := NewDispatcher("myapp")
+	d.SetHelpFlags("-?", "--usage")
+	d.SetHelpCommand("assist")
+
+	connectFS := NewFlagSet("connect")
+	host := connectFS.String("host", 'h', "localhost", "Host to connect to")
+	d.Dispatch("connect", NewCommand(connectFS, func(fs *FlagSet, args []string) error {
+		return nil
+	}, WithUsage("Connect to a server")))
+
+	var buf bytes.Buffer
+	d.SetOutput(&buf)
+
+	// -h is an ordinary flag now
+	err := d.Execute([]string{"connect", "-h", "db.internal"})
+	assert.NoError(t, err)
+	assert.Equal(t, "db.internal", *host)
+	assert.Empty(t, buf.String())
+
+	err = d.Execute([]string{"connect", "--help"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	// The configured flags and command show help
+	err = d.Execute([]string{"connect", "-?"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Usage: myapp connect [options]")
+
+	buf.Reset()
+	err = d.Execute([]string{"assist"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "Available commands:")
+	assert.Contains(t, buf.String(), "Use '<command> --usage' for more information about a command.")
+
+	err = d.Execute([]string{"help"})
+	assert.ErrorContains(t, err, "unknown command: help")
+
+	// Without help flags there is no hint
+	d.SetHelpFlags()
+	buf.Reset()
+	err = d.Execute([]string{"assist"})
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), "for more information")
+}
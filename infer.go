@@ -1,13 +1,19 @@
 package mflags
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"reflect"
 )
 
 // inferredCommand is a Command implementation that uses reflection to infer flags from a function signature
 type inferredCommand struct {
 	fn           reflect.Value
+	takesContext bool
+	returnsValue bool
 	configType   reflect.Type
 	configValue  reflect.Value
 	flags        *FlagSet
@@ -15,9 +21,28 @@ type inferredCommand struct {
 	outputFormat OutputFormat
 }
 
+// contextType is the type of context.Context, accepted as an optional first parameter
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// configUsage is implemented by config structs that describe their own command
+type configUsage interface {
+	Usage() string
+}
+
 // Infer creates a Command from a function using reflection.
-// The function must have the signature: func(*ConfigStruct) error
-// where ConfigStruct is a struct type with mflags struct tags.
+// The function must have the signature func(*ConfigStruct) error or
+// func(context.Context, *ConfigStruct) error, where ConfigStruct is a struct type
+// with mflags struct tags. A context-taking function receives the context given
+// to Dispatcher.ExecuteContext, or context.Background().
+//
+// The function may also return a result along with the error, as in
+// func(*ConfigStruct) (Result, error). The result is written as JSON to the
+// command's output, and the command's output format defaults to JSON, so the
+// MCP server returns it as structured tool data.
+//
+// The command's usage comes from a Usage() string method on the config struct,
+// or else from the usage tag of a blank field (_ struct{} `usage:"..."`).
+// WithUsage takes precedence over both.
 //
 // Example:
 //
@@ -42,22 +67,31 @@ func Infer(fn interface{}, opts ...CommandOption) Command {
 		panic(fmt.Sprintf("Infer: argument must be a function, got %v", fnType.Kind()))
 	}
 
-	if fnType.NumIn() != 1 {
-		panic(fmt.Sprintf("Infer: function must have exactly 1 parameter, got %d", fnType.NumIn()))
+	if fnType.NumIn() != 1 && fnType.NumIn() != 2 {
+		panic(fmt.Sprintf("Infer: function must have 1 parameter, or 2 with a leading context.Context, got %d", fnType.NumIn()))
+	}
+
+	takesContext := fnType.NumIn() == 2
+	if takesContext && fnType.In(0) != contextType {
+		panic(fmt.Sprintf("Infer: first of 2 parameters must be context.Context, got %v", fnType.In(0)))
 	}
 
-	if fnType.NumOut() != 1 {
-		panic(fmt.Sprintf("Infer: function must return exactly 1 value (error), got %d", fnType.NumOut()))
+	if fnType.NumOut() != 1 && fnType.NumOut() != 2 {
+		panic(fmt.Sprintf("Infer: function must return error or (result, error), got %d values", fnType.NumOut()))
 	}
 
-	// Check that return type is error
+	// Check that the last return type is error
 	errorInterface := reflect.TypeOf((*error)(nil)).Elem()
-	if !fnType.Out(0).Implements(errorInterface) {
+	if fnType.NumOut() == 1 && !fnType.Out(0).Implements(errorInterface) {
 		panic(fmt.Sprintf("Infer: function must return error, got %v", fnType.Out(0)))
 	}
+	if fnType.NumOut() == 2 && fnType.Out(1) != errorInterface {
+		panic(fmt.Sprintf("Infer: second return value must be error, got %v", fnType.Out(1)))
+	}
+	returnsValue := fnType.NumOut() == 2
 
-	// Check that first parameter is a pointer to a struct
-	paramType := fnType.In(0)
+	// Check that the config parameter is a pointer to a struct
+	paramType := fnType.In(fnType.NumIn() - 1)
 	if paramType.Kind() != reflect.Ptr {
 		panic(fmt.Sprintf("Infer: function parameter must be a pointer to a struct, got %v", paramType.Kind()))
 	}
@@ -78,12 +112,17 @@ func Infer(fn interface{}, opts ...CommandOption) Command {
 
 	cmd := &inferredCommand{
 		fn:           fnValue,
+		takesContext: takesContext,
+		returnsValue: returnsValue,
 		configType:   structType,
 		configValue:  configValue,
 		flags:        flags,
-		usage:        "",
+		usage:        inferUsage(configValue),
 		outputFormat: OutputFormatRaw,
 	}
+	if returnsValue {
+		cmd.outputFormat = OutputFormatJSON
+	}
 
 	// Apply options
 	for _, opt := range opts {
@@ -92,11 +131,36 @@ func Infer(fn interface{}, opts ...CommandOption) Command {
 		opt(fc)
 		cmd.usage = fc.usage
 		cmd.outputFormat = fc.outputFormat
+		if fc.strictArgs {
+			flags.SetStrictArgs(true)
+		}
 	}
 
+	if returnsValue {
+		return &inferredValueCommand{cmd}
+	}
 	return cmd
 }
 
+// inferUsage returns the usage described by a config struct, from its Usage
+// method or the usage tag of a blank field
+func inferUsage(configValue reflect.Value) string {
+	if u, ok := configValue.Interface().(configUsage); ok {
+		return u.Usage()
+	}
+
+	structType := configValue.Type().Elem()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.Name == "_" {
+			if usage := field.Tag.Get("usage"); usage != "" {
+				return usage
+			}
+		}
+	}
+	return ""
+}
+
 // FlagSet returns the flagset for this command
 func (c *inferredCommand) FlagSet() *FlagSet {
 	return c.flags
@@ -104,17 +168,58 @@ func (c *inferredCommand) FlagSet() *FlagSet {
 
 // Run executes the command by calling the inferred function with the parsed config
 func (c *inferredCommand) Run(fs *FlagSet, args []string) error {
+	return c.RunContext(context.Background(), fs, args)
+}
+
+// RunContext is like Run, passing ctx to functions that take a context
+func (c *inferredCommand) RunContext(ctx context.Context, fs *FlagSet, args []string) error {
+	return c.runContextWithOutput(ctx, fs, args, os.Stdout, os.Stderr)
+}
+
+// runContextWithOutput calls the inferred function, writing its result, if it
+// returns one, to stdout as JSON
+func (c *inferredCommand) runContextWithOutput(ctx context.Context, fs *FlagSet, args []string, stdout, stderr io.Writer) error {
 	// Call the function with the config struct
-	results := c.fn.Call([]reflect.Value{c.configValue})
+	in := []reflect.Value{c.configValue}
+	if c.takesContext {
+		in = []reflect.Value{reflect.ValueOf(&ctx).Elem(), c.configValue}
+	}
+	results := c.fn.Call(in)
 
 	// Extract the error return value
-	errValue := results[0].Interface()
+	errValue := results[len(results)-1].Interface()
 	if errValue != nil {
 		return errValue.(error)
 	}
+
+	if c.returnsValue {
+		data, err := json.MarshalIndent(results[0].Interface(), "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding result: %w", err)
+		}
+		_, err = fmt.Fprintf(stdout, "%s\n", data)
+		return err
+	}
 	return nil
 }
 
+// inferredValueCommand is an inferred command whose function returns a result.
+// It implements OutputWriter and ContextOutputWriter so callers capturing output, such as the MCP server,
+// receive the result directly instead of redirecting os.Stdout.
+type inferredValueCommand struct {
+	*inferredCommand
+}
+
+// RunWithOutput executes the command, writing its result to stdout
+func (c *inferredValueCommand) RunWithOutput(fs *FlagSet, args []string, stdout, stderr io.Writer) error {
+	return c.runContextWithOutput(context.Background(), fs, args, stdout, stderr)
+}
+
+// RunContextWithOutput is like RunWithOutput, passing ctx to functions that take a context
+func (c *inferredValueCommand) RunContextWithOutput(ctx context.Context, fs *FlagSet, args []string, stdout, stderr io.Writer) error {
+	return c.runContextWithOutput(ctx, fs, args, stdout, stderr)
+}
+
 // Usage returns the usage description for this command
 func (c *inferredCommand) Usage() string {
 	return c.usage
@@ -1,8 +1,12 @@
 package mflags
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"testing"
 	"time"
 )
@@ -378,7 +382,7 @@ func TestInferPanicWrongParamCount(t *testing.T) {
 			t.Error("Expected panic, but didn't get one")
 		} else {
 			msg := fmt.Sprintf("%v", r)
-			if msg != "Infer: function must have exactly 1 parameter, got 0" {
+			if msg != "Infer: function must have 1 parameter, or 2 with a leading context.Context, got 0" {
 				t.Errorf("Expected panic message about parameter count, got: %s", msg)
 			}
 		}
@@ -397,7 +401,7 @@ func TestInferPanicWrongReturnCount(t *testing.T) {
 			t.Error("Expected panic, but didn't get one")
 		} else {
 			msg := fmt.Sprintf("%v", r)
-			if msg != "Infer: function must return exactly 1 value (error), got 0" {
+			if msg != "Infer: function must return error or (result, error), got 0 values" {
 				t.Errorf("Expected panic message about return count, got: %s", msg)
 			}
 		}
@@ -514,3 +518,227 @@ func TestInferDefaultValues(t *testing.T) {
 		t.Error("Expected Debug to be false")
 	}
 }
+
+// usageMethodConfig describes its command through a Usage method
+type usageMethodConfig struct {
+	Verbose bool `long:"verbose" usage:"Verbose output"`
+}
+
+func (c *usageMethodConfig) Usage() string {
+	return "Sync files with the server"
+}
+
+// TestInferUsageFromMethod tests that a Usage method on the config sets the usage
+func TestInferUsageFromMethod(t *testing.T) {
+	fn := func(config *usageMethodConfig) error {
+		return nil
+	}
+
+	cmd := Infer(fn)
+	if cmd.Usage() != "Sync files with the server" {
+		t.Errorf("Expected usage from method, got '%s'", cmd.Usage())
+	}
+
+	// WithUsage takes precedence
+	cmd = Infer(fn, WithUsage("Overridden"))
+	if cmd.Usage() != "Overridden" {
+		t.Errorf("Expected usage='Overridden', got '%s'", cmd.Usage())
+	}
+}
+
+// TestInferUsageFromTag tests that the usage tag of a blank field sets the usage
+func TestInferUsageFromTag(t *testing.T) {
+	type Config struct {
+		_       struct{} `usage:"Show service status"`
+		Verbose bool     `long:"verbose" usage:"Verbose output"`
+	}
+
+	fn := func(config *Config) error {
+		return nil
+	}
+
+	cmd := Infer(fn)
+	if cmd.Usage() != "Show service status" {
+		t.Errorf("Expected usage from tag, got '%s'", cmd.Usage())
+	}
+	if cmd.FlagSet().Lookup("verbose") == nil {
+		t.Error("Expected verbose flag to be defined")
+	}
+
+	cmd = Infer(fn, WithUsage("Overridden"))
+	if cmd.Usage() != "Overridden" {
+		t.Errorf("Expected usage='Overridden', got '%s'", cmd.Usage())
+	}
+}
+
+type inferContextKey struct{}
+
+// TestInferWithContext tests that a function taking a context receives the dispatcher's context
+func TestInferWithContext(t *testing.T) {
+	type Config struct {
+		Name string `long:"name" usage:"Name"`
+	}
+
+	var gotValue any
+	var gotName string
+	fn := func(ctx context.Context, config *Config) error {
+		if ctx == nil {
+			return errors.New("nil context")
+		}
+		gotValue = ctx.Value(inferContextKey{})
+		gotName = config.Name
+		return ctx.Err()
+	}
+
+	d := NewDispatcher("app")
+	d.Dispatch("greet", Infer(fn))
+
+	ctx := context.WithValue(context.Background(), inferContextKey{}, "request-1")
+	if err := d.ExecuteContext(ctx, []string{"greet", "--name", "ada"}); err != nil {
+		t.Fatalf("ExecuteContext failed: %v", err)
+	}
+	if gotValue != "request-1" {
+		t.Errorf("Expected context value 'request-1', got %v", gotValue)
+	}
+	if gotName != "ada" {
+		t.Errorf("Expected Name='ada', got '%s'", gotName)
+	}
+
+	// Execute uses a background context
+	gotValue = nil
+	if err := d.Execute([]string{"greet"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if gotValue != nil {
+		t.Errorf("Expected no context value, got %v", gotValue)
+	}
+
+	// Cancellation reaches the function
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.ExecuteContext(cancelled, []string{"greet"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestInferPanicWrongContextParam tests that Infer panics if the first of two parameters isn't a context
+func TestInferPanicWrongContextParam(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic, but didn't get one")
+		} else {
+			msg := fmt.Sprintf("%v", r)
+			if msg != "Infer: first of 2 parameters must be context.Context, got string" {
+				t.Errorf("Expected panic message about context parameter, got: %s", msg)
+			}
+		}
+	}()
+
+	type Config struct {
+		Value string `long:"value"`
+	}
+	fn := func(name string, config *Config) error {
+		return nil
+	}
+	Infer(fn)
+}
+
+// TestInferReturnsResult tests that a function's result is printed as JSON
+func TestInferReturnsResult(t *testing.T) {
+	type Config struct {
+		Name string `long:"name" usage:"Service name"`
+	}
+	type Status struct {
+		Name    string `json:"name"`
+		Healthy bool   `json:"healthy"`
+	}
+
+	fn := func(config *Config) (*Status, error) {
+		if config.Name == "" {
+			return nil, errors.New("name is required")
+		}
+		return &Status{Name: config.Name, Healthy: true}, nil
+	}
+
+	cmd := Infer(fn)
+	formatter, ok := cmd.(OutputFormatter)
+	if !ok || formatter.OutputFormat() != OutputFormatJSON {
+		t.Errorf("Expected OutputFormat=JSON for a result-returning function")
+	}
+
+	d := NewDispatcher("app")
+	d.Dispatch("status", cmd)
+
+	var stdout, stderr bytes.Buffer
+	if err := d.ExecuteWith(&stdout, &stderr, []string{"status", "--name", "api"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	expected := "{\n  \"name\": \"api\",\n  \"healthy\": true\n}\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, stdout.String())
+	}
+
+	// Errors are returned and nothing is printed
+	d = NewDispatcher("app")
+	d.Dispatch("status", Infer(fn))
+
+	stdout.Reset()
+	err := d.ExecuteWith(&stdout, &stderr, []string{"status"})
+	if err == nil || err.Error() != "name is required" {
+		t.Errorf("Expected 'name is required' error, got %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no output on error, got %q", stdout.String())
+	}
+}
+
+// TestInferReturnsResultWithContext tests a function taking a context and returning a result
+func TestInferReturnsResultWithContext(t *testing.T) {
+	type Config struct{}
+
+	fn := func(ctx context.Context, config *Config) ([]string, error) {
+		return []string{fmt.Sprint(ctx.Value(inferContextKey{}))}, nil
+	}
+
+	d := NewDispatcher("app")
+	d.Dispatch("list", Infer(fn))
+
+	ctx := context.WithValue(context.Background(), inferContextKey{}, "item")
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	origStdout := os.Stdout
+	os.Stdout = w
+	err = d.ExecuteContext(ctx, []string{"list"})
+	os.Stdout = origStdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	if err != nil {
+		t.Fatalf("ExecuteContext failed: %v", err)
+	}
+	if string(out) != "[\n  \"item\"\n]\n" {
+		t.Errorf("Expected JSON list on stdout, got %q", string(out))
+	}
+}
+
+// TestInferPanicWrongSecondReturn tests that Infer panics if a second return value isn't error
+func TestInferPanicWrongSecondReturn(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected panic, but didn't get one")
+		} else {
+			msg := fmt.Sprintf("%v", r)
+			if msg != "Infer: second return value must be error, got string" {
+				t.Errorf("Expected panic message about second return value, got: %s", msg)
+			}
+		}
+	}()
+
+	type Config struct{}
+	fn := func(config *Config) (int, string) {
+		return 0, ""
+	}
+	Infer(fn)
+}
@@ -3,11 +3,17 @@ package mflags
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -95,9 +101,25 @@ type ToolsCapability struct {
 
 // Tool represents an MCP tool
 type Tool struct {
-	Name        string       `json:"name"`
-	Description string       `json:"description,omitempty"`
-	InputSchema *InputSchema `json:"inputSchema"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema *InputSchema    `json:"inputSchema"`
+	Annotations *ToolAnnotation `json:"annotations,omitempty"`
+}
+
+// ToolAnnotation describes how a tool behaves, so clients can present it
+// appropriately, e.g. by asking for confirmation before destructive calls
+type ToolAnnotation struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`    // The tool does not modify its environment
+	DestructiveHint bool `json:"destructiveHint"` // The tool may delete or overwrite data
+	IdempotentHint  bool `json:"idempotentHint"`  // Repeated calls with the same arguments have no further effect
+}
+
+// ToolAnnotator is an interface for commands that advertise tool annotations
+// to MCP clients. Commands that don't implement it are listed without annotations.
+type ToolAnnotator interface {
+	// ToolAnnotations returns the annotations for this command's tool
+	ToolAnnotations() ToolAnnotation
 }
 
 // InputSchema represents the JSON schema for tool input
@@ -109,10 +131,12 @@ type InputSchema struct {
 
 // Property represents a JSON schema property
 type Property struct {
-	Type        string      `json:"type"`
-	Description string      `json:"description,omitempty"`
-	Items       *Property   `json:"items,omitempty"`
-	Default     interface{} `json:"default,omitempty"`
+	Type                 string      `json:"type"`
+	Description          string      `json:"description,omitempty"`
+	Items                *Property   `json:"items,omitempty"`
+	AdditionalProperties *Property   `json:"additionalProperties,omitempty"`
+	Default              interface{} `json:"default,omitempty"`
+	Enum                 []string    `json:"enum,omitempty"`
 }
 
 // ToolsListRequest represents the tools/list request parameters
@@ -140,6 +164,7 @@ type ToolCallResult struct {
 
 // Content represents tool output content
 type Content struct {
+	URI      string          `json:"uri,omitempty"`
 	Type     string          `json:"type"`
 	Text     string          `json:"text,omitempty"`
 	Data     json.RawMessage `json:"data,omitempty"`
@@ -160,6 +185,25 @@ type Resource struct {
 	MimeType    string `json:"mimeType,omitempty"`
 }
 
+// ResourceReadRequest represents the resources/read request parameters
+type ResourceReadRequest struct {
+	URI string `json:"uri"`
+}
+
+// ResourceReadResult represents the resources/read response
+type ResourceReadResult struct {
+	Contents []Content `json:"contents"`
+}
+
+// ResourceProvider supplies resources to an MCPServer
+type ResourceProvider interface {
+	// ListResources returns the resources this provider serves
+	ListResources() []Resource
+
+	// ReadResource returns the content of the resource with the given URI
+	ReadResource(uri string) (Content, error)
+}
+
 // PromptsListResult represents the prompts/list response
 type PromptsListResult struct {
 	Prompts    []Prompt `json:"prompts"`
@@ -180,6 +224,33 @@ type Argument struct {
 	Required    bool   `json:"required,omitempty"`
 }
 
+// PromptGetRequest represents the prompts/get request parameters
+type PromptGetRequest struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// PromptGetResult represents the prompts/get response
+type PromptGetResult struct {
+	Description string          `json:"description,omitempty"`
+	Messages    []PromptMessage `json:"messages"`
+}
+
+// PromptMessage represents a message returned by prompts/get
+type PromptMessage struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// PromptProvider supplies prompts to an MCPServer
+type PromptProvider interface {
+	// ListPrompts returns the prompts this provider serves
+	ListPrompts() []Prompt
+
+	// GetPrompt renders the named prompt with the given arguments
+	GetPrompt(name string, args map[string]string) ([]Content, error)
+}
+
 // MCPServer handles MCP protocol communication
 type MCPServer struct {
 	dispatcher  *Dispatcher
@@ -189,6 +260,13 @@ type MCPServer struct {
 	mu          sync.Mutex
 	initialized bool
 	serverInfo  Implementation
+	resources   []ResourceProvider
+	prompts     []PromptProvider
+	pageSize    int
+	toolNameSep string
+	versionSet  bool // Whether SetServerInfo overrode the version
+	versions    []string
+	batch       *[]MCPResponse // Responses collected while handling a batch
 }
 
 // NewMCPServer creates a new MCP server
@@ -202,9 +280,89 @@ func NewMCPServer(dispatcher *Dispatcher) *MCPServer {
 			Name:    "mflags-mcp-server",
 			Version: "1.0.0",
 		},
+		versions:    []string{MCPProtocolVersion},
+		toolNameSep: "_",
 	}
 }
 
+// SetToolNameSeparator sets the string that replaces the spaces of nested
+// command paths in tool names, since many clients reject names with spaces.
+// The default "_" exposes "foo bar baz" as the tool foo_bar_baz.
+func (s *MCPServer) SetToolNameSeparator(sep string) {
+	s.toolNameSep = sep
+}
+
+// toolPaths maps each tool name to the command path it runs. Commands whose
+// path contains no spaces keep it as their name. If replacing spaces produces a
+// name that is already taken, a numeric suffix keeps it unique.
+func (s *MCPServer) toolPaths() map[string]string {
+	var nested []string
+	paths := make(map[string]string)
+	for path := range s.dispatcher.GetCommands() {
+		if strings.Contains(path, " ") {
+			nested = append(nested, path)
+		} else {
+			paths[path] = path
+		}
+	}
+	sort.Strings(nested)
+
+	for _, path := range nested {
+		base := strings.ReplaceAll(path, " ", s.toolNameSep)
+		name := base
+		for i := 2; ; i++ {
+			if _, taken := paths[name]; !taken {
+				break
+			}
+			name = fmt.Sprintf("%s%s%d", base, s.toolNameSep, i)
+		}
+		paths[name] = path
+	}
+	return paths
+}
+
+// SetSupportedVersions sets the MCP protocol versions the server accepts.
+// The default is MCPProtocolVersion.
+func (s *MCPServer) SetSupportedVersions(versions ...string) {
+	s.versions = versions
+}
+
+// negotiateVersion returns the protocol version to use with a client requesting
+// requested: the highest supported version that is not newer than the request.
+// Protocol versions are dates, so they order as strings.
+func (s *MCPServer) negotiateVersion(requested string) (string, bool) {
+	best := ""
+	for _, v := range s.versions {
+		if v <= requested && v > best {
+			best = v
+		}
+	}
+	return best, best != ""
+}
+
+// SetServerInfo sets the name and version reported to clients in the initialize
+// response. An empty name or version keeps the current value. A version set here
+// takes precedence over the dispatcher's version.
+func (s *MCPServer) SetServerInfo(name, version string) {
+	if name != "" {
+		s.serverInfo.Name = name
+	}
+	if version != "" {
+		s.serverInfo.Version = version
+		s.versionSet = true
+	}
+}
+
+// info returns the server implementation info, using the dispatcher's version if set
+func (s *MCPServer) info() Implementation {
+	info := s.serverInfo
+	if !s.versionSet && s.dispatcher != nil && s.dispatcher.version != "" {
+		version, _, _ := strings.Cut(s.dispatcher.version, "\n")
+		info.Version = strings.TrimSpace(version)
+	}
+	return info
+}
+
 // SetInput sets the input reader
 func (s *MCPServer) SetInput(r io.Reader) {
 	s.input = r
@@ -220,38 +378,144 @@ func (s *MCPServer) SetErrorOutput(w io.Writer) {
 	s.errorOutput = w
 }
 
+// SetPageSize sets the maximum number of tools returned by a single tools/list
+// request. Clients fetch the rest by passing back the returned cursor. Zero,
+// the default, returns all tools at once.
+func (s *MCPServer) SetPageSize(n int) {
+	s.pageSize = n
+}
+
+// RegisterResourceProvider adds a provider whose resources are served through
+// resources/list and resources/read. Providers are consulted in registration order.
+func (s *MCPServer) RegisterResourceProvider(p ResourceProvider) {
+	s.resources = append(s.resources, p)
+}
+
+// RegisterPromptProvider adds a provider whose prompts are served through
+// prompts/list and prompts/get. Providers are consulted in registration order.
+func (s *MCPServer) RegisterPromptProvider(p PromptProvider) {
+	s.prompts = append(s.prompts, p)
+}
+
 // Run starts the MCP server and processes requests
 func (s *MCPServer) Run() error {
-	scanner := bufio.NewScanner(s.input)
+	return s.RunContext(context.Background())
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+// RunContext is like Run, but also returns when ctx is cancelled, even while
+// waiting for input, with the context's error. The goroutine reading input
+// finishes once the pending read returns.
+func (s *MCPServer) RunContext(ctx context.Context) error {
+	lines := make(chan string)
+	readErr := make(chan error, 1)
 
-		// Skip empty lines
-		if strings.TrimSpace(line) == "" {
-			continue
+	go func() {
+		scanner := bufio.NewScanner(s.input)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line := <-lines:
+			s.handleLine(ctx, line)
+		case err := <-readErr:
+			if err != nil {
+				return fmt.Errorf("error reading input: %w", err)
+			}
+			return nil
 		}
+	}
+}
+
+// handleLine parses and handles a single line of input. Tool calls run with ctx.
+func (s *MCPServer) handleLine(ctx context.Context, line string) {
+	// Skip empty lines
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	if strings.HasPrefix(line, "[") {
+		s.handleBatch(ctx, line)
+		return
+	}
+
+	// Parse JSON-RPC request
+	var request MCPRequest
+	if err := json.Unmarshal([]byte(line), &request); err != nil {
+		s.sendErrorResponse(nil, -32700, "Parse error", err.Error())
+		return
+	}
+
+	// Handle the request
+	s.handleRequest(ctx, request)
+}
+
+// handleBatch handles a JSON-RPC batch, writing the responses as a single array.
+// Notifications produce no response, and nothing is written if the batch
+// contains only notifications.
+func (s *MCPServer) handleBatch(ctx context.Context, line string) {
+	// Decode each element separately, so an invalid one gets its own error
+	// response without failing the rest of the batch
+	var elements []json.RawMessage
+	if err := json.Unmarshal([]byte(line), &elements); err != nil {
+		s.sendErrorResponse(nil, -32700, "Parse error", err.Error())
+		return
+	}
+	if len(elements) == 0 {
+		s.sendErrorResponse(nil, -32600, "Invalid Request", "empty batch")
+		return
+	}
+
+	responses := []MCPResponse{}
+	s.mu.Lock()
+	s.batch = &responses
+	s.mu.Unlock()
 
-		// Parse JSON-RPC request
+	for _, element := range elements {
 		var request MCPRequest
-		if err := json.Unmarshal([]byte(line), &request); err != nil {
-			s.sendErrorResponse(nil, -32700, "Parse error", err.Error())
+		if err := json.Unmarshal(element, &request); err != nil {
+			s.sendErrorResponse(nil, -32600, "Invalid Request", err.Error())
 			continue
 		}
+		n := len(responses)
+		s.handleRequest(ctx, request)
+		if request.ID == nil && request.JSONRPC == "2.0" {
+			// Notifications never receive a response
+			responses = responses[:n]
+		}
+	}
+
+	s.mu.Lock()
+	s.batch = nil
+	s.mu.Unlock()
 
-		// Handle the request
-		s.handleRequest(request)
+	if len(responses) == 0 {
+		return
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading input: %w", err)
+	data, err := json.Marshal(responses)
+	if err != nil {
+		fmt.Fprintf(s.errorOutput, "Error marshaling response: %v\n", err)
+		return
 	}
 
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.output, string(data))
 }
 
 // handleRequest processes a single MCP request
-func (s *MCPServer) handleRequest(request MCPRequest) {
+func (s *MCPServer) handleRequest(ctx context.Context, request MCPRequest) {
 	// Validate JSON-RPC version
 	if request.JSONRPC != "2.0" {
 		s.sendErrorResponse(request.ID, -32600, "Invalid Request", "JSON-RPC version must be 2.0")
@@ -267,7 +531,7 @@ func (s *MCPServer) handleRequest(request MCPRequest) {
 	case "tools/list":
 		s.handleToolsList(request)
 	case "tools/call":
-		s.handleToolCall(request)
+		s.handleToolCall(ctx, request)
 	case "resources/list":
 		s.handleResourcesList(request)
 	case "resources/read":
@@ -292,11 +556,11 @@ func (s *MCPServer) handleInitialize(request MCPRequest) {
 	}
 
 	// Check protocol version compatibility
-	if params.ProtocolVersion != MCPProtocolVersion {
-		// For now, we only support one version
+	version, ok := s.negotiateVersion(params.ProtocolVersion)
+	if !ok {
 		s.sendErrorResponse(request.ID, -32602, "Unsupported protocol version",
-			map[string]string{
-				"supported": MCPProtocolVersion,
+			map[string]any{
+				"supported": s.versions,
 				"requested": params.ProtocolVersion,
 			})
 		return
@@ -318,9 +582,9 @@ func (s *MCPServer) handleInitialize(request MCPRequest) {
 	}
 
 	result := InitializeResult{
-		ProtocolVersion: MCPProtocolVersion,
+		ProtocolVersion: version,
 		Capabilities:    capabilities,
-		ServerInfo:      s.serverInfo,
+		ServerInfo:      s.info(),
 		Instructions:    "This MCP server exposes command-line tools from the mflags dispatcher.",
 	}
 
@@ -334,51 +598,131 @@ func (s *MCPServer) handleInitialized(request MCPRequest) {
 	// Just mark that we're ready for normal operations
 }
 
-// handleToolsList handles the tools/list request
+// handleToolsList handles the tools/list request. Tools are listed in name order
+// so the response is reproducible and pagination cursors stay stable.
 func (s *MCPServer) handleToolsList(request MCPRequest) {
 	if !s.initialized {
 		s.sendErrorResponse(request.ID, -32002, "Server not initialized", nil)
 		return
 	}
 
-	// Convert dispatcher commands to MCP tools
-	var tools []Tool
+	var params ToolsListRequest
+	if len(request.Params) > 0 {
+		if err := json.Unmarshal(request.Params, &params); err != nil {
+			s.sendErrorResponse(request.ID, -32602, "Invalid params", err.Error())
+			return
+		}
+	}
+
+	// Page through the tools in name order so cursors stay stable
 	commands := s.dispatcher.GetCommands()
+	paths := s.toolPaths()
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start, err := decodeCursor(params.Cursor)
+	if err != nil || start > len(names) {
+		s.sendErrorResponse(request.ID, -32602, "Invalid params", "invalid cursor")
+		return
+	}
+	end := len(names)
+	if s.pageSize > 0 && start+s.pageSize < end {
+		end = start + s.pageSize
+	}
 
-	for name, cmd := range commands {
+	// Convert dispatcher commands to MCP tools
+	var tools []Tool
+	for _, name := range names[start:end] {
+		cmd := commands[paths[name]]
+		s.dispatcher.commandFlags(paths[name], cmd)
 		tool := Tool{
 			Name:        name,
 			Description: cmd.Usage(),
 			InputSchema: s.buildToolSchema(cmd),
 		}
+		if annotator, ok := cmd.(ToolAnnotator); ok {
+			annotations := annotator.ToolAnnotations()
+			tool.Annotations = &annotations
+		}
 		tools = append(tools, tool)
 	}
 
 	result := ToolsListResult{
 		Tools: tools,
 	}
+	if end < len(names) {
+		result.NextCursor = encodeCursor(end)
+	}
 
 	s.sendResponse(request.ID, result)
 }
 
+// encodeCursor returns an opaque pagination cursor for the given list offset
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+// decodeCursor returns the list offset for a cursor from encodeCursor.
+// An empty cursor starts at the beginning.
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := strconv.Atoi(string(b))
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return offset, nil
+}
+
 // buildToolSchema builds a JSON schema from a command's FlagSet
 func (s *MCPServer) buildToolSchema(cmd Command) *InputSchema {
+	return cmd.FlagSet().JSONSchema()
+}
+
+// JSONSchema returns a JSON schema describing the arguments f accepts, in the
+// form used for MCP tool input: each flag and positional argument is a property,
+// positional arguments and required flags are required, and rest arguments are
+// the "arguments" array. A nil FlagSet yields an empty object schema.
+func (f *FlagSet) JSONSchema() *InputSchema {
 	schema := &InputSchema{
 		Type:       "object",
 		Properties: make(map[string]Property),
 		Required:   []string{},
 	}
 
-	fs := cmd.FlagSet()
-	if fs == nil {
+	if f == nil {
 		return schema
 	}
 
 	// Add properties for each flag
-	fs.VisitAll(func(flag *Flag) {
+	f.VisitAll(func(flag *Flag) {
 		prop := Property{
-			Type:        s.getJSONType(flag.Value),
+			Type:        jsonTypeForValue(flag.Value),
 			Description: flag.Usage,
+			Enum:        flag.choices,
+		}
+
+		// Map flags take an object of string values
+		if _, ok := flag.Value.(*stringMapValue); ok {
+			prop.AdditionalProperties = &Property{Type: "string"}
+		}
+
+		// Hint at the expected string format for network values
+		switch flag.Value.(type) {
+		case *ipValue:
+			prop.Description += " (format: IP address, e.g. 192.168.1.1)"
+		case *ipNetValue:
+			prop.Description += " (format: CIDR, e.g. 10.0.0.0/8)"
+		case *urlValue:
+			prop.Description += " (format: URL, e.g. https://example.com)"
 		}
 
 		// Set default value if available
@@ -386,6 +730,11 @@ func (s *MCPServer) buildToolSchema(cmd Command) *InputSchema {
 			prop.Default = flag.DefValue
 		}
 
+		// Map defaults are objects, matching the property type
+		if m, ok := flag.Value.(*stringMapValue); ok && len(m.def) > 0 {
+			prop.Default = m.def
+		}
+
 		// Use the long name if available, otherwise use string of short flag
 		propName := flag.Name
 		if propName == "" && flag.Short != 0 {
@@ -394,36 +743,54 @@ func (s *MCPServer) buildToolSchema(cmd Command) *InputSchema {
 
 		if propName != "" {
 			schema.Properties[propName] = prop
+			if flag.required {
+				schema.Required = append(schema.Required, propName)
+			}
 		}
 	})
 
 	// Add positional arguments as named parameters
-	positionalFields := fs.GetPositionalFields()
+	positionalFields := f.GetPositionalFields()
 	for _, field := range positionalFields {
 		// Convert field name to lowercase for consistency
 		paramName := strings.ToLower(field.Name)
 
 		// Determine JSON type based on field type
-		jsonType := s.getTypeForReflectType(field.Type)
+		jsonType := jsonTypeForReflectType(field.Type)
+
+		description := field.Usage
+		if description == "" {
+			description = fmt.Sprintf("Positional argument %s", field.Name)
+		}
 
 		prop := Property{
 			Type:        jsonType,
-			Description: fmt.Sprintf("Positional argument %s", field.Name),
+			Description: description,
+		}
+
+		// A position range takes any number of arguments
+		if field.Range {
+			prop.Items = &Property{Type: "string"}
 		}
 
 		schema.Properties[paramName] = prop
-		// Positional arguments are required
-		schema.Required = append(schema.Required, paramName)
+		if field.Required {
+			schema.Required = append(schema.Required, paramName)
+		}
 	}
 
 	// Check if there are rest arguments
-	if fs.HasRestArgs() {
-		// Add rest arguments as an array property
+	if f.HasRestArgs() {
+		// Add rest arguments as an array property, typed by a non-string rest field
+		itemType := "string"
+		if f.restTyped.IsValid() {
+			itemType = jsonTypeForReflectType(f.restTyped.Type().Elem())
+		}
 		schema.Properties["arguments"] = Property{
 			Type:        "array",
 			Description: "Additional command arguments",
 			Items: &Property{
-				Type: "string",
+				Type: itemType,
 			},
 		}
 	}
@@ -431,22 +798,28 @@ func (s *MCPServer) buildToolSchema(cmd Command) *InputSchema {
 	return schema
 }
 
-// getJSONType returns the JSON schema type for a flag value
-func (s *MCPServer) getJSONType(v Value) string {
+// jsonTypeForValue returns the JSON schema type for a flag value
+func jsonTypeForValue(v Value) string {
 	if v == nil {
 		return "string"
 	}
 
 	// Check the underlying type
-	switch v.(type) {
+	switch pv := v.(type) {
+	case *pointerValue:
+		return jsonTypeForValue(pv.value)
 	case *boolValue:
 		return "boolean"
 	case *intValue:
 		return "integer"
-	case *durationValue:
-		return "string" // Duration is represented as string
-	case *stringArrayValue:
+	case *durationValue, *byteSizeValue:
+		return "string" // Durations and sizes are represented as strings with units
+	case *ipValue, *ipNetValue, *urlValue:
+		return "string"
+	case *stringArrayValue, *intSliceValue, *float64SliceValue:
 		return "array"
+	case *stringMapValue:
+		return "object"
 	default:
 		// For custom types, try to infer from the value
 		val := reflect.ValueOf(v)
@@ -470,8 +843,8 @@ func (s *MCPServer) getJSONType(v Value) string {
 	}
 }
 
-// getTypeForReflectType returns the JSON schema type for a reflect.Type
-func (s *MCPServer) getTypeForReflectType(t reflect.Type) string {
+// jsonTypeForReflectType returns the JSON schema type for a reflect.Type
+func jsonTypeForReflectType(t reflect.Type) string {
 	switch t.Kind() {
 	case reflect.Bool:
 		return "boolean"
@@ -489,13 +862,15 @@ func (s *MCPServer) getTypeForReflectType(t reflect.Type) string {
 		return "string"
 	case reflect.Slice:
 		return "array"
+	case reflect.Ptr:
+		return jsonTypeForReflectType(t.Elem())
 	default:
 		return "string"
 	}
 }
 
-// handleToolCall handles the tools/call request
-func (s *MCPServer) handleToolCall(request MCPRequest) {
+// handleToolCall handles the tools/call request, running the tool with ctx
+func (s *MCPServer) handleToolCall(ctx context.Context, request MCPRequest) {
 	if !s.initialized {
 		s.sendErrorResponse(request.ID, -32002, "Server not initialized", nil)
 		return
@@ -507,138 +882,72 @@ func (s *MCPServer) handleToolCall(request MCPRequest) {
 		return
 	}
 
-	// Check if the command exists
-	cmd := s.dispatcher.GetCommand(params.Name)
+	// Check if the command exists, recovering its path from the tool name
+	path, ok := s.toolPaths()[params.Name]
+	if !ok {
+		path = params.Name
+	}
+	cmd := s.dispatcher.GetCommand(path)
 	if cmd == nil {
 		s.sendErrorResponse(request.ID, -32602, "Tool not found",
 			fmt.Sprintf("No tool named '%s'", params.Name))
 		return
 	}
 
-	// Build command arguments from the tool call parameters
-	var args []string
-
-	// Process the arguments map to build command-line flags
-	if params.Arguments != nil {
-		fs := cmd.FlagSet()
-		if fs != nil {
-			// Get positional field names
-			positionalFields := fs.GetPositionalFields()
-			positionalNames := make(map[string]bool)
-			for _, field := range positionalFields {
-				positionalNames[strings.ToLower(field.Name)] = true
-			}
-
-			// Separate positional arguments from flags
-			var positionalArgs []string
-			flagArgs := make(map[string]interface{})
-
-			for key, value := range params.Arguments {
-				if key == "arguments" {
-					// These are rest arguments, handle separately
-					continue
-				}
-
-				// Check if this is a positional argument
-				if positionalNames[key] {
-					// Store positional arguments in order
-					positionalArgs = append(positionalArgs, fmt.Sprintf("%v", value))
-				} else {
-					// Store as flag
-					flagArgs[key] = value
-				}
-			}
-
-			// Add flags first
-			for key, value := range flagArgs {
-				// Convert the argument to command-line flag format
-				if boolVal, ok := value.(bool); ok && boolVal {
-					// For boolean flags that are true, just add the flag
-					if len(key) == 1 {
-						args = append(args, "-"+key)
-					} else {
-						args = append(args, "--"+key)
-					}
-				} else if !ok || !boolVal {
-					// For non-boolean or false boolean, add flag with value
-					if boolVal, ok := value.(bool); ok && !boolVal {
-						// Skip false boolean flags (they're off by default)
-						continue
-					}
-
-					// Add the flag and its value
-					if len(key) == 1 {
-						args = append(args, "-"+key)
-					} else {
-						args = append(args, "--"+key)
-					}
-					args = append(args, fmt.Sprintf("%v", value))
-				}
-			}
+	s.dispatcher.commandFlags(path, cmd)
 
-			// Add positional arguments in the correct order
-			// We need to order them based on their position indices
-			if len(positionalFields) > 0 {
-				orderedPositional := make([]string, len(positionalFields))
-				for i, field := range positionalFields {
-					paramName := strings.ToLower(field.Name)
-					if val, ok := params.Arguments[paramName]; ok {
-						orderedPositional[i] = fmt.Sprintf("%v", val)
-					}
-				}
-				args = append(args, orderedPositional...)
-			}
+	// Reject arguments that don't match the tool's input schema
+	if err := validateToolArguments(s.buildToolSchema(cmd), params.Arguments); err != nil {
+		s.sendErrorResponse(request.ID, -32602, "Invalid params", err.Error())
+		return
+	}
 
-			// Add rest arguments at the end
-			if posArgs, ok := params.Arguments["arguments"].([]interface{}); ok {
-				for _, arg := range posArgs {
-					args = append(args, fmt.Sprintf("%v", arg))
-				}
+	// Build command arguments from the tool call parameters. The command's FlagSet
+	// is shared across calls, so reset it first to keep values from a previous
+	// call from leaking into this one.
+	var args []string
+	if fs := cmd.FlagSet(); fs != nil {
+		if err := fs.Reset(); err != nil {
+			s.sendErrorResponse(request.ID, -32603, "Internal error", err.Error())
+			return
+		}
+		if params.Arguments != nil {
+			var err error
+			args, err = fs.ArgsFromMap(params.Arguments)
+			if err != nil {
+				s.sendErrorResponse(request.ID, -32602, "Invalid params", err.Error())
+				return
 			}
 		}
 	}
 
-	// Capture output by replacing stdout temporarily
-	oldStdout := os.Stdout
-	oldStderr := os.Stderr
-
-	// Create buffers to capture output
+	// Execute the command (dispatcher expects command name and then args),
+	// capturing its output
 	var stdoutBuf, stderrBuf bytes.Buffer
+	cmdArgs := append([]string{path}, args...)
+	// Recover from panics so one failing tool doesn't stop the server, and keep
+	// help and version output off the protocol stream
+	ex := execution{
+		ctx:           ctx,
+		out:           &stdoutBuf,
+		stdout:        &stdoutBuf,
+		stderr:        &stderrBuf,
+		recoverPanics: true,
+	}
+	var err error
+	switch cmd.(type) {
+	case OutputWriter, ContextOutputWriter:
+		err = s.dispatcher.execute(cmdArgs, ex)
+	default:
+		err = captureProcessOutput(&stdoutBuf, &stderrBuf, func() error {
+			return s.dispatcher.execute(cmdArgs, ex)
+		})
+	}
 
-	// Create fake file descriptors
-	stdoutR, stdoutW, _ := os.Pipe()
-	stderrR, stderrW, _ := os.Pipe()
-
-	os.Stdout = stdoutW
-	os.Stderr = stderrW
-
-	// Start goroutines to read from pipes
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		defer wg.Done()
-		io.Copy(&stdoutBuf, stdoutR)
-	}()
-
-	go func() {
-		defer wg.Done()
-		io.Copy(&stderrBuf, stderrR)
-	}()
-
-	// Execute the command (dispatcher expects command name and then args)
-	err := s.dispatcher.Execute(append([]string{params.Name}, args...))
-
-	// Close write ends of pipes
-	stdoutW.Close()
-	stderrW.Close()
-
-	// Wait for readers to finish
-	wg.Wait()
-
-	// Restore original stdout/stderr
-	os.Stdout = oldStdout
-	os.Stderr = oldStderr
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		fmt.Fprintf(s.errorOutput, "Tool %s panicked: %v\n%s", params.Name, panicErr.Value, panicErr.Stack)
+	}
 
 	// Prepare the response
 	var contents []Content
@@ -675,7 +984,14 @@ func (s *MCPServer) handleToolCall(request MCPRequest) {
 			Type:     "text",
 			Text:     output,
 			Data:     json.RawMessage(output),
-			MimeType: "application/json",
+			MimeType: outputFormat.MimeType(),
+		})
+	} else if mimeType := outputFormat.MimeType(); mimeType != "" && outputFormat != OutputFormatJSON && err == nil {
+		// For other structured formats, label the text with their MIME type
+		contents = append(contents, Content{
+			Type:     "text",
+			Text:     output,
+			MimeType: mimeType,
 		})
 	} else {
 		// For text output
@@ -693,6 +1009,123 @@ func (s *MCPServer) handleToolCall(request MCPRequest) {
 	s.sendResponse(request.ID, result)
 }
 
+// validateToolArguments checks that args provides every property schema requires
+// and that each known argument roughly matches its property's type. Strings are
+// accepted wherever the command line would parse them, such as "8080" for an
+// integer. All problems are reported together.
+func validateToolArguments(schema *InputSchema, args map[string]any) error {
+	var problems []string
+	for _, name := range schema.Required {
+		if _, ok := args[name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing required argument '%s'", name))
+		}
+	}
+
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop, ok := schema.Properties[name]
+		if !ok {
+			continue
+		}
+		if !argumentMatchesType(args[name], prop.Type) {
+			problems = append(problems, fmt.Sprintf("argument '%s' must be of type %s", name, prop.Type))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// argumentMatchesType reports whether the decoded JSON value v is acceptable
+// for a property of the given JSON schema type
+func argumentMatchesType(v any, typ string) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case string:
+		switch typ {
+		case "integer":
+			_, err := strconv.ParseInt(v, 10, 64)
+			return err == nil
+		case "number":
+			_, err := strconv.ParseFloat(v, 64)
+			return err == nil
+		case "boolean":
+			_, err := parseBool(v)
+			return err == nil
+		}
+		return true
+	case bool:
+		return typ == "boolean" || typ == "string"
+	case float64:
+		switch typ {
+		case "integer":
+			return v == math.Trunc(v)
+		case "number", "string":
+			return true
+		}
+		return false
+	case []any:
+		return typ == "array"
+	case map[string]any:
+		return typ == "object"
+	default:
+		return false
+	}
+}
+
+// captureProcessOutput runs fn with os.Stdout and os.Stderr redirected into
+// stdout and stderr. It is used for commands that don't implement OutputWriter;
+// since it swaps the process-wide streams, output from other goroutines is
+// captured too.
+func captureProcessOutput(stdout, stderr io.Writer, fn func() error) error {
+	oldStdout := os.Stdout
+	oldStderr := os.Stderr
+
+	// Create fake file descriptors
+	stdoutR, stdoutW, _ := os.Pipe()
+	stderrR, stderrW, _ := os.Pipe()
+
+	os.Stdout = stdoutW
+	os.Stderr = stderrW
+
+	// Start goroutines to read from pipes
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		io.Copy(stdout, stdoutR)
+	}()
+
+	go func() {
+		defer wg.Done()
+		io.Copy(stderr, stderrR)
+	}()
+
+	err := fn()
+
+	// Close write ends of pipes
+	stdoutW.Close()
+	stderrW.Close()
+
+	// Wait for readers to finish
+	wg.Wait()
+
+	// Restore original stdout/stderr
+	os.Stdout = oldStdout
+	os.Stderr = oldStderr
+
+	return err
+}
+
 // handleResourcesList handles the resources/list request
 func (s *MCPServer) handleResourcesList(request MCPRequest) {
 	if !s.initialized {
@@ -700,10 +1133,13 @@ func (s *MCPServer) handleResourcesList(request MCPRequest) {
 		return
 	}
 
-	// Return empty resources list
+	// Aggregate resources from all providers; the list is empty without any
 	result := ResourcesListResult{
 		Resources: []Resource{},
 	}
+	for _, p := range s.resources {
+		result.Resources = append(result.Resources, p.ListResources()...)
+	}
 
 	s.sendResponse(request.ID, result)
 }
@@ -715,9 +1151,47 @@ func (s *MCPServer) handleResourceRead(request MCPRequest) {
 		return
 	}
 
-	// Resources not implemented
-	s.sendErrorResponse(request.ID, -32601, "Method not implemented",
-		"Resource reading is not supported by this server")
+	if len(s.resources) == 0 {
+		// Resources not implemented
+		s.sendErrorResponse(request.ID, -32601, "Method not implemented",
+			"Resource reading is not supported by this server")
+		return
+	}
+
+	var params ResourceReadRequest
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		s.sendErrorResponse(request.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	// Read from the first provider that lists the URI
+	for _, p := range s.resources {
+		for _, r := range p.ListResources() {
+			if r.URI != params.URI {
+				continue
+			}
+
+			content, err := p.ReadResource(params.URI)
+			if err != nil {
+				s.sendErrorResponse(request.ID, -32603, "Internal error", err.Error())
+				return
+			}
+			if content.URI == "" {
+				content.URI = params.URI
+			}
+			if content.MimeType == "" {
+				content.MimeType = r.MimeType
+			}
+
+			s.sendResponse(request.ID, ResourceReadResult{
+				Contents: []Content{content},
+			})
+			return
+		}
+	}
+
+	s.sendErrorResponse(request.ID, -32602, "Resource not found",
+		fmt.Sprintf("No resource with URI '%s'", params.URI))
 }
 
 // handlePromptsList handles the prompts/list request
@@ -727,10 +1201,13 @@ func (s *MCPServer) handlePromptsList(request MCPRequest) {
 		return
 	}
 
-	// Return empty prompts list
+	// Aggregate prompts from all providers; the list is empty without any
 	result := PromptsListResult{
 		Prompts: []Prompt{},
 	}
+	for _, p := range s.prompts {
+		result.Prompts = append(result.Prompts, p.ListPrompts()...)
+	}
 
 	s.sendResponse(request.ID, result)
 }
@@ -742,37 +1219,72 @@ func (s *MCPServer) handlePromptGet(request MCPRequest) {
 		return
 	}
 
-	// Prompts not implemented
-	s.sendErrorResponse(request.ID, -32601, "Method not implemented",
-		"Prompt retrieval is not supported by this server")
+	if len(s.prompts) == 0 {
+		// Prompts not implemented
+		s.sendErrorResponse(request.ID, -32601, "Method not implemented",
+			"Prompt retrieval is not supported by this server")
+		return
+	}
+
+	var params PromptGetRequest
+	if err := json.Unmarshal(request.Params, &params); err != nil {
+		s.sendErrorResponse(request.ID, -32602, "Invalid params", err.Error())
+		return
+	}
+
+	// Render with the first provider that lists the prompt
+	for _, p := range s.prompts {
+		for _, prompt := range p.ListPrompts() {
+			if prompt.Name != params.Name {
+				continue
+			}
+
+			for _, arg := range prompt.Arguments {
+				if _, ok := params.Arguments[arg.Name]; arg.Required && !ok {
+					s.sendErrorResponse(request.ID, -32602, "Invalid params",
+						fmt.Sprintf("Missing required argument '%s'", arg.Name))
+					return
+				}
+			}
+
+			contents, err := p.GetPrompt(params.Name, params.Arguments)
+			if err != nil {
+				s.sendErrorResponse(request.ID, -32603, "Internal error", err.Error())
+				return
+			}
+
+			result := PromptGetResult{
+				Description: prompt.Description,
+				Messages:    []PromptMessage{},
+			}
+			for _, content := range contents {
+				result.Messages = append(result.Messages, PromptMessage{
+					Role:    "user",
+					Content: content,
+				})
+			}
+
+			s.sendResponse(request.ID, result)
+			return
+		}
+	}
+
+	s.sendErrorResponse(request.ID, -32602, "Prompt not found",
+		fmt.Sprintf("No prompt named '%s'", params.Name))
 }
 
 // sendResponse sends a successful JSON-RPC response
 func (s *MCPServer) sendResponse(id any, result interface{}) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	response := MCPResponse{
+	s.writeResponse(MCPResponse{
 		JSONRPC: "2.0",
 		ID:      id,
 		Result:  result,
-	}
-
-	data, err := json.Marshal(response)
-	if err != nil {
-		fmt.Fprintf(s.errorOutput, "Error marshaling response: %v\n", err)
-		return
-	}
-
-	fmt.Fprintln(s.output, string(data))
+	})
 }
 
 // sendErrorResponse sends an error JSON-RPC response
 func (s *MCPServer) sendErrorResponse(id any, code int, message string, data any) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	response := MCPResponse{
+	s.writeResponse(MCPResponse{
 		JSONRPC: "2.0",
 		ID:      id,
 		Error: &MCPError{
@@ -780,30 +1292,54 @@ func (s *MCPServer) sendErrorResponse(id any, code int, message string, data any
 			Message: message,
 			Data:    data,
 		},
+	})
+}
+
+// writeResponse writes response as a line of output, or adds it to the batch
+// being collected by handleBatch
+func (s *MCPServer) writeResponse(response MCPResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.batch != nil {
+		*s.batch = append(*s.batch, response)
+		return
 	}
 
-	responseData, err := json.Marshal(response)
+	data, err := json.Marshal(response)
 	if err != nil {
-		fmt.Fprintf(s.errorOutput, "Error marshaling error response: %v\n", err)
+		fmt.Fprintf(s.errorOutput, "Error marshaling response: %v\n", err)
 		return
 	}
 
-	fmt.Fprintln(s.output, string(responseData))
+	fmt.Fprintln(s.output, string(data))
 }
 
 // MCPServerCommand creates a command that runs the dispatcher as an MCP server
 type MCPServerCommand struct {
 	dispatcher *Dispatcher
 	flags      *FlagSet
+	opts       []MCPServerOption
 }
 
-// NewMCPServerCommand creates a new MCP server command
-func NewMCPServerCommand(dispatcher *Dispatcher) *MCPServerCommand {
+// MCPServerOption is a functional option for configuring the server run by an MCPServerCommand
+type MCPServerOption func(*MCPServer)
+
+// WithServerInfo sets the name and version the server reports to clients
+func WithServerInfo(name, version string) MCPServerOption {
+	return func(s *MCPServer) {
+		s.SetServerInfo(name, version)
+	}
+}
+
+// NewMCPServerCommand creates a new MCP server command with the given options
+func NewMCPServerCommand(dispatcher *Dispatcher, opts ...MCPServerOption) *MCPServerCommand {
 	fs := NewFlagSet("mcp-server")
 
 	return &MCPServerCommand{
 		dispatcher: dispatcher,
 		flags:      fs,
+		opts:       opts,
 	}
 }
 
@@ -815,6 +1351,9 @@ func (c *MCPServerCommand) FlagSet() *FlagSet {
 // Run executes the MCP server
 func (c *MCPServerCommand) Run(fs *FlagSet, args []string) error {
 	server := NewMCPServer(c.dispatcher)
+	for _, opt := range c.opts {
+		opt(server)
+	}
 	return server.Run()
 }
 
@@ -2,10 +2,14 @@ package mflags
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -780,3 +784,1377 @@ func TestMCPServerPositionalArgsSchema(t *testing.T) {
 	assert.Equal(t, "array", execArgsProp.Type)
 	assert.Equal(t, "Additional command arguments", execArgsProp.Description)
 }
+
+func TestMCPServerChoicesSchema(t *testing.T) {
+	fs := NewFlagSet("log")
+	fs.String("level", 0, "info", "log level")
+	fs.SetChoices("level", []string{"debug", "info"})
+	fs.String("message", 'm', "", "message")
+
+	cmd := NewCommand(fs,
+		func(flags *FlagSet, args []string) error { return nil },
+		WithUsage("Write a log line"))
+
+	server := NewMCPServer(NewDispatcher("testapp"))
+	schema := server.buildToolSchema(cmd)
+
+	assert.Equal(t, []string{"debug", "info"}, schema.Properties["level"].Enum)
+	assert.Nil(t, schema.Properties["message"].Enum)
+}
+
+func TestMCPServerVersionFromDispatcher(t *testing.T) {
+	d := NewDispatcher("testapp")
+	d.SetVersion("2.5.0\ncommit: abc123")
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	initRequest := MCPRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "initialize",
+		Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+	}
+	requestBytes, _ := json.Marshal(initRequest)
+	input.WriteString(string(requestBytes) + "\n")
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	var response MCPResponse
+	err = json.Unmarshal([]byte(strings.Split(output.String(), "\n")[0]), &response)
+	require.NoError(t, err)
+
+	var result InitializeResult
+	resultBytes, _ := json.Marshal(response.Result)
+	err = json.Unmarshal(resultBytes, &result)
+	require.NoError(t, err)
+
+	assert.Equal(t, "2.5.0", result.ServerInfo.Version)
+}
+
+func TestMCPServerNetworkSchema(t *testing.T) {
+	fs := NewFlagSet("serve")
+	fs.IP("bind", 0, nil, "bind address")
+	fs.IPNet("allow", 0, net.IPNet{}, "allowed network")
+
+	cmd := NewCommand(fs, func(flags *FlagSet, args []string) error { return nil })
+	server := NewMCPServer(NewDispatcher("testapp"))
+	schema := server.buildToolSchema(cmd)
+
+	assert.Equal(t, "string", schema.Properties["bind"].Type)
+	assert.Contains(t, schema.Properties["bind"].Description, "IP address")
+	assert.Equal(t, "string", schema.Properties["allow"].Type)
+	assert.Contains(t, schema.Properties["allow"].Description, "CIDR")
+}
+
+func TestMCPServerToolCallResetsFlags(t *testing.T) {
+	d := NewDispatcher("testapp")
+
+	fs := NewFlagSet("greet")
+	loud := fs.Bool("loud", 'l', false, "shout the greeting")
+	name := fs.String("name", 'n', "world", "who to greet")
+
+	cmd := NewCommand(fs, func(flags *FlagSet, args []string) error {
+		greeting := "hello " + *name
+		if *loud {
+			greeting = strings.ToUpper(greeting)
+		}
+		fmt.Print(greeting)
+		return nil
+	})
+	d.Dispatch("greet", cmd)
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "greet", "arguments": {"loud": true, "name": "mcp"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      3,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "greet", "arguments": {}}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 3)
+
+	var texts []string
+	for _, line := range lines[1:3] {
+		var response MCPResponse
+		err = json.Unmarshal([]byte(line), &response)
+		require.NoError(t, err)
+
+		var result ToolCallResult
+		resultBytes, _ := json.Marshal(response.Result)
+		err = json.Unmarshal(resultBytes, &result)
+		require.NoError(t, err)
+		require.Len(t, result.Content, 1)
+		texts = append(texts, result.Content[0].Text)
+	}
+
+	assert.Equal(t, []string{"HELLO MCP", "hello world"}, texts)
+}
+
+func TestMCPServerToolCallOutputWriter(t *testing.T) {
+	d := NewDispatcher("testapp")
+	d.Dispatch("greet", &writerCommand{fs: NewFlagSet("greet")})
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "greet", "arguments": {"arguments": ["mcp"]}}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+
+	var response MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &response)
+	require.NoError(t, err)
+
+	var result ToolCallResult
+	resultBytes, _ := json.Marshal(response.Result)
+	err = json.Unmarshal(resultBytes, &result)
+	require.NoError(t, err)
+
+	require.Len(t, result.Content, 1)
+	assert.Equal(t, "hello mcp\ndone", result.Content[0].Text)
+}
+
+func TestMCPServerToolCallInferredResult(t *testing.T) {
+	type Config struct {
+		Name string `long:"name" usage:"Service name"`
+	}
+	type Status struct {
+		Name    string `json:"name"`
+		Healthy bool   `json:"healthy"`
+	}
+
+	d := NewDispatcher("testapp")
+	d.Dispatch("status", Infer(func(config *Config) (Status, error) {
+		return Status{Name: config.Name, Healthy: true}, nil
+	}))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "status", "arguments": {"name": "api"}}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+
+	var response MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &response)
+	require.NoError(t, err)
+
+	var result ToolCallResult
+	resultBytes, _ := json.Marshal(response.Result)
+	err = json.Unmarshal(resultBytes, &result)
+	require.NoError(t, err)
+
+	assert.False(t, result.IsError)
+	require.Len(t, result.Content, 1)
+	assert.Equal(t, "application/json", result.Content[0].MimeType)
+
+	var status Status
+	err = json.Unmarshal(result.Content[0].Data, &status)
+	require.NoError(t, err)
+	assert.Equal(t, Status{Name: "api", Healthy: true}, status)
+}
+
+func TestMCPServerToolCallRecoversPanic(t *testing.T) {
+	d := NewDispatcher("testapp")
+	d.Dispatch("crash", NewCommand(NewFlagSet("crash"), func(fs *FlagSet, args []string) error {
+		fmt.Println("starting")
+		panic("boom")
+	}))
+	d.Dispatch("ok", NewCommand(NewFlagSet("ok"), func(fs *FlagSet, args []string) error {
+		fmt.Print("fine")
+		return nil
+	}))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	errOutput := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+	server.SetErrorOutput(errOutput)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{JSONRPC: "2.0", ID: 2, Method: "tools/call", Params: json.RawMessage(`{"name": "crash"}`)},
+		{JSONRPC: "2.0", ID: 3, Method: "tools/call", Params: json.RawMessage(`{"name": "ok"}`)},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 3)
+
+	results := make([]ToolCallResult, 2)
+	for i := range results {
+		var response MCPResponse
+		err = json.Unmarshal([]byte(lines[i+1]), &response)
+		require.NoError(t, err)
+		resultBytes, _ := json.Marshal(response.Result)
+		err = json.Unmarshal(resultBytes, &results[i])
+		require.NoError(t, err)
+	}
+
+	// The panic becomes an error result, and the server keeps handling calls
+	assert.True(t, results[0].IsError)
+	assert.Equal(t, "starting\n\ncommand panicked: boom", results[0].Content[0].Text)
+	assert.False(t, results[1].IsError)
+	assert.Equal(t, "fine", results[1].Content[0].Text)
+	assert.Contains(t, errOutput.String(), "Tool crash panicked: boom")
+
+	// Recovery is a per-call option, so the dispatcher's own setting is untouched
+	assert.False(t, d.recoverPanics)
+	assert.Panics(t, func() { _ = d.Execute([]string{"crash"}) })
+}
+
+// staticResources is a ResourceProvider serving fixed text resources
+type staticResources map[string]string
+
+func (r staticResources) ListResources() []Resource {
+	var resources []Resource
+	for uri := range r {
+		resources = append(resources, Resource{URI: uri, Name: uri, MimeType: "text/plain"})
+	}
+	return resources
+}
+
+func (r staticResources) ReadResource(uri string) (Content, error) {
+	return Content{Type: "text", Text: r[uri]}, nil
+}
+
+func TestMCPServerResourceProvider(t *testing.T) {
+	d := NewDispatcher("testapp")
+	server := NewMCPServer(d)
+	server.RegisterResourceProvider(staticResources{"file:///motd": "welcome"})
+
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "resources/list",
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      3,
+			Method:  "resources/read",
+			Params:  json.RawMessage(`{"uri": "file:///motd"}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      4,
+			Method:  "resources/read",
+			Params:  json.RawMessage(`{"uri": "file:///missing"}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 4)
+
+	// Check resources/list response
+	var listResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &listResponse)
+	require.NoError(t, err)
+	assert.Nil(t, listResponse.Error)
+
+	var listResult ResourcesListResult
+	resultBytes, _ := json.Marshal(listResponse.Result)
+	err = json.Unmarshal(resultBytes, &listResult)
+	require.NoError(t, err)
+	require.Len(t, listResult.Resources, 1)
+	assert.Equal(t, "file:///motd", listResult.Resources[0].URI)
+
+	// Check resources/read response
+	var readResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[2]), &readResponse)
+	require.NoError(t, err)
+	assert.Nil(t, readResponse.Error)
+
+	var readResult ResourceReadResult
+	resultBytes, _ = json.Marshal(readResponse.Result)
+	err = json.Unmarshal(resultBytes, &readResult)
+	require.NoError(t, err)
+	require.Len(t, readResult.Contents, 1)
+	assert.Equal(t, "file:///motd", readResult.Contents[0].URI)
+	assert.Equal(t, "text/plain", readResult.Contents[0].MimeType)
+	assert.Equal(t, "welcome", readResult.Contents[0].Text)
+
+	// Unknown URIs are reported as errors
+	var missingResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[3]), &missingResponse)
+	require.NoError(t, err)
+	require.NotNil(t, missingResponse.Error)
+	assert.Equal(t, "Resource not found", missingResponse.Error.Message)
+}
+
+// reviewPrompts is a PromptProvider with a single code review prompt
+type reviewPrompts struct{}
+
+func (reviewPrompts) ListPrompts() []Prompt {
+	return []Prompt{{
+		Name:        "review",
+		Description: "Review a file",
+		Arguments:   []Argument{{Name: "file", Required: true}},
+	}}
+}
+
+func (reviewPrompts) GetPrompt(name string, args map[string]string) ([]Content, error) {
+	return []Content{{Type: "text", Text: "Please review " + args["file"]}}, nil
+}
+
+func TestMCPServerPromptProvider(t *testing.T) {
+	d := NewDispatcher("testapp")
+	server := NewMCPServer(d)
+	server.RegisterPromptProvider(reviewPrompts{})
+
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "prompts/list",
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      3,
+			Method:  "prompts/get",
+			Params:  json.RawMessage(`{"name": "review", "arguments": {"file": "main.go"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      4,
+			Method:  "prompts/get",
+			Params:  json.RawMessage(`{"name": "review"}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      5,
+			Method:  "prompts/get",
+			Params:  json.RawMessage(`{"name": "missing"}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 5)
+
+	// Check prompts/list response
+	var listResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &listResponse)
+	require.NoError(t, err)
+	assert.Nil(t, listResponse.Error)
+
+	var listResult PromptsListResult
+	resultBytes, _ := json.Marshal(listResponse.Result)
+	err = json.Unmarshal(resultBytes, &listResult)
+	require.NoError(t, err)
+	require.Len(t, listResult.Prompts, 1)
+	assert.Equal(t, "review", listResult.Prompts[0].Name)
+
+	// Check prompts/get response
+	var getResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[2]), &getResponse)
+	require.NoError(t, err)
+	assert.Nil(t, getResponse.Error)
+
+	var getResult PromptGetResult
+	resultBytes, _ = json.Marshal(getResponse.Result)
+	err = json.Unmarshal(resultBytes, &getResult)
+	require.NoError(t, err)
+	assert.Equal(t, "Review a file", getResult.Description)
+	require.Len(t, getResult.Messages, 1)
+	assert.Equal(t, "user", getResult.Messages[0].Role)
+	assert.Equal(t, "Please review main.go", getResult.Messages[0].Content.Text)
+
+	// Missing required arguments and unknown prompts are errors
+	var missingArgResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[3]), &missingArgResponse)
+	require.NoError(t, err)
+	require.NotNil(t, missingArgResponse.Error)
+	assert.Contains(t, missingArgResponse.Error.Data, "file")
+
+	var missingResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[4]), &missingResponse)
+	require.NoError(t, err)
+	require.NotNil(t, missingResponse.Error)
+	assert.Equal(t, "Prompt not found", missingResponse.Error.Message)
+}
+
+func TestMCPServerToolsListPagination(t *testing.T) {
+	d := NewDispatcher("testapp")
+	for _, name := range []string{"delta", "alpha", "echo", "charlie", "bravo"} {
+		d.Dispatch(name, NewCommand(NewFlagSet(name), nil))
+	}
+
+	server := NewMCPServer(d)
+	server.SetPageSize(2)
+	output := bytes.NewBuffer(nil)
+	server.SetOutput(output)
+
+	send := func(id int, method string, params string) MCPResponse {
+		input := bytes.NewBufferString("")
+		req := MCPRequest{JSONRPC: "2.0", ID: id, Method: method}
+		if params != "" {
+			req.Params = json.RawMessage(params)
+		}
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+		server.SetInput(input)
+		output.Reset()
+
+		err := server.Run()
+		require.NoError(t, err)
+
+		var response MCPResponse
+		err = json.Unmarshal([]byte(strings.Split(output.String(), "\n")[0]), &response)
+		require.NoError(t, err)
+		return response
+	}
+
+	send(1, "initialize", `{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`)
+
+	var names []string
+	cursor := ""
+	pages := 0
+	for {
+		params := ""
+		if cursor != "" {
+			params = fmt.Sprintf(`{"cursor": %q}`, cursor)
+		}
+		response := send(2, "tools/list", params)
+		require.Nil(t, response.Error)
+
+		var result ToolsListResult
+		resultBytes, _ := json.Marshal(response.Result)
+		err := json.Unmarshal(resultBytes, &result)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(result.Tools), 2)
+
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		pages++
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"alpha", "bravo", "charlie", "delta", "echo"}, names)
+
+	// Malformed cursors are rejected
+	response := send(3, "tools/list", `{"cursor": "not-a-cursor"}`)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, -32602, response.Error.Code)
+}
+
+func TestMCPServerToolsListSorted(t *testing.T) {
+	d := NewDispatcher("testapp")
+	expected := []string{"build", "deploy", "lint", "run", "test", "version"}
+	for _, name := range []string{"version", "test", "run", "lint", "deploy", "build"} {
+		d.Dispatch(name, NewCommand(NewFlagSet(name), nil))
+	}
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	initRequest := MCPRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "initialize",
+		Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+	}
+	requestBytes, _ := json.Marshal(initRequest)
+	input.WriteString(string(requestBytes) + "\n")
+
+	for i := 0; i < 5; i++ {
+		listRequest := MCPRequest{
+			JSONRPC: "2.0",
+			ID:      i + 2,
+			Method:  "tools/list",
+		}
+		requestBytes, _ = json.Marshal(listRequest)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 6)
+
+	for _, line := range lines[1:] {
+		var response MCPResponse
+		err = json.Unmarshal([]byte(line), &response)
+		require.NoError(t, err)
+
+		var result ToolsListResult
+		resultBytes, _ := json.Marshal(response.Result)
+		err = json.Unmarshal(resultBytes, &result)
+		require.NoError(t, err)
+
+		var names []string
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		assert.Equal(t, expected, names)
+	}
+}
+
+// annotatedCommand is a Command that advertises MCP tool annotations
+type annotatedCommand struct {
+	Command
+}
+
+func (annotatedCommand) ToolAnnotations() ToolAnnotation {
+	return ToolAnnotation{ReadOnlyHint: true, IdempotentHint: true}
+}
+
+func TestMCPServerToolAnnotations(t *testing.T) {
+	d := NewDispatcher("testapp")
+	d.Dispatch("status", annotatedCommand{NewCommand(NewFlagSet("status"), nil)})
+	d.Dispatch("delete", NewCommand(NewFlagSet("delete"), nil))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/list",
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+
+	var raw struct {
+		Result struct {
+			Tools []map[string]json.RawMessage `json:"tools"`
+		} `json:"result"`
+	}
+	err = json.Unmarshal([]byte(lines[1]), &raw)
+	require.NoError(t, err)
+	require.Len(t, raw.Result.Tools, 2)
+
+	// Tools are sorted, so delete comes first and has no annotations
+	assert.NotContains(t, raw.Result.Tools[0], "annotations")
+	assert.JSONEq(t, `{"readOnlyHint": true, "destructiveHint": false, "idempotentHint": true}`,
+		string(raw.Result.Tools[1]["annotations"]))
+}
+
+func TestMCPServerToolCallMimeType(t *testing.T) {
+	assert.Equal(t, "application/json", OutputFormatJSON.MimeType())
+	assert.Equal(t, "application/yaml", OutputFormatYAML.MimeType())
+	assert.Equal(t, "", OutputFormatRaw.MimeType())
+	assert.Equal(t, "", OutputFormat("unknown").MimeType())
+
+	d := NewDispatcher("testapp")
+	d.Dispatch("yaml", NewCommand(NewFlagSet("yaml"), func(fs *FlagSet, args []string) error {
+		fmt.Print("name: test\n")
+		return nil
+	}, WithOutputFormat(OutputFormatYAML)))
+	d.Dispatch("raw", NewCommand(NewFlagSet("raw"), func(fs *FlagSet, args []string) error {
+		fmt.Print("plain")
+		return nil
+	}))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "yaml"}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      3,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "raw"}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 3)
+
+	var contents []Content
+	for _, line := range lines[1:3] {
+		var response MCPResponse
+		err = json.Unmarshal([]byte(line), &response)
+		require.NoError(t, err)
+
+		var result ToolCallResult
+		resultBytes, _ := json.Marshal(response.Result)
+		err = json.Unmarshal(resultBytes, &result)
+		require.NoError(t, err)
+		require.Len(t, result.Content, 1)
+		contents = append(contents, result.Content[0])
+	}
+
+	assert.Equal(t, "name: test\n", contents[0].Text)
+	assert.Equal(t, "application/yaml", contents[0].MimeType)
+	assert.Equal(t, "plain", contents[1].Text)
+	assert.Empty(t, contents[1].MimeType)
+}
+
+func TestMCPServerPositionalDescriptions(t *testing.T) {
+	type deployConfig struct {
+		Environment string `position:"0" usage:"Deployment environment"`
+		Version     string `position:"1"`
+	}
+
+	fs := NewFlagSet("deploy")
+	err := fs.FromStruct(&deployConfig{})
+	require.NoError(t, err)
+
+	var host string
+	fs.StringPosVar(&host, "Host", 2, "", "Target host")
+
+	server := NewMCPServer(NewDispatcher("testapp"))
+	schema := server.buildToolSchema(NewCommand(fs, nil))
+
+	assert.Equal(t, "Deployment environment", schema.Properties["environment"].Description)
+	assert.Equal(t, "Positional argument Version", schema.Properties["version"].Description)
+	assert.Equal(t, "Target host", schema.Properties["host"].Description)
+}
+
+func TestMCPServerRequiredFlagsSchema(t *testing.T) {
+	type createConfig struct {
+		Name   string `long:"name" required:"true" usage:"Resource name"`
+		Region string `long:"region" usage:"Region"`
+		Target string `position:"0" usage:"Target"`
+	}
+
+	fs := NewFlagSet("create")
+	err := fs.FromStruct(&createConfig{})
+	require.NoError(t, err)
+	fs.String("token", 0, "", "API token")
+	fs.Required("token")
+
+	server := NewMCPServer(NewDispatcher("testapp"))
+	schema := server.buildToolSchema(NewCommand(fs, nil))
+
+	assert.ElementsMatch(t, []string{"name", "token", "target"}, schema.Required)
+	assert.NotContains(t, schema.Required, "region")
+}
+
+func TestMCPServerServerInfo(t *testing.T) {
+	d := NewDispatcher("testapp")
+	d.SetVersion("2.5.0")
+
+	server := NewMCPServer(d)
+	assert.Equal(t, Implementation{Name: "mflags-mcp-server", Version: "2.5.0"}, server.info())
+
+	server.SetServerInfo("myapp", "")
+	assert.Equal(t, Implementation{Name: "myapp", Version: "2.5.0"}, server.info())
+
+	// An explicit version wins over the dispatcher's
+	server.SetServerInfo("", "3.0.0")
+	assert.Equal(t, Implementation{Name: "myapp", Version: "3.0.0"}, server.info())
+
+	// The option applies the same settings to the command's server
+	cmd := NewMCPServerCommand(d, WithServerInfo("other", "0.1.0"))
+	server = NewMCPServer(d)
+	for _, opt := range cmd.opts {
+		opt(server)
+	}
+	assert.Equal(t, Implementation{Name: "other", Version: "0.1.0"}, server.info())
+}
+
+func TestMCPServerVersionNegotiation(t *testing.T) {
+	tests := []struct {
+		name      string
+		supported []string
+		requested string
+		expected  string
+	}{
+		{"default version", nil, MCPProtocolVersion, MCPProtocolVersion},
+		{"exact match", []string{"2024-11-05", "2025-03-26", "2025-06-18"}, "2025-03-26", "2025-03-26"},
+		{"newer client", []string{"2024-11-05", "2025-03-26"}, "2025-06-18", "2025-03-26"},
+		{"older client", []string{"2025-03-26", "2025-06-18"}, "2024-11-05", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewMCPServer(NewDispatcher("testapp"))
+			if tt.supported != nil {
+				server.SetSupportedVersions(tt.supported...)
+			}
+			input := bytes.NewBufferString("")
+			output := bytes.NewBuffer(nil)
+			server.SetInput(input)
+			server.SetOutput(output)
+
+			initRequest := MCPRequest{
+				JSONRPC: "2.0",
+				ID:      1,
+				Method:  "initialize",
+				Params:  json.RawMessage(fmt.Sprintf(`{"protocolVersion": %q, "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`, tt.requested)),
+			}
+			requestBytes, _ := json.Marshal(initRequest)
+			input.WriteString(string(requestBytes) + "\n")
+
+			err := server.Run()
+			assert.NoError(t, err)
+
+			var response MCPResponse
+			err = json.Unmarshal([]byte(strings.Split(output.String(), "\n")[0]), &response)
+			require.NoError(t, err)
+
+			if tt.expected == "" {
+				require.NotNil(t, response.Error)
+				assert.Equal(t, "Unsupported protocol version", response.Error.Message)
+				data, _ := json.Marshal(response.Error.Data)
+				assert.JSONEq(t, fmt.Sprintf(`{"supported": ["2025-03-26", "2025-06-18"], "requested": %q}`, tt.requested), string(data))
+				return
+			}
+
+			require.Nil(t, response.Error)
+			var result InitializeResult
+			resultBytes, _ := json.Marshal(response.Result)
+			err = json.Unmarshal(resultBytes, &result)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.ProtocolVersion)
+		})
+	}
+}
+
+func TestMCPServerRunContextCancel(t *testing.T) {
+	server := NewMCPServer(NewDispatcher("testapp"))
+
+	// The pipe never reaches EOF, so only cancellation can stop the server
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	server.SetInput(pr)
+	server.SetOutput(io.Discard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.RunContext(ctx)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("RunContext did not return after cancellation")
+	}
+}
+
+func TestMCPServerToolCallContext(t *testing.T) {
+	type ctxKey struct{}
+	type lookupConfig struct{}
+
+	// A tool returning a value writes it through ContextOutputWriter, and still
+	// receives the server's context
+	d := NewDispatcher("testapp")
+	d.Dispatch("lookup", Infer(func(ctx context.Context, config *lookupConfig) (any, error) {
+		return ctx.Value(ctxKey{}), nil
+	}))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	input.WriteString(`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}}` + "\n")
+	input.WriteString(`{"jsonrpc": "2.0", "id": 2, "method": "tools/call", "params": {"name": "lookup", "arguments": {}}}` + "\n")
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "from-server")
+	require.NoError(t, server.RunContext(ctx))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var response MCPResponse
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &response))
+	require.Nil(t, response.Error)
+
+	var result ToolCallResult
+	resultJSON, _ := json.Marshal(response.Result)
+	require.NoError(t, json.Unmarshal(resultJSON, &result))
+	assert.False(t, result.IsError)
+	require.Len(t, result.Content, 1)
+	assert.Contains(t, result.Content[0].Text, "from-server")
+}
+
+func TestMCPServerBatchRequests(t *testing.T) {
+	d := NewDispatcher("testapp")
+	d.Dispatch("echo", NewCommand(NewFlagSet("echo"), nil))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	input.WriteString(`[` +
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}},` +
+		`{"jsonrpc": "2.0", "method": "notifications/initialized"},` +
+		`{"jsonrpc": "2.0", "id": 2, "method": "tools/list"},` +
+		`{"jsonrpc": "2.0", "id": 3, "method": "unknown/method"}` +
+		`]` + "\n")
+	// A batch of only notifications produces no output
+	input.WriteString(`[{"jsonrpc": "2.0", "method": "notifications/initialized"}]` + "\n")
+	input.WriteString(`[]` + "\n")
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var responses []MCPResponse
+	err = json.Unmarshal([]byte(lines[0]), &responses)
+	require.NoError(t, err)
+	require.Len(t, responses, 3)
+
+	assert.Equal(t, float64(1), responses[0].ID)
+	assert.Nil(t, responses[0].Error)
+	assert.Equal(t, float64(2), responses[1].ID)
+	assert.Nil(t, responses[1].Error)
+	assert.Equal(t, float64(3), responses[2].ID)
+	require.NotNil(t, responses[2].Error)
+	assert.Equal(t, -32601, responses[2].Error.Code)
+
+	// An empty batch is an invalid request
+	var emptyResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &emptyResponse)
+	require.NoError(t, err)
+	require.NotNil(t, emptyResponse.Error)
+	assert.Equal(t, -32600, emptyResponse.Error.Code)
+}
+
+func TestMCPServerBatchInvalidElements(t *testing.T) {
+	server := NewMCPServer(NewDispatcher("testapp"))
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	// Each invalid element gets its own error, and the valid ones still run
+	input.WriteString(`[1, ` +
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}},` +
+		`{"foo": "boo"}, "x"]` + "\n")
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 1)
+
+	var responses []MCPResponse
+	err = json.Unmarshal([]byte(lines[0]), &responses)
+	require.NoError(t, err)
+	require.Len(t, responses, 4)
+
+	for _, i := range []int{0, 2, 3} {
+		require.NotNil(t, responses[i].Error)
+		assert.Equal(t, -32600, responses[i].Error.Code)
+		assert.Nil(t, responses[i].ID)
+	}
+	assert.Equal(t, float64(1), responses[1].ID)
+	assert.Nil(t, responses[1].Error)
+}
+
+func TestMCPServerToolCallValidation(t *testing.T) {
+	type deployConfig struct {
+		Env      string `position:"0" usage:"Environment"`
+		Replicas int    `long:"replicas" usage:"Replica count"`
+		DryRun   bool   `long:"dry-run" usage:"Only print the plan"`
+	}
+
+	var ran int
+	fs := NewFlagSet("deploy")
+	err := fs.FromStruct(&deployConfig{})
+	require.NoError(t, err)
+
+	d := NewDispatcher("testapp")
+	d.Dispatch("deploy", NewCommand(fs, func(fs *FlagSet, args []string) error {
+		ran++
+		return nil
+	}))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "deploy", "arguments": {"replicas": 1.5, "dry-run": "maybe"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      3,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "deploy", "arguments": {"env": "prod", "replicas": "3", "dry-run": true}}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err = server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 3)
+
+	var invalidResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &invalidResponse)
+	require.NoError(t, err)
+	require.NotNil(t, invalidResponse.Error)
+	assert.Equal(t, -32602, invalidResponse.Error.Code)
+	assert.Equal(t, "missing required argument 'env'; argument 'dry-run' must be of type boolean; argument 'replicas' must be of type integer",
+		invalidResponse.Error.Data)
+
+	var validResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[2]), &validResponse)
+	require.NoError(t, err)
+	assert.Nil(t, validResponse.Error)
+	assert.Equal(t, 1, ran)
+}
+
+func TestMCPServerToolCallArrayFlags(t *testing.T) {
+	type tagConfig struct {
+		Tags  []string `long:"tags" usage:"Tags to apply"`
+		Ports []int    `long:"ports" usage:"Ports to open"`
+	}
+
+	config := &tagConfig{}
+	fs := NewFlagSet("tag")
+	err := fs.FromStruct(config)
+	require.NoError(t, err)
+
+	var tags []string
+	var ports []int
+	d := NewDispatcher("testapp")
+	d.Dispatch("tag", NewCommand(fs, func(fs *FlagSet, args []string) error {
+		tags = config.Tags
+		ports = config.Ports
+		return nil
+	}))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "tag", "arguments": {"tags": ["web", "prod", "eu"], "ports": [80, 443]}}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err = server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+
+	var response MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &response)
+	require.NoError(t, err)
+	assert.Nil(t, response.Error)
+
+	var result ToolCallResult
+	resultBytes, _ := json.Marshal(response.Result)
+	err = json.Unmarshal(resultBytes, &result)
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	assert.Equal(t, []string{"web", "prod", "eu"}, tags)
+	assert.Equal(t, []int{80, 443}, ports)
+}
+
+func TestMCPServerToolCallMapFlags(t *testing.T) {
+	type labelConfig struct {
+		Labels map[string]string `long:"labels" usage:"Labels to apply"`
+	}
+
+	config := &labelConfig{}
+	fs := NewFlagSet("label")
+	err := fs.FromStruct(config)
+	require.NoError(t, err)
+
+	var labels map[string]string
+	d := NewDispatcher("testapp")
+	d.Dispatch("label", NewCommand(fs, func(fs *FlagSet, args []string) error {
+		labels = config.Labels
+		return nil
+	}))
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "label", "arguments": {"labels": {"a": "b", "env": "prod"}}}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err = server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+
+	var response MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &response)
+	require.NoError(t, err)
+	assert.Nil(t, response.Error)
+
+	var result ToolCallResult
+	resultBytes, _ := json.Marshal(response.Result)
+	err = json.Unmarshal(resultBytes, &result)
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	assert.Equal(t, map[string]string{"a": "b", "env": "prod"}, labels)
+}
+
+func TestMCPServerToolCallHelpOutput(t *testing.T) {
+	fs := NewFlagSet("greet")
+	fs.String("name", 0, "", "name to greet")
+
+	d := NewDispatcher("testapp")
+	d.Dispatch("greet", &writerCommand{fs: fs})
+	var dispatcherOut bytes.Buffer
+	d.SetOutput(&dispatcherOut)
+
+	server := NewMCPServer(d)
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	// A value that looks like a help flag makes the dispatcher print help
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "greet", "arguments": {"name": "-h"}}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 2)
+
+	var response MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &response)
+	require.NoError(t, err)
+
+	var result ToolCallResult
+	resultBytes, _ := json.Marshal(response.Result)
+	err = json.Unmarshal(resultBytes, &result)
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Content)
+	assert.Contains(t, result.Content[0].Text, "Usage: testapp greet")
+	assert.Empty(t, dispatcherOut.String(), "help goes to the tool result, not the dispatcher output")
+}
+
+func TestMCPServerNestedToolNames(t *testing.T) {
+	var ran []string
+	record := func(path string) Command {
+		return NewCommand(NewFlagSet(path), func(fs *FlagSet, args []string) error {
+			ran = append(ran, path)
+			return nil
+		})
+	}
+
+	d := NewDispatcher("testapp")
+	d.Dispatch("status", record("status"))
+	d.Dispatch("db migrate up", record("db migrate up"))
+	d.Dispatch("db migrate", record("db migrate"))
+	d.Dispatch("db_migrate", record("db_migrate"))
+
+	server := NewMCPServer(d)
+	paths := server.toolPaths()
+	assert.Equal(t, map[string]string{
+		"status":        "status",
+		"db_migrate":    "db_migrate",
+		"db_migrate_2":  "db migrate",
+		"db_migrate_up": "db migrate up",
+	}, paths)
+
+	server.SetToolNameSeparator(".")
+	assert.Equal(t, "db migrate up", server.toolPaths()["db.migrate.up"])
+
+	input := bytes.NewBufferString("")
+	output := bytes.NewBuffer(nil)
+	server.SetInput(input)
+	server.SetOutput(output)
+
+	requests := []MCPRequest{
+		{
+			JSONRPC: "2.0",
+			ID:      1,
+			Method:  "initialize",
+			Params:  json.RawMessage(`{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "test", "version": "1.0"}}`),
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      2,
+			Method:  "tools/list",
+		},
+		{
+			JSONRPC: "2.0",
+			ID:      3,
+			Method:  "tools/call",
+			Params:  json.RawMessage(`{"name": "db.migrate.up"}`),
+		},
+	}
+	for _, req := range requests {
+		requestBytes, _ := json.Marshal(req)
+		input.WriteString(string(requestBytes) + "\n")
+	}
+
+	err := server.Run()
+	assert.NoError(t, err)
+
+	lines := strings.Split(output.String(), "\n")
+	require.GreaterOrEqual(t, len(lines), 3)
+
+	var listResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[1]), &listResponse)
+	require.NoError(t, err)
+
+	var listResult ToolsListResult
+	resultBytes, _ := json.Marshal(listResponse.Result)
+	err = json.Unmarshal(resultBytes, &listResult)
+	require.NoError(t, err)
+
+	var names []string
+	for _, tool := range listResult.Tools {
+		names = append(names, tool.Name)
+	}
+	assert.Equal(t, []string{"db.migrate", "db.migrate.up", "db_migrate", "status"}, names)
+
+	var callResponse MCPResponse
+	err = json.Unmarshal([]byte(lines[2]), &callResponse)
+	require.NoError(t, err)
+	assert.Nil(t, callResponse.Error)
+	assert.Equal(t, []string{"db migrate up"}, ran)
+}
@@ -1,19 +1,124 @@
 package mflags
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"net/url"
+	"os"
 	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
 var (
-	ErrUnknownFlag  = errors.New("unknown flag")
-	ErrMissingValue = errors.New("flag needs an argument")
-	ErrInvalidValue = errors.New("invalid flag value")
-	ErrHelp         = errors.New("help requested")
+	ErrUnknownFlag   = errors.New("unknown flag")
+	ErrMissingValue  = errors.New("flag needs an argument")
+	ErrInvalidValue  = errors.New("invalid flag value")
+	ErrHelp          = errors.New("help requested")
+	ErrRequiredFlag  = errors.New("required flag not provided")
+	ErrAmbiguousFlag = errors.New("ambiguous flag")
+	ErrDuplicateFlag = errors.New("flag already defined")
+	ErrTooFewArgs    = errors.New("not enough arguments")
+	ErrTooManyArgs   = errors.New("too many arguments")
+)
+
+// ParseErrorKind identifies what went wrong with a flag during parsing
+type ParseErrorKind int
+
+const (
+	// ParseErrorUnknown means the flag is not defined
+	ParseErrorUnknown ParseErrorKind = iota
+	// ParseErrorMissing means the flag requires a value but none was given
+	ParseErrorMissing
+	// ParseErrorInvalid means the flag's value was rejected
+	ParseErrorInvalid
+	// ParseErrorAmbiguous means an abbreviated flag matches more than one flag
+	ParseErrorAmbiguous
+)
+
+// ValueSource identifies where a flag's value came from during the last Parse
+type ValueSource int
+
+const (
+	// SourceDefault means the flag kept its default value
+	SourceDefault ValueSource = iota
+	// SourceEnv means the value came from the flag's environment variable
+	SourceEnv
+	// SourceConfig means the value came from a config file
+	SourceConfig
+	// SourceFlag means the flag was given on the command line
+	SourceFlag
+)
+
+// String returns the lowercase name of the source, such as "env"
+func (s ValueSource) String() string {
+	switch s {
+	case SourceEnv:
+		return "env"
+	case SourceConfig:
+		return "config"
+	case SourceFlag:
+		return "flag"
+	default:
+		return "default"
+	}
+}
+
+// ParseError describes a failure to parse a command-line flag.
+// It matches ErrUnknownFlag, ErrMissingValue, ErrInvalidValue, or ErrAmbiguousFlag with errors.Is,
+// according to its Kind.
+type ParseError struct {
+	Flag string         // The flag as written on the command line, such as "--name" or "-n"
+	Kind ParseErrorKind // What went wrong
+	Err  error          // The underlying error from setting the value, if any
+}
+
+// sentinel returns the package error corresponding to the error's kind
+func (e *ParseError) sentinel() error {
+	switch e.Kind {
+	case ParseErrorMissing:
+		return ErrMissingValue
+	case ParseErrorInvalid:
+		return ErrInvalidValue
+	case ParseErrorAmbiguous:
+		return ErrAmbiguousFlag
+	default:
+		return ErrUnknownFlag
+	}
+}
+
+func (e *ParseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%v: %s: %v", e.sentinel(), e.Flag, e.Err)
+	}
+	return fmt.Sprintf("%v: %s", e.sentinel(), e.Flag)
+}
+
+// Unwrap returns the sentinel error for the kind and the underlying error, if any
+func (e *ParseError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.sentinel(), e.Err}
+	}
+	return []error{e.sentinel()}
+}
+
+// ErrorHandling defines how FlagSet.Parse behaves if the parse fails
+type ErrorHandling int
+
+const (
+	ContinueOnError ErrorHandling = iota // Return a descriptive error
+	ExitOnError                          // Print the error and call os.Exit(2), or os.Exit(0) for ErrHelp
+	PanicOnError                         // Call panic with a descriptive error
 )
 
 // PositionalField represents a positional argument field
@@ -21,6 +126,12 @@ type PositionalField struct {
 	Name  string        // Field name (e.g., "Command", "Target")
 	Value reflect.Value // The reflect.Value of the field
 	Type  reflect.Type  // The type of the field
+	Usage string        // Description of the argument, if any
+	Range bool          // Whether the field is a []string taking a span of arguments (position:"N..")
+
+	// Required makes Parse fail with ErrTooFewArgs when the argument is missing.
+	// FromStruct sets it for value fields; pointer fields are optional and stay nil.
+	Required bool
 }
 
 type FlagSet struct {
@@ -31,11 +142,34 @@ type FlagSet struct {
 	args              []string
 	parsed            bool
 	restField         *[]string                // Pointer to field marked with "rest" tag
+	restTyped         reflect.Value            // Non-string rest field, such as []int, filled by parsing each argument
+	restMin           int                      // Minimum number of non-flag arguments required with a rest field
+	restMax           int                      // Maximum number of non-flag arguments allowed with a rest field; 0 means no limit
+	restExcludesPos   bool                     // Whether the rest field leaves out arguments assigned to positional fields
+	strictArgs        bool                     // Whether Parse rejects arguments no positional or rest field takes
 	posFields         map[int]*PositionalField // Map of position to positional field info
 	allowUnknownFlags bool                     // If true, accumulate unknown flags instead of erroring
 	unknownFlags      []string                 // Accumulated unknown flags when allowUnknownFlags is true
 	unknownField      *[]string                // Pointer to field marked with "unknown" tag
+	passField         *[]string                // Pointer to field marked with "passthrough" tag
 	disableAutoHelp   bool                     // If true, don't automatically handle -h/--help in Parse
+	clock             func() time.Time         // Time source for relative time values; nil means time.Now
+	nameStyle         func(string) string      // Converts struct field names to long flag names in FromStruct
+	strictPositions   bool                     // If true, FromStruct requires position indices to be contiguous from 0
+	errorHandling     ErrorHandling            // How Parse behaves on error
+	out               io.Writer                // Destination for help and completion output; nil means os.Stdout
+	caseInsensitive   bool                     // Whether long flag names match regardless of case
+	normalizeName     func(string) string      // Applied to long names when defined and looked up; nil means none
+	allowAbbrev       bool                     // Whether long flags may be abbreviated to a unique prefix
+	noInterspersed    bool                     // Whether flag parsing stops at the first non-flag argument
+	dependencies      []flagDependency         // Constraints between flags checked after parsing
+	collectErrors     bool                     // Whether Parse continues past recoverable errors
+	errs              []error                  // Errors collected during the last Parse
+	allowUnknownKeys  bool                     // Whether ParseWithConfig ignores config keys that match no flag
+	groups            []string                 // Help sections in the order they were first assigned
+	expandArgsFiles   bool                     // Whether @path arguments are replaced by the file's contents
+	dashIndex         int                      // Index of the -- terminator in the last parsed arguments, or -1
+	strictRegister    bool                     // Whether defining a flag with a name or short form already in use fails
 }
 
 type Flag struct {
@@ -44,6 +178,65 @@ type Flag struct {
 	Usage    string
 	Value    Value
 	DefValue string
+
+	disabled  bool                // Experimental flag that has not been enabled; treated as unknown
+	directive CompletionDirective // How the shell should complete this flag's value
+	required  bool                // Parse fails if the flag is not provided
+	changed   bool                // Whether the flag was set during the last Parse
+	envKey    string              // Environment variable used when the flag is not provided
+	envSet    bool                // Whether the value came from the environment during the last Parse
+	configSet bool                // Whether the value came from a config file during the last Parse
+	validator func(string) error  // Optional check run on the raw value after a successful Set
+	choices   []string            // Allowed values; empty means any value is accepted
+	optional  bool                // Whether the value may be omitted; see StringOptional
+	ifPresent string              // Value of an optional flag given without one
+
+	completionFunc func(prefix string) []string // Suggests values when completing this flag
+	group          string                       // Help section; empty means the default "Options"
+	showDefault    bool                         // Whether help shows the default even when it is the zero value
+	origin         *Flag                        // Global or group flag this one was merged from, if any
+}
+
+// hasZeroDefault reports whether the flag's default is the zero value of its type
+func (flag *Flag) hasZeroDefault() bool {
+	switch flag.Value.(type) {
+	case *boolValue:
+		return flag.DefValue == "false"
+	case *intValue, *countValue, *int64Value, *uintValue, *uint64Value, *byteSizeValue:
+		return flag.DefValue == "0"
+	case *durationValue:
+		return flag.DefValue == time.Duration(0).String()
+	case *stringValue, *stringArrayValue, *intSliceValue, *float64SliceValue, *stringMapValue, *pointerValue:
+		return flag.DefValue == ""
+	}
+	return flag.DefValue == "" || flag.DefValue == "false" || flag.DefValue == "0"
+}
+
+// helpDefault returns the default to show in help output, or an empty string
+// if the default is the zero value and ShowDefault was not called for the flag
+func (flag *Flag) helpDefault() string {
+	if !flag.showDefault && flag.hasZeroDefault() {
+		return ""
+	}
+	if flag.DefValue == "" {
+		return `""`
+	}
+	return flag.DefValue
+}
+
+// set assigns value to the flag, checking it against the allowed choices
+// and running its validator, if any
+func (flag *Flag) set(value string) error {
+	if len(flag.choices) > 0 && !slices.Contains(flag.choices, value) {
+		return fmt.Errorf("%q is not a valid choice (valid choices: %s)", value, strings.Join(flag.choices, ", "))
+	}
+	if err := flag.Value.Set(value); err != nil {
+		return err
+	}
+	if flag.validator != nil {
+		return flag.validator(value)
+	}
+	return nil
 }
 
 type Value interface {
@@ -53,10 +246,31 @@ type Value interface {
 	Type() string
 }
 
+// Getter is a Value whose contents can be retrieved as a Go value, like flag.Getter
+// in the standard library. All built-in values implement it. DumpConfig uses it to
+// emit numbers, booleans, lists, and maps with their JSON types; other values are
+// emitted as their String form.
+type Getter interface {
+	Value
+	Get() any
+}
+
+// parseBool parses a boolean like strconv.ParseBool, also accepting yes/no,
+// on/off, and y/n in any case
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "yes", "y", "on":
+		return true, nil
+	case "no", "n", "off":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
 type boolValue bool
 
 func (b *boolValue) Set(s string) error {
-	v, err := strconv.ParseBool(s)
+	v, err := parseBool(s)
 	if err != nil {
 		return err
 	}
@@ -118,263 +332,1783 @@ func (i *intValue) Type() string {
 	return "int"
 }
 
-type stringArrayValue []string
+// countValue is an int that increments each time the flag is given, so -vvv yields 3.
+// An explicit value (e.g., --verbose=2) sets the count directly, and false, as for
+// boolean flags, resets it to zero.
+type countValue int
 
-func (s *stringArrayValue) Set(val string) error {
-	*s = strings.Split(val, ",")
+func (c *countValue) Set(s string) error {
+	switch s {
+	case "true":
+		*c++
+		return nil
+	case "false":
+		*c = 0
+		return nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*c = countValue(v)
 	return nil
 }
 
-func (s *stringArrayValue) String() string {
-	return strings.Join(*s, ",")
+func (c *countValue) String() string {
+	return strconv.Itoa(int(*c))
 }
 
-func (s *stringArrayValue) IsBool() bool {
-	return false
+func (c *countValue) IsBool() bool {
+	return true
 }
 
-func (s *stringArrayValue) Type() string {
-	return "value,..."
+func (c *countValue) Type() string {
+	return "count"
 }
 
-type durationValue time.Duration
+type int64Value int64
 
-func (d *durationValue) Set(s string) error {
-	v, err := time.ParseDuration(s)
+func (i *int64Value) Set(s string) error {
+	v, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
 		return err
 	}
-	*d = durationValue(v)
+	*i = int64Value(v)
 	return nil
 }
 
-func (d *durationValue) String() string {
-	return time.Duration(*d).String()
+func (i *int64Value) String() string {
+	return strconv.FormatInt(int64(*i), 10)
 }
 
-func (d *durationValue) IsBool() bool {
+func (i *int64Value) IsBool() bool {
 	return false
 }
 
-func (d *durationValue) Type() string {
-	return "duration"
+func (i *int64Value) Type() string {
+	return "int64"
 }
 
-// NewFlagSet returns a new, empty flag set with the specified name.
-// The name is used for error messages and help output.
-func NewFlagSet(name string) *FlagSet {
-	return &FlagSet{
-		name:      name,
-		flags:     make(map[string]*Flag),
-		shortMap:  make(map[rune]*Flag),
-		posFields: make(map[int]*PositionalField),
+type uintValue uint
+
+func (u *uintValue) Set(s string) error {
+	v, err := strconv.ParseUint(s, 10, strconv.IntSize)
+	if err != nil {
+		return err
 	}
+	*u = uintValue(v)
+	return nil
 }
 
-// BoolVar defines a bool flag with the specified name, short form, default value, and usage string.
-// The argument p points to a bool variable in which to store the value of the flag.
-func (f *FlagSet) BoolVar(p *bool, name string, short rune, value bool, usage string) {
-	*p = value
-	f.Var((*boolValue)(p), name, short, usage)
+func (u *uintValue) String() string {
+	return strconv.FormatUint(uint64(*u), 10)
 }
 
-// Bool defines a bool flag with the specified name, short form, default value, and usage string.
-// The return value is the address of a bool variable that stores the value of the flag.
-func (f *FlagSet) Bool(name string, short rune, value bool, usage string) *bool {
-	p := new(bool)
-	f.BoolVar(p, name, short, value, usage)
-	return p
+func (u *uintValue) IsBool() bool {
+	return false
 }
 
-// StringVar defines a string flag with the specified name, short form, default value, and usage string.
-// The argument p points to a string variable in which to store the value of the flag.
-func (f *FlagSet) StringVar(p *string, name string, short rune, value string, usage string) {
-	*p = value
-	f.Var((*stringValue)(p), name, short, usage)
+func (u *uintValue) Type() string {
+	return "uint"
 }
 
-// String defines a string flag with the specified name, short form, default value, and usage string.
-// The return value is the address of a string variable that stores the value of the flag.
-func (f *FlagSet) String(name string, short rune, value string, usage string) *string {
-	p := new(string)
-	f.StringVar(p, name, short, value, usage)
-	return p
+type uint64Value uint64
+
+func (u *uint64Value) Set(s string) error {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*u = uint64Value(v)
+	return nil
 }
 
-// IntVar defines an int flag with the specified name, short form, default value, and usage string.
-// The argument p points to an int variable in which to store the value of the flag.
-func (f *FlagSet) IntVar(p *int, name string, short rune, value int, usage string) {
-	*p = value
-	f.Var((*intValue)(p), name, short, usage)
+func (u *uint64Value) String() string {
+	return strconv.FormatUint(uint64(*u), 10)
 }
 
-// Int defines an int flag with the specified name, short form, default value, and usage string.
-// The return value is the address of an int variable that stores the value of the flag.
-func (f *FlagSet) Int(name string, short rune, value int, usage string) *int {
-	p := new(int)
-	f.IntVar(p, name, short, value, usage)
-	return p
+func (u *uint64Value) IsBool() bool {
+	return false
 }
 
-// StringArrayVar defines a string array flag with the specified name, short form, default value, and usage string.
-// The argument p points to a []string variable in which to store the value of the flag.
-// The flag value is expected to be a comma-separated list of strings.
-func (f *FlagSet) StringArrayVar(p *[]string, name string, short rune, value []string, usage string) {
-	if value != nil {
-		*p = value
-	} else {
-		*p = []string{}
-	}
-	f.Var((*stringArrayValue)(p), name, short, usage)
+func (u *uint64Value) Type() string {
+	return "uint64"
 }
 
-// StringArray defines a string array flag with the specified name, short form, default value, and usage string.
-// The return value is the address of a []string variable that stores the value of the flag.
-// The flag value is expected to be a comma-separated list of strings.
-func (f *FlagSet) StringArray(name string, short rune, value []string, usage string) *[]string {
-	p := new([]string)
-	f.StringArrayVar(p, name, short, value, usage)
-	return p
+// stringArrayValue holds a comma-separated list of strings. In append mode,
+// repeated occurrences accumulate within a single Parse: the first occurrence
+// replaces the default and later ones append, so --tags a,b --tags c yields [a b c].
+type stringArrayValue struct {
+	value      *[]string
+	sep        string // Separator between elements; empty means comma
+	appendMode bool
+	changed    bool
 }
 
-// DurationVar defines a time.Duration flag with the specified name, short form, default value, and usage string.
-// The argument p points to a time.Duration variable in which to store the value of the flag.
-// The flag accepts values parseable by time.ParseDuration.
-func (f *FlagSet) DurationVar(p *time.Duration, name string, short rune, value time.Duration, usage string) {
-	*p = value
-	f.Var((*durationValue)(p), name, short, usage)
+func (s *stringArrayValue) Set(val string) error {
+	parts := strings.Split(val, s.separator())
+	if s.appendMode && s.changed {
+		*s.value = append(*s.value, parts...)
+	} else {
+		*s.value = parts
+	}
+	s.changed = true
+	return nil
 }
 
-// Duration defines a time.Duration flag with the specified name, short form, default value, and usage string.
-// The return value is the address of a time.Duration variable that stores the value of the flag.
-// The flag accepts values parseable by time.ParseDuration.
-func (f *FlagSet) Duration(name string, short rune, value time.Duration, usage string) *time.Duration {
-	p := new(time.Duration)
-	f.DurationVar(p, name, short, value, usage)
-	return p
+func (s *stringArrayValue) String() string {
+	return strings.Join(*s.value, s.separator())
 }
 
-// BoolPosVar defines a bool positional argument at the specified position with a default value and usage string.
-// The argument p points to a bool variable in which to store the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) BoolPosVar(p *bool, name string, position int, value bool, usage string) {
-	*p = value
-	f.posFields[position] = &PositionalField{
-		Name:  name,
-		Value: reflect.ValueOf(p).Elem(),
-		Type:  reflect.TypeOf(*p),
+func (s *stringArrayValue) separator() string {
+	if s.sep == "" {
+		return ","
 	}
+	return s.sep
 }
 
-// BoolPos defines a bool positional argument at the specified position with a default value and usage string.
-// The return value is the address of a bool variable that stores the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) BoolPos(name string, position int, value bool, usage string) *bool {
-	p := new(bool)
-	f.BoolPosVar(p, name, position, value, usage)
-	return p
+func (s *stringArrayValue) resetParse() {
+	s.changed = false
 }
 
-// StringPosVar defines a string positional argument at the specified position with a default value and usage string.
-// The argument p points to a string variable in which to store the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) StringPosVar(p *string, name string, position int, value string, usage string) {
-	*p = value
-	f.posFields[position] = &PositionalField{
-		Name:  name,
-		Value: reflect.ValueOf(p).Elem(),
-		Type:  reflect.TypeOf(*p),
-	}
+func (s *stringArrayValue) IsBool() bool {
+	return false
 }
 
-// StringPos defines a string positional argument at the specified position with a default value and usage string.
-// The return value is the address of a string variable that stores the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) StringPos(name string, position int, value string, usage string) *string {
-	p := new(string)
-	f.StringPosVar(p, name, position, value, usage)
-	return p
+func (s *stringArrayValue) Type() string {
+	return "value" + s.separator() + "..."
 }
 
-// IntPosVar defines an int positional argument at the specified position with a default value and usage string.
-// The argument p points to an int variable in which to store the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) IntPosVar(p *int, name string, position int, value int, usage string) {
-	*p = value
-	f.posFields[position] = &PositionalField{
-		Name:  name,
-		Value: reflect.ValueOf(p).Elem(),
-		Type:  reflect.TypeOf(*p),
-	}
-}
+type intSliceValue []int
 
-// IntPos defines an int positional argument at the specified position with a default value and usage string.
-// The return value is the address of an int variable that stores the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) IntPos(name string, position int, value int, usage string) *int {
-	p := new(int)
-	f.IntPosVar(p, name, position, value, usage)
-	return p
+func (s *intSliceValue) Set(val string) error {
+	parts := strings.Split(val, ",")
+	values := make([]int, 0, len(parts))
+	for _, part := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("invalid element %q: %w", part, err)
+		}
+		values = append(values, v)
+	}
+	*s = values
+	return nil
 }
 
-// DurationPosVar defines a time.Duration positional argument at the specified position with a default value and usage string.
-// The argument p points to a time.Duration variable in which to store the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) DurationPosVar(p *time.Duration, name string, position int, value time.Duration, usage string) {
-	*p = value
-	f.posFields[position] = &PositionalField{
-		Name:  name,
-		Value: reflect.ValueOf(p).Elem(),
-		Type:  reflect.TypeOf(*p),
+func (s *intSliceValue) String() string {
+	parts := make([]string, len(*s))
+	for i, v := range *s {
+		parts[i] = strconv.Itoa(v)
 	}
+	return strings.Join(parts, ",")
 }
 
-// DurationPos defines a time.Duration positional argument at the specified position with a default value and usage string.
-// The return value is the address of a time.Duration variable that stores the value of the positional argument.
-// Position 0 is the first non-flag argument, position 1 is the second, etc.
-func (f *FlagSet) DurationPos(name string, position int, value time.Duration, usage string) *time.Duration {
-	p := new(time.Duration)
-	f.DurationPosVar(p, name, position, value, usage)
-	return p
+func (s *intSliceValue) IsBool() bool {
+	return false
 }
 
-// Rest defines a slice to capture all remaining non-flag arguments.
-// The argument p points to a []string variable that will be populated with all non-flag arguments.
-// This is useful for commands that accept variable-length argument lists.
-func (f *FlagSet) Rest(p *[]string, usage string) {
-	if p == nil {
-		panic("Rest: pointer cannot be nil")
-	}
-	*p = []string{}
-	f.restField = p
+func (s *intSliceValue) Type() string {
+	return "int,..."
 }
 
-// Var defines a flag with the specified name, short form, and usage string.
-// The type and value of the flag are represented by the first argument, of type Value,
-// which typically holds a user-defined implementation of Value.
-func (f *FlagSet) Var(value Value, name string, short rune, usage string) {
-	flag := &Flag{
-		Name:     name,
-		Short:    short,
-		Usage:    usage,
-		Value:    value,
-		DefValue: value.String(),
-	}
+type float64SliceValue []float64
 
-	if name != "" {
-		f.flags[name] = flag
-	}
-	if short != 0 {
-		f.shortMap[short] = flag
+func (s *float64SliceValue) Set(val string) error {
+	parts := strings.Split(val, ",")
+	values := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return fmt.Errorf("invalid element %q: %w", part, err)
+		}
+		values = append(values, v)
 	}
+	*s = values
+	return nil
+}
 
-	// Add to the list of all flags for iteration
-	f.allFlags = append(f.allFlags, flag)
+func (s *float64SliceValue) String() string {
+	parts := make([]string, len(*s))
+	for i, v := range *s {
+		parts[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(parts, ",")
 }
 
-// Lookup returns the Flag with the given name, or nil if not found
+func (s *float64SliceValue) IsBool() bool {
+	return false
+}
+
+func (s *float64SliceValue) Type() string {
+	return "float,..."
+}
+
+// stringMapValue holds key=value pairs. Repeated occurrences accumulate within a
+// single Parse, so --label a=1 --label b=2 yields both; a repeated key keeps its
+// last value.
+type stringMapValue struct {
+	value   *map[string]string
+	def     map[string]string // Copy of the default, restored by Reset
+	changed bool
+}
+
+func (s *stringMapValue) Set(val string) error {
+	key, value, ok := strings.Cut(val, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", val)
+	}
+	if !s.changed || *s.value == nil {
+		*s.value = make(map[string]string)
+	}
+	(*s.value)[key] = value
+	s.changed = true
+	return nil
+}
+
+func (s *stringMapValue) String() string {
+	keys := slices.Sorted(maps.Keys(*s.value))
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + "=" + (*s.value)[key]
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *stringMapValue) resetParse() {
+	s.changed = false
+}
+
+func (s *stringMapValue) IsBool() bool {
+	return false
+}
+
+func (s *stringMapValue) Type() string {
+	return "key=value"
+}
+
+type durationValue time.Duration
+
+func (d *durationValue) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = durationValue(v)
+	return nil
+}
+
+func (d *durationValue) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *durationValue) IsBool() bool {
+	return false
+}
+
+func (d *durationValue) Type() string {
+	return "duration"
+}
+
+// byteSizeUnits maps the accepted size suffixes, in lowercase, to their multipliers.
+// Single-letter suffixes such as "k" or "M" are rejected since they don't say
+// whether they are decimal or binary.
+var byteSizeUnits = map[string]int64{
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// byteSizeFormats lists the units used by String, largest first within each family
+var byteSizeFormats = []struct {
+	suffix string
+	size   int64
+}{
+	{"TiB", 1 << 40}, {"TB", 1000 * 1000 * 1000 * 1000},
+	{"GiB", 1 << 30}, {"GB", 1000 * 1000 * 1000},
+	{"MiB", 1 << 20}, {"MB", 1000 * 1000},
+	{"KiB", 1 << 10}, {"KB", 1000},
+}
+
+// byteSizeValue holds a size in bytes given as a number with an optional unit
+// suffix, such as "512", "10MB", or "1.5GiB"
+type byteSizeValue int64
+
+func (b *byteSizeValue) Set(s string) error {
+	v, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = byteSizeValue(v)
+	return nil
+}
+
+// String formats the size with the unit that divides it evenly into the smallest number
+func (b *byteSizeValue) String() string {
+	n := int64(*b)
+	if n == 0 {
+		return "0"
+	}
+	best := strconv.FormatInt(n, 10) + "B"
+	bestQuotient := n
+	for _, unit := range byteSizeFormats {
+		if n%unit.size == 0 && n/unit.size < bestQuotient {
+			bestQuotient = n / unit.size
+			best = strconv.FormatInt(bestQuotient, 10) + unit.suffix
+		}
+	}
+	return best
+}
+
+func (b *byteSizeValue) IsBool() bool {
+	return false
+}
+
+func (b *byteSizeValue) Type() string {
+	return "size"
+}
+
+// parseByteSize parses a number with an optional unit suffix into a count of bytes
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	number, suffix := s, ""
+	if i >= 0 {
+		number, suffix = s[:i], strings.TrimSpace(s[i:])
+	}
+	if number == "" {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	multiplier := int64(1)
+	if suffix != "" {
+		m, ok := byteSizeUnits[strings.ToLower(suffix)]
+		if !ok {
+			return 0, fmt.Errorf("invalid size %q: unknown unit %q (use B, KB, MB, GB, TB, KiB, MiB, GiB, or TiB)", s, suffix)
+		}
+		multiplier = m
+	}
+
+	if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+		if n > math.MaxInt64/multiplier {
+			return 0, fmt.Errorf("invalid size %q: too large", s)
+		}
+		return n * multiplier, nil
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	size := f * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: too large", s)
+	}
+	return int64(math.Round(size)), nil
+}
+
+// ipValue holds an IP address parsed with net.ParseIP
+type ipValue struct {
+	ip *net.IP
+}
+
+func (i *ipValue) Set(s string) error {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return fmt.Errorf("invalid IP address %q", s)
+	}
+	*i.ip = ip
+	return nil
+}
+
+func (i *ipValue) String() string {
+	if i.ip == nil || *i.ip == nil {
+		return ""
+	}
+	return i.ip.String()
+}
+
+func (i *ipValue) IsBool() bool {
+	return false
+}
+
+func (i *ipValue) Type() string {
+	return "ip"
+}
+
+// ipNetValue holds a network parsed from CIDR notation with net.ParseCIDR
+type ipNetValue struct {
+	n *net.IPNet
+}
+
+func (i *ipNetValue) Set(s string) error {
+	_, n, err := net.ParseCIDR(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("invalid CIDR %q", s)
+	}
+	*i.n = *n
+	return nil
+}
+
+func (i *ipNetValue) String() string {
+	if i.n == nil || i.n.IP == nil {
+		return ""
+	}
+	return i.n.String()
+}
+
+func (i *ipNetValue) IsBool() bool {
+	return false
+}
+
+func (i *ipNetValue) Type() string {
+	return "cidr"
+}
+
+// urlValue holds a URL parsed with url.Parse. When absolute is set, the URL
+// must include a scheme and a host.
+type urlValue struct {
+	u        *url.URL
+	absolute bool
+}
+
+func (u *urlValue) Set(s string) error {
+	v, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", s, err)
+	}
+	if u.absolute && (v.Scheme == "" || v.Host == "") {
+		return fmt.Errorf("invalid URL %q: must be absolute with a scheme and host", s)
+	}
+	*u.u = *v
+	return nil
+}
+
+func (u *urlValue) String() string {
+	if u.u == nil {
+		return ""
+	}
+	return u.u.String()
+}
+
+func (u *urlValue) IsBool() bool {
+	return false
+}
+
+func (u *urlValue) Type() string {
+	return "url"
+}
+
+// pointerValue binds a pointer struct field such as *string or *int. The field
+// stays nil until a value is given, so callers can tell an unset flag from one
+// set to the zero value.
+type pointerValue struct {
+	field  reflect.Value // The pointer field, assigned target once a value is set
+	target reflect.Value // Pointer to the storage value parses into
+	value  Value         // Parses into target
+}
+
+// newPointerValue returns a pointerValue for a settable pointer field, or false
+// if the field does not point to a supported type. A non-nil field keeps its pointee.
+func newPointerValue(field reflect.Value) (*pointerValue, bool) {
+	p := &pointerValue{field: field, target: field}
+	if field.IsNil() {
+		p.target = reflect.New(field.Type().Elem())
+	}
+	if !p.bind() {
+		return nil, false
+	}
+	return p, true
+}
+
+// bind creates the Value that parses into target
+func (p *pointerValue) bind() bool {
+	switch t := p.target.Interface().(type) {
+	case *bool:
+		p.value = (*boolValue)(t)
+	case *string:
+		p.value = (*stringValue)(t)
+	case *int:
+		p.value = (*intValue)(t)
+	case *int64:
+		p.value = (*int64Value)(t)
+	case *uint:
+		p.value = (*uintValue)(t)
+	case *uint64:
+		p.value = (*uint64Value)(t)
+	case *time.Duration:
+		p.value = (*durationValue)(t)
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *pointerValue) Set(s string) error {
+	if err := p.value.Set(s); err != nil {
+		return err
+	}
+	p.field.Set(p.target)
+	return nil
+}
+
+func (p *pointerValue) String() string {
+	if p.field.IsNil() {
+		return ""
+	}
+	return p.value.String()
+}
+
+func (p *pointerValue) IsBool() bool {
+	return p.value.IsBool()
+}
+
+func (p *pointerValue) Type() string {
+	return p.value.Type()
+}
+
+// parseResetter is implemented by values that track state across repeated
+// occurrences of a flag and need to reset it at the start of each Parse
+type parseResetter interface {
+	resetParse()
+}
+
+// valueClearer is implemented by values whose empty default cannot be restored
+// through Set, such as lists and addresses, so Reset can clear them directly
+type valueClearer interface {
+	clearValue()
+}
+
+func (s *stringArrayValue) clearValue()  { *s.value = []string{} }
+func (s *intSliceValue) clearValue()     { *s = []int{} }
+func (s *float64SliceValue) clearValue() { *s = []float64{} }
+func (i *ipValue) clearValue()           { *i.ip = nil }
+func (i *ipNetValue) clearValue()        { *i.n = net.IPNet{} }
+func (u *urlValue) clearValue()          { *u.u = url.URL{} }
+func (t *timeValue) clearValue()         { *t.t = time.Time{} }
+
+// defaultRestorer is implemented by values whose default cannot be restored
+// through Set from its String form, such as maps whose values contain commas
+type defaultRestorer interface {
+	restoreDefault()
+}
+
+func (s *stringMapValue) restoreDefault() {
+	*s.value = maps.Clone(s.def)
+	if *s.value == nil {
+		*s.value = map[string]string{}
+	}
+}
+
+func (b *boolValue) Get() any         { return bool(*b) }
+func (s *stringValue) Get() any       { return string(*s) }
+func (i *intValue) Get() any          { return int(*i) }
+func (c *countValue) Get() any        { return int(*c) }
+func (i *int64Value) Get() any        { return int64(*i) }
+func (u *uintValue) Get() any         { return uint(*u) }
+func (u *uint64Value) Get() any       { return uint64(*u) }
+func (s *stringArrayValue) Get() any  { return *s.value }
+func (s *intSliceValue) Get() any     { return []int(*s) }
+func (s *float64SliceValue) Get() any { return []float64(*s) }
+func (s *stringMapValue) Get() any    { return *s.value }
+func (d *durationValue) Get() any     { return time.Duration(*d) }
+func (b *byteSizeValue) Get() any     { return int64(*b) }
+func (i *ipValue) Get() any           { return *i.ip }
+func (i *ipNetValue) Get() any        { return i.n }
+func (u *urlValue) Get() any          { return u.u }
+func (t *timeValue) Get() any         { return *t.t }
+
+// Get returns nil while the field is unset, or the value of its target
+func (p *pointerValue) Get() any {
+	if p.field.IsNil() {
+		return nil
+	}
+	if g, ok := p.value.(Getter); ok {
+		return g.Get()
+	}
+	return p.value.String()
+}
+
+func (p *pointerValue) clearValue() {
+	p.field.Set(reflect.Zero(p.field.Type()))
+	p.target = reflect.New(p.field.Type().Elem())
+	p.bind()
+}
+
+// timeValue holds a time.Time parsed with a layout. In addition to absolute
+// times it accepts the relative expressions "now", "today", "yesterday",
+// "tomorrow", and signed durations such as "+1h" or "-30m", resolved against now.
+type timeValue struct {
+	t      *time.Time
+	layout string
+	now    func() time.Time
+}
+
+func (t *timeValue) Set(s string) error {
+	v, err := parseTime(s, t.layout, t.now())
+	if err != nil {
+		return err
+	}
+	*t.t = v
+	return nil
+}
+
+func (t *timeValue) String() string {
+	if t.t == nil || t.t.IsZero() {
+		return ""
+	}
+	return t.t.Format(t.layout)
+}
+
+func (t *timeValue) IsBool() bool {
+	return false
+}
+
+func (t *timeValue) Type() string {
+	return "time"
+}
+
+// parseTime parses s as either a relative time expression or an absolute time in layout
+func parseTime(s string, layout string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch strings.ToLower(s) {
+	case "now":
+		return now, nil
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(d), nil
+	}
+
+	return time.Parse(layout, s)
+}
+
+// LowerCaseName converts a struct field name to a long flag name by lowercasing it
+// (e.g., MaxRetries -> maxretries). This is the default used by FromStruct.
+func LowerCaseName(name string) string {
+	return strings.ToLower(name)
+}
+
+// KebabCaseName converts a struct field name to a kebab-case long flag name
+// (e.g., MaxRetries -> max-retries, HTTPServer -> http-server). Underscores
+// become hyphens, so Log_Level also becomes log-level.
+func KebabCaseName(name string) string {
+	runes := []rune(strings.Trim(name, "_"))
+	var sb strings.Builder
+	for i, r := range runes {
+		if r == '_' {
+			if runes[i-1] != '_' {
+				sb.WriteRune('-')
+			}
+			continue
+		}
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				prev := runes[i-1]
+				nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+				if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+					sb.WriteRune('-')
+				}
+			}
+			sb.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// NewFlagSet returns a new, empty flag set with the specified name.
+// The name is used for error messages and help output.
+func NewFlagSet(name string) *FlagSet {
+	return &FlagSet{
+		name:      name,
+		flags:     make(map[string]*Flag),
+		shortMap:  make(map[rune]*Flag),
+		posFields: make(map[int]*PositionalField),
+	}
+}
+
+// NewFlagSetWithErrorHandling returns a new, empty flag set with the specified name
+// and error handling behavior.
+func NewFlagSetWithErrorHandling(name string, errorHandling ErrorHandling) *FlagSet {
+	f := NewFlagSet(name)
+	f.errorHandling = errorHandling
+	return f
+}
+
+// SetOutput sets the destination for help and completion output.
+// If w is nil, output goes to os.Stdout.
+func (f *FlagSet) SetOutput(w io.Writer) {
+	f.out = w
+}
+
+// output returns the destination for help and completion output
+func (f *FlagSet) output() io.Writer {
+	if f.out == nil {
+		return os.Stdout
+	}
+	return f.out
+}
+
+// SetCollectErrors makes Parse continue past recoverable errors, such as unknown flags,
+// invalid values, and missing required flags, and return them all joined with errors.Join.
+// Help requests still stop parsing immediately.
+func (f *FlagSet) SetCollectErrors(collect bool) {
+	f.collectErrors = collect
+}
+
+// Errors returns the errors collected during the last Parse when SetCollectErrors is enabled
+func (f *FlagSet) Errors() []error {
+	return f.errs
+}
+
+// fail records err and returns nil when collecting errors, otherwise it returns err
+func (f *FlagSet) fail(err error) error {
+	if f.collectErrors {
+		f.errs = append(f.errs, err)
+		return nil
+	}
+	return err
+}
+
+// SetErrorHandling sets how Parse behaves if parsing fails.
+func (f *FlagSet) SetErrorHandling(errorHandling ErrorHandling) {
+	f.errorHandling = errorHandling
+}
+
+// ErrorHandling returns the error handling behavior of the flag set.
+func (f *FlagSet) ErrorHandling() ErrorHandling {
+	return f.errorHandling
+}
+
+// BoolVar defines a bool flag with the specified name, short form, default value, and usage string.
+// The argument p points to a bool variable in which to store the value of the flag.
+func (f *FlagSet) BoolVar(p *bool, name string, short rune, value bool, usage string) {
+	*p = value
+	f.Var((*boolValue)(p), name, short, usage)
+}
+
+// Bool defines a bool flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a bool variable that stores the value of the flag.
+func (f *FlagSet) Bool(name string, short rune, value bool, usage string) *bool {
+	p := new(bool)
+	f.BoolVar(p, name, short, value, usage)
+	return p
+}
+
+// StringVar defines a string flag with the specified name, short form, default value, and usage string.
+// The argument p points to a string variable in which to store the value of the flag.
+func (f *FlagSet) StringVar(p *string, name string, short rune, value string, usage string) {
+	*p = value
+	f.Var((*stringValue)(p), name, short, usage)
+}
+
+// String defines a string flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a string variable that stores the value of the flag.
+func (f *FlagSet) String(name string, short rune, value string, usage string) *string {
+	p := new(string)
+	f.StringVar(p, name, short, value, usage)
+	return p
+}
+
+// StringOptionalVar defines a string flag whose value is optional, like --color
+// and --color=always. The argument p points to a string variable in which to store
+// the value of the flag. Given without a value, the flag is set to ifPresent; when
+// absent it keeps value. Since the value is optional, it must be attached: the long
+// form takes --name=value, and the short form -n=value or -nvalue. A following
+// argument is never consumed as the value.
+func (f *FlagSet) StringOptionalVar(p *string, name string, short rune, ifPresent string, value string, usage string) {
+	f.StringVar(p, name, short, value, usage)
+	flag := f.allFlags[len(f.allFlags)-1]
+	flag.optional = true
+	flag.ifPresent = ifPresent
+}
+
+// StringOptional defines a string flag whose value is optional, like --color and
+// --color=always. The return value is the address of a string variable that stores
+// the value of the flag. See StringOptionalVar.
+func (f *FlagSet) StringOptional(name string, short rune, ifPresent string, value string, usage string) *string {
+	p := new(string)
+	f.StringOptionalVar(p, name, short, ifPresent, value, usage)
+	return p
+}
+
+// IntVar defines an int flag with the specified name, short form, default value, and usage string.
+// The argument p points to an int variable in which to store the value of the flag.
+func (f *FlagSet) IntVar(p *int, name string, short rune, value int, usage string) {
+	*p = value
+	f.Var((*intValue)(p), name, short, usage)
+}
+
+// Int defines an int flag with the specified name, short form, default value, and usage string.
+// The return value is the address of an int variable that stores the value of the flag.
+func (f *FlagSet) Int(name string, short rune, value int, usage string) *int {
+	p := new(int)
+	f.IntVar(p, name, short, value, usage)
+	return p
+}
+
+// CountVar defines a count flag with the specified name, short form, and usage string.
+// The argument p points to an int variable that is incremented each time the flag is given,
+// so -vvv or --verbose --verbose --verbose yields 3.
+func (f *FlagSet) CountVar(p *int, name string, short rune, usage string) {
+	*p = 0
+	f.Var((*countValue)(p), name, short, usage)
+}
+
+// Count defines a count flag with the specified name, short form, and usage string.
+// The return value is the address of an int variable that counts how many times the flag was given.
+func (f *FlagSet) Count(name string, short rune, usage string) *int {
+	p := new(int)
+	f.CountVar(p, name, short, usage)
+	return p
+}
+
+// Int64Var defines an int64 flag with the specified name, short form, default value, and usage string.
+// The argument p points to an int64 variable in which to store the value of the flag.
+func (f *FlagSet) Int64Var(p *int64, name string, short rune, value int64, usage string) {
+	*p = value
+	f.Var((*int64Value)(p), name, short, usage)
+}
+
+// Int64 defines an int64 flag with the specified name, short form, default value, and usage string.
+// The return value is the address of an int64 variable that stores the value of the flag.
+func (f *FlagSet) Int64(name string, short rune, value int64, usage string) *int64 {
+	p := new(int64)
+	f.Int64Var(p, name, short, value, usage)
+	return p
+}
+
+// ByteSizeVar defines a byte size flag with the specified name, short form, default value, and usage string.
+// The argument p points to an int64 variable in which to store the size in bytes. Values are
+// numbers with an optional unit suffix: B, KB, MB, GB, or TB for powers of 1000, and KiB, MiB,
+// GiB, or TiB for powers of 1024.
+func (f *FlagSet) ByteSizeVar(p *int64, name string, short rune, value int64, usage string) {
+	*p = value
+	f.Var((*byteSizeValue)(p), name, short, usage)
+}
+
+// ByteSize defines a byte size flag with the specified name, short form, default value, and usage string.
+// The return value is the address of an int64 variable that stores the size in bytes.
+func (f *FlagSet) ByteSize(name string, short rune, value int64, usage string) *int64 {
+	p := new(int64)
+	f.ByteSizeVar(p, name, short, value, usage)
+	return p
+}
+
+// IPVar defines a net.IP flag with the specified name, short form, default value, and usage string.
+// The argument p points to a net.IP variable in which to store the value of the flag.
+func (f *FlagSet) IPVar(p *net.IP, name string, short rune, value net.IP, usage string) {
+	*p = value
+	f.Var(&ipValue{ip: p}, name, short, usage)
+}
+
+// IP defines a net.IP flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a net.IP variable that stores the value of the flag.
+func (f *FlagSet) IP(name string, short rune, value net.IP, usage string) *net.IP {
+	p := new(net.IP)
+	f.IPVar(p, name, short, value, usage)
+	return p
+}
+
+// IPNetVar defines a net.IPNet flag with the specified name, short form, default value, and usage string.
+// Values are given in CIDR notation, such as "10.0.0.0/8".
+// The argument p points to a net.IPNet variable in which to store the value of the flag.
+func (f *FlagSet) IPNetVar(p *net.IPNet, name string, short rune, value net.IPNet, usage string) {
+	*p = value
+	f.Var(&ipNetValue{n: p}, name, short, usage)
+}
+
+// IPNet defines a net.IPNet flag with the specified name, short form, default value, and usage string.
+// Values are given in CIDR notation, such as "10.0.0.0/8".
+// The return value is the address of a net.IPNet variable that stores the value of the flag.
+func (f *FlagSet) IPNet(name string, short rune, value net.IPNet, usage string) *net.IPNet {
+	p := new(net.IPNet)
+	f.IPNetVar(p, name, short, value, usage)
+	return p
+}
+
+// URLVar defines a URL flag with the specified name, short form, default value, and usage string.
+// The argument p points to a url.URL variable in which to store the value of the flag.
+// A nil default leaves p as the zero URL.
+func (f *FlagSet) URLVar(p *url.URL, name string, short rune, value *url.URL, usage string) {
+	if value != nil {
+		*p = *value
+	}
+	f.Var(&urlValue{u: p}, name, short, usage)
+}
+
+// URL defines a URL flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a url.URL variable that stores the value of the flag.
+func (f *FlagSet) URL(name string, short rune, value *url.URL, usage string) *url.URL {
+	p := new(url.URL)
+	f.URLVar(p, name, short, value, usage)
+	return p
+}
+
+// RequireAbsoluteURL makes the named URL flag reject values without a scheme and host,
+// such as "not a url" or "example.com/path".
+func (f *FlagSet) RequireAbsoluteURL(name string) {
+	if flag, ok := f.flagByName(name); ok {
+		if v, ok := flag.Value.(*urlValue); ok {
+			v.absolute = true
+		}
+	}
+}
+
+// UintVar defines a uint flag with the specified name, short form, default value, and usage string.
+// The argument p points to a uint variable in which to store the value of the flag.
+func (f *FlagSet) UintVar(p *uint, name string, short rune, value uint, usage string) {
+	*p = value
+	f.Var((*uintValue)(p), name, short, usage)
+}
+
+// Uint defines a uint flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a uint variable that stores the value of the flag.
+func (f *FlagSet) Uint(name string, short rune, value uint, usage string) *uint {
+	p := new(uint)
+	f.UintVar(p, name, short, value, usage)
+	return p
+}
+
+// Uint64Var defines a uint64 flag with the specified name, short form, default value, and usage string.
+// The argument p points to a uint64 variable in which to store the value of the flag.
+func (f *FlagSet) Uint64Var(p *uint64, name string, short rune, value uint64, usage string) {
+	*p = value
+	f.Var((*uint64Value)(p), name, short, usage)
+}
+
+// Uint64 defines a uint64 flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a uint64 variable that stores the value of the flag.
+func (f *FlagSet) Uint64(name string, short rune, value uint64, usage string) *uint64 {
+	p := new(uint64)
+	f.Uint64Var(p, name, short, value, usage)
+	return p
+}
+
+// StringArrayVar defines a string array flag with the specified name, short form, default value, and usage string.
+// The argument p points to a []string variable in which to store the value of the flag.
+// The flag value is expected to be a comma-separated list of strings.
+func (f *FlagSet) StringArrayVar(p *[]string, name string, short rune, value []string, usage string) {
+	if value != nil {
+		*p = value
+	} else {
+		*p = []string{}
+	}
+	f.Var(&stringArrayValue{value: p}, name, short, usage)
+}
+
+// StringArray defines a string array flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a []string variable that stores the value of the flag.
+// The flag value is expected to be a comma-separated list of strings.
+func (f *FlagSet) StringArray(name string, short rune, value []string, usage string) *[]string {
+	p := new([]string)
+	f.StringArrayVar(p, name, short, value, usage)
+	return p
+}
+
+// StringArraySepVar defines a string array flag like StringArrayVar, but elements are
+// separated by sep instead of a comma. An empty sep falls back to a comma.
+func (f *FlagSet) StringArraySepVar(p *[]string, name string, short rune, sep string, value []string, usage string) {
+	if value != nil {
+		*p = value
+	} else {
+		*p = []string{}
+	}
+	f.Var(&stringArrayValue{value: p, sep: sep}, name, short, usage)
+}
+
+// StringArraySep defines a string array flag like StringArray, but elements are
+// separated by sep instead of a comma. An empty sep falls back to a comma.
+func (f *FlagSet) StringArraySep(name string, short rune, sep string, value []string, usage string) *[]string {
+	p := new([]string)
+	f.StringArraySepVar(p, name, short, sep, value, usage)
+	return p
+}
+
+// StringSliceVar defines a string slice flag with the specified name, short form, default value, and usage string.
+// The argument p points to a []string variable in which to store the value of the flag.
+// Unlike StringArrayVar, repeated occurrences append rather than replace: each value is
+// split on commas, so --tags a,b --tags c yields ["a", "b", "c"]. The first occurrence
+// replaces the default value.
+func (f *FlagSet) StringSliceVar(p *[]string, name string, short rune, value []string, usage string) {
+	if value != nil {
+		*p = value
+	} else {
+		*p = []string{}
+	}
+	f.Var(&stringArrayValue{value: p, appendMode: true}, name, short, usage)
+}
+
+// StringSlice defines a string slice flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a []string variable that stores the value of the flag.
+// Repeated occurrences append; see StringSliceVar.
+func (f *FlagSet) StringSlice(name string, short rune, value []string, usage string) *[]string {
+	p := new([]string)
+	f.StringSliceVar(p, name, short, value, usage)
+	return p
+}
+
+// IntSliceVar defines an int slice flag with the specified name, short form, default value, and usage string.
+// The argument p points to a []int variable in which to store the value of the flag.
+// The flag value is expected to be a comma-separated list of integers.
+func (f *FlagSet) IntSliceVar(p *[]int, name string, short rune, value []int, usage string) {
+	if value != nil {
+		*p = value
+	} else {
+		*p = []int{}
+	}
+	f.Var((*intSliceValue)(p), name, short, usage)
+}
+
+// IntSlice defines an int slice flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a []int variable that stores the value of the flag.
+// The flag value is expected to be a comma-separated list of integers.
+func (f *FlagSet) IntSlice(name string, short rune, value []int, usage string) *[]int {
+	p := new([]int)
+	f.IntSliceVar(p, name, short, value, usage)
+	return p
+}
+
+// Float64SliceVar defines a float64 slice flag with the specified name, short form, default value, and usage string.
+// The argument p points to a []float64 variable in which to store the value of the flag.
+// The flag value is expected to be a comma-separated list of numbers.
+func (f *FlagSet) Float64SliceVar(p *[]float64, name string, short rune, value []float64, usage string) {
+	if value != nil {
+		*p = value
+	} else {
+		*p = []float64{}
+	}
+	f.Var((*float64SliceValue)(p), name, short, usage)
+}
+
+// Float64Slice defines a float64 slice flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a []float64 variable that stores the value of the flag.
+// The flag value is expected to be a comma-separated list of numbers.
+func (f *FlagSet) Float64Slice(name string, short rune, value []float64, usage string) *[]float64 {
+	p := new([]float64)
+	f.Float64SliceVar(p, name, short, value, usage)
+	return p
+}
+
+// StringMapVar defines a map flag with the specified name, short form, and usage string.
+// The argument p points to a map[string]string variable in which to store the value of
+// the flag. A map it already holds is the default, as with a struct field filled in
+// before FromStruct; otherwise the flag starts out empty. Each occurrence takes a
+// key=value pair, so --label a=1 --label b=2 yields {"a": "1", "b": "2"}; a repeated
+// key keeps its last value. The first occurrence replaces the default rather than
+// adding to it. A value without "=" is rejected with ErrInvalidValue.
+func (f *FlagSet) StringMapVar(p *map[string]string, name string, short rune, usage string) {
+	if *p == nil {
+		*p = map[string]string{}
+	}
+	f.Var(&stringMapValue{value: p, def: maps.Clone(*p)}, name, short, usage)
+}
+
+// StringMap defines a map flag with the specified name, short form, and usage string.
+// The return value is the address of a map[string]string variable that stores the value
+// of the flag. Each occurrence takes a key=value pair; see StringMapVar.
+func (f *FlagSet) StringMap(name string, short rune, usage string) *map[string]string {
+	p := new(map[string]string)
+	f.StringMapVar(p, name, short, usage)
+	return p
+}
+
+// DurationVar defines a time.Duration flag with the specified name, short form, default value, and usage string.
+// The argument p points to a time.Duration variable in which to store the value of the flag.
+// The flag accepts values parseable by time.ParseDuration.
+func (f *FlagSet) DurationVar(p *time.Duration, name string, short rune, value time.Duration, usage string) {
+	*p = value
+	f.Var((*durationValue)(p), name, short, usage)
+}
+
+// Duration defines a time.Duration flag with the specified name, short form, default value, and usage string.
+// The return value is the address of a time.Duration variable that stores the value of the flag.
+// The flag accepts values parseable by time.ParseDuration.
+func (f *FlagSet) Duration(name string, short rune, value time.Duration, usage string) *time.Duration {
+	p := new(time.Duration)
+	f.DurationVar(p, name, short, value, usage)
+	return p
+}
+
+// TimeVar defines a time.Time flag with the specified name, short form, default value, layout, and usage string.
+// The argument p points to a time.Time variable in which to store the value of the flag.
+// The flag accepts times in the given layout (RFC3339 if empty) as well as relative
+// expressions like "now", "yesterday", or "+1h", which are resolved using the FlagSet's clock.
+func (f *FlagSet) TimeVar(p *time.Time, name string, short rune, value time.Time, layout string, usage string) {
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	*p = value
+	f.Var(&timeValue{t: p, layout: layout, now: f.now}, name, short, usage)
+}
+
+// Time defines a time.Time flag with the specified name, short form, default value, layout, and usage string.
+// The return value is the address of a time.Time variable that stores the value of the flag.
+// See TimeVar for the accepted formats.
+func (f *FlagSet) Time(name string, short rune, value time.Time, layout string, usage string) *time.Time {
+	p := new(time.Time)
+	f.TimeVar(p, name, short, value, layout, usage)
+	return p
+}
+
+// SetClock sets the time source used to resolve relative time values such as
+// "now" or "+1h". Passing nil restores the default of time.Now.
+// Relative default values are resolved when the flag is defined, so SetClock
+// should be called before defining flags when deterministic defaults are needed.
+func (f *FlagSet) SetClock(clock func() time.Time) {
+	f.clock = clock
+}
+
+// now returns the current time according to the FlagSet's clock
+func (f *FlagSet) now() time.Time {
+	if f.clock != nil {
+		return f.clock()
+	}
+	return time.Now()
+}
+
+// definePositional registers a positional field. With SetStrictRegistration
+// enabled, it panics if the position is already taken.
+func (f *FlagSet) definePositional(position int, field *PositionalField) {
+	if f.strictRegister {
+		if existing, ok := f.posFields[position]; ok {
+			panic(positionConflict(position, existing, field))
+		}
+	}
+	f.posFields[position] = field
+}
+
+// positionConflict describes two positional fields declared at the same position
+func positionConflict(position int, existing, field *PositionalField) error {
+	return fmt.Errorf("position %d is used by both %s and %s", position, existing.Name, field.Name)
+}
+
+// BoolPosVar defines a bool positional argument at the specified position with a default value and usage string.
+// The argument p points to a bool variable in which to store the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) BoolPosVar(p *bool, name string, position int, value bool, usage string) {
+	*p = value
+	f.definePositional(position, &PositionalField{
+		Name:  name,
+		Value: reflect.ValueOf(p).Elem(),
+		Type:  reflect.TypeOf(*p),
+		Usage: usage,
+	})
+}
+
+// BoolPos defines a bool positional argument at the specified position with a default value and usage string.
+// The return value is the address of a bool variable that stores the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) BoolPos(name string, position int, value bool, usage string) *bool {
+	p := new(bool)
+	f.BoolPosVar(p, name, position, value, usage)
+	return p
+}
+
+// StringPosVar defines a string positional argument at the specified position with a default value and usage string.
+// The argument p points to a string variable in which to store the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) StringPosVar(p *string, name string, position int, value string, usage string) {
+	*p = value
+	f.definePositional(position, &PositionalField{
+		Name:  name,
+		Value: reflect.ValueOf(p).Elem(),
+		Type:  reflect.TypeOf(*p),
+		Usage: usage,
+	})
+}
+
+// StringPos defines a string positional argument at the specified position with a default value and usage string.
+// The return value is the address of a string variable that stores the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) StringPos(name string, position int, value string, usage string) *string {
+	p := new(string)
+	f.StringPosVar(p, name, position, value, usage)
+	return p
+}
+
+// IntPosVar defines an int positional argument at the specified position with a default value and usage string.
+// The argument p points to an int variable in which to store the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) IntPosVar(p *int, name string, position int, value int, usage string) {
+	*p = value
+	f.definePositional(position, &PositionalField{
+		Name:  name,
+		Value: reflect.ValueOf(p).Elem(),
+		Type:  reflect.TypeOf(*p),
+		Usage: usage,
+	})
+}
+
+// IntPos defines an int positional argument at the specified position with a default value and usage string.
+// The return value is the address of an int variable that stores the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) IntPos(name string, position int, value int, usage string) *int {
+	p := new(int)
+	f.IntPosVar(p, name, position, value, usage)
+	return p
+}
+
+// DurationPosVar defines a time.Duration positional argument at the specified position with a default value and usage string.
+// The argument p points to a time.Duration variable in which to store the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) DurationPosVar(p *time.Duration, name string, position int, value time.Duration, usage string) {
+	*p = value
+	f.definePositional(position, &PositionalField{
+		Name:  name,
+		Value: reflect.ValueOf(p).Elem(),
+		Type:  reflect.TypeOf(*p),
+		Usage: usage,
+	})
+}
+
+// DurationPos defines a time.Duration positional argument at the specified position with a default value and usage string.
+// The return value is the address of a time.Duration variable that stores the value of the positional argument.
+// Position 0 is the first non-flag argument, position 1 is the second, etc.
+func (f *FlagSet) DurationPos(name string, position int, value time.Duration, usage string) *time.Duration {
+	p := new(time.Duration)
+	f.DurationPosVar(p, name, position, value, usage)
+	return p
+}
+
+// Rest defines a slice to capture all remaining non-flag arguments.
+// The argument p points to a []string variable that will be populated with all non-flag arguments.
+// This is useful for commands that accept variable-length argument lists.
+// By default the slice also includes arguments assigned to positional fields;
+// see SetRestExcludesPositional. It is a copy, separate from the slice Args returns.
+// Rest clears any limits set by an earlier RestWithMin or RestWithRange.
+func (f *FlagSet) Rest(p *[]string, usage string) {
+	if p == nil {
+		panic("Rest: pointer cannot be nil")
+	}
+	*p = []string{}
+	f.restField = p
+	f.restMin = 0
+	f.restMax = 0
+}
+
+// SetRestExcludesPositional controls whether the rest field leaves out the
+// arguments assigned to positional fields. By default it receives every non-flag
+// argument, so with a command at position 0, "run a b" gives a rest of [run a b];
+// with exclusion enabled it gives [a b].
+func (f *FlagSet) SetRestExcludesPositional(exclude bool) {
+	f.restExcludesPos = exclude
+}
+
+// SetStrictArgs controls whether Parse fails with ErrTooManyArgs when there are
+// non-flag arguments that no positional field takes. It has no effect when a rest
+// field is defined, and arguments captured by a passthrough field are allowed.
+// By default extra arguments are left in Args.
+func (f *FlagSet) SetStrictArgs(strict bool) {
+	f.strictArgs = strict
+}
+
+// RestWithMin defines a slice to capture all remaining non-flag arguments, like
+// Rest, and makes Parse fail with ErrTooFewArgs if there are fewer than min of them.
+// The count covers the arguments the rest field receives. It panics if min is negative.
+func (f *FlagSet) RestWithMin(p *[]string, min int, usage string) {
+	if min < 0 {
+		panic(fmt.Sprintf("RestWithMin: min cannot be negative, got %d", min))
+	}
+	f.Rest(p, usage)
+	f.restMin = min
+}
+
+// RestWithRange defines a slice to capture all remaining non-flag arguments, like
+// Rest, and makes Parse fail with ErrTooFewArgs if there are fewer than min of them
+// or ErrTooManyArgs if there are more than max. A max of 0 means no limit.
+// The counts cover the arguments the rest field receives. It panics if min or max
+// is negative, or if max is less than min and not 0.
+func (f *FlagSet) RestWithRange(p *[]string, min, max int, usage string) {
+	if max < 0 {
+		panic(fmt.Sprintf("RestWithRange: max cannot be negative, got %d", max))
+	}
+	if max > 0 && max < min {
+		panic(fmt.Sprintf("RestWithRange: max %d is less than min %d", max, min))
+	}
+	f.RestWithMin(p, min, usage)
+	f.restMax = max
+}
+
+// Var defines a flag with the specified name, short form, and usage string.
+// The type and value of the flag are represented by the first argument, of type Value,
+// which typically holds a user-defined implementation of Value.
+//
+// With SetStrictRegistration enabled, Var panics with an ErrDuplicateFlag error
+// if the name or short form is already in use.
+func (f *FlagSet) Var(value Value, name string, short rune, usage string) {
+	name = f.canonicalName(name)
+	if f.strictRegister {
+		if err := f.checkDuplicate(name, short); err != nil {
+			panic(err)
+		}
+	}
+
+	flag := &Flag{
+		Name:     name,
+		Short:    short,
+		Usage:    usage,
+		Value:    value,
+		DefValue: value.String(),
+	}
+
+	if name != "" {
+		f.flags[name] = flag
+	}
+	if short != 0 {
+		f.shortMap[short] = flag
+	}
+
+	// Add to the list of all flags for iteration
+	f.allFlags = append(f.allFlags, flag)
+}
+
+// SetStrictRegistration makes defining a flag whose long name or short form is
+// already in use an error instead of silently replacing the earlier flag. Var
+// and the typed definition methods panic, while FromStruct returns the error.
+// Both name the conflicting flags and wrap ErrDuplicateFlag. The positional
+// definition methods, such as StringPosVar, likewise panic if a position is
+// already taken.
+func (f *FlagSet) SetStrictRegistration(strict bool) {
+	f.strictRegister = strict
+}
+
+// checkDuplicate returns an ErrDuplicateFlag error if name or short is already
+// used by a defined flag
+func (f *FlagSet) checkDuplicate(name string, short rune) error {
+	name = f.canonicalName(name)
+	if name != "" {
+		if _, ok := f.flags[name]; ok {
+			return fmt.Errorf("%w: --%s", ErrDuplicateFlag, name)
+		}
+	}
+	if short != 0 {
+		if existing, ok := f.shortMap[short]; ok {
+			defining := fmt.Sprintf("-%c", short)
+			if name != "" {
+				defining = "--" + name
+			}
+			return fmt.Errorf("%w: -%c for %s is already used by %s", ErrDuplicateFlag, short, defining, flagDisplayName(existing))
+		}
+	}
+	return nil
+}
+
+// VarValidated defines a flag like Var, additionally running validate with the raw
+// string each time the flag is set. A validation failure is reported as ErrInvalidValue.
+func (f *FlagSet) VarValidated(value Value, name string, short rune, usage string, validate func(string) error) {
+	f.Var(value, name, short, usage)
+	f.allFlags[len(f.allFlags)-1].validator = validate
+}
+
+// Lookup returns the Flag with the given name, or nil if not found. Like the other
+// methods taking a flag name, it accepts the short form of a flag with no long
+// name, such as "q" for -q.
 func (f *FlagSet) Lookup(name string) *Flag {
-	return f.flags[name]
+	flag, _ := f.flagByName(name)
+	return flag
+}
+
+// Set sets the named flag from value as if it were given on the command line,
+// checking it against the flag's choices and validator, and marks the flag as
+// changed. It returns ErrUnknownFlag if there is no such flag and ErrInvalidValue
+// if the value is rejected. The changed state is reset by the next Parse, so call
+// Set after parsing to override a value, or before to supply a computed default.
+func (f *FlagSet) Set(name, value string) error {
+	flag, ok := f.flagByName(name)
+	if !ok || flag.disabled {
+		return &ParseError{Flag: "--" + name, Kind: ParseErrorUnknown}
+	}
+	if err := flag.set(value); err != nil {
+		return &ParseError{Flag: flagDisplayName(flag), Kind: ParseErrorInvalid, Err: err}
+	}
+	flag.changed = true
+	return nil
+}
+
+// GetString returns the value of the named string flag. It returns ErrUnknownFlag
+// if there is no such flag, or an error if the flag is not a string flag.
+func (f *FlagSet) GetString(name string) (string, error) {
+	value, err := f.getValue(name)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := value.(*stringValue); ok {
+		return string(*v), nil
+	}
+	return "", typeMismatch(name, value, "string")
+}
+
+// GetInt returns the value of the named int or count flag. It returns ErrUnknownFlag
+// if there is no such flag, or an error if the flag is of another type.
+func (f *FlagSet) GetInt(name string) (int, error) {
+	value, err := f.getValue(name)
+	if err != nil {
+		return 0, err
+	}
+	switch v := value.(type) {
+	case *intValue:
+		return int(*v), nil
+	case *countValue:
+		return int(*v), nil
+	}
+	return 0, typeMismatch(name, value, "int")
+}
+
+// GetBool returns the value of the named bool flag. It returns ErrUnknownFlag
+// if there is no such flag, or an error if the flag is not a bool flag.
+func (f *FlagSet) GetBool(name string) (bool, error) {
+	value, err := f.getValue(name)
+	if err != nil {
+		return false, err
+	}
+	if v, ok := value.(*boolValue); ok {
+		return bool(*v), nil
+	}
+	return false, typeMismatch(name, value, "bool")
+}
+
+// GetDuration returns the value of the named duration flag. It returns ErrUnknownFlag
+// if there is no such flag, or an error if the flag is not a duration flag.
+func (f *FlagSet) GetDuration(name string) (time.Duration, error) {
+	value, err := f.getValue(name)
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := value.(*durationValue); ok {
+		return time.Duration(*v), nil
+	}
+	return 0, typeMismatch(name, value, "duration")
+}
+
+// GetStringArray returns a copy of the value of the named string array or slice
+// flag. It returns ErrUnknownFlag if there is no such flag, or an error if the
+// flag is of another type.
+func (f *FlagSet) GetStringArray(name string) ([]string, error) {
+	value, err := f.getValue(name)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := value.(*stringArrayValue); ok {
+		return slices.Clone(*v.value), nil
+	}
+	return nil, typeMismatch(name, value, "string array")
+}
+
+// getValue returns the value of the named flag for a typed getter, looking
+// through the pointer wrapper of pointer fields from FromStruct
+func (f *FlagSet) getValue(name string) (Value, error) {
+	flag, ok := f.flagByName(name)
+	if !ok || flag.disabled {
+		return nil, fmt.Errorf("%w: --%s", ErrUnknownFlag, name)
+	}
+	if pv, ok := flag.Value.(*pointerValue); ok {
+		return pv.value, nil
+	}
+	return flag.Value, nil
+}
+
+// typeMismatch returns the error for a typed getter called on a flag of another type
+func typeMismatch(name string, value Value, want string) error {
+	return fmt.Errorf("flag --%s has type %s, not %s", name, value.Type(), want)
+}
+
+// Changed reports whether the named flag was set during the last Parse, on the command
+// line, from its environment variable, or from a config file, as opposed to keeping its
+// default value.
+// The state is reset at the start of each Parse.
+func (f *FlagSet) Changed(name string) bool {
+	flag, ok := f.flagByName(name)
+	return ok && !flag.disabled && flag.isSet()
+}
+
+// Source reports where the named flag's value came from during the last Parse,
+// following the precedence of command line, environment, then config file.
+// Flags that were never set, including unknown names, report SourceDefault.
+func (f *FlagSet) Source(name string) ValueSource {
+	flag, ok := f.flagByName(name)
+	if !ok {
+		return SourceDefault
+	}
+	return flag.source()
+}
+
+// source reports where the flag's value came from during the last Parse
+func (flag *Flag) source() ValueSource {
+	switch {
+	case flag.disabled:
+		return SourceDefault
+	case flag.changed:
+		return SourceFlag
+	case flag.envSet:
+		return SourceEnv
+	case flag.configSet:
+		return SourceConfig
+	}
+	return SourceDefault
+}
+
+// ShowDefault makes help output show the named flag's default even when it is
+// the zero value for its type, for flags where 0 or an empty string is meaningful
+func (f *FlagSet) ShowDefault(name string) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.showDefault = true
+	}
+}
+
+// SetFlagGroup places the named flag in a section of the help output. Sections
+// are listed after the ungrouped options, in the order they were first assigned.
+// An empty group moves the flag back to the ungrouped options.
+func (f *FlagSet) SetFlagGroup(name, group string) {
+	if flag, ok := f.flagByName(name); ok {
+		f.setFlagGroup(flag, group)
+	}
+}
+
+// setFlagGroup places flag in a help section, recording the section's order
+func (f *FlagSet) setFlagGroup(flag *Flag, group string) {
+	flag.group = group
+	if group != "" && !slices.Contains(f.groups, group) {
+		f.groups = append(f.groups, group)
+	}
+}
+
+// visitGrouped calls fn for each help section with its flags, in the order
+// VisitAll visits them. The ungrouped flags come first under "Options". Flags for
+// which skip returns true are left out, as are sections with no flags.
+func (f *FlagSet) visitGrouped(skip func(*Flag) bool, fn func(group string, flags []*Flag)) {
+	byGroup := make(map[string][]*Flag)
+	f.VisitAll(func(flag *Flag) {
+		if skip != nil && skip(flag) {
+			return
+		}
+		byGroup[flag.group] = append(byGroup[flag.group], flag)
+	})
+
+	if flags := byGroup[""]; len(flags) > 0 {
+		fn("Options", flags)
+	}
+	for _, group := range f.groups {
+		if flags := byGroup[group]; len(flags) > 0 {
+			fn(group, flags)
+		}
+	}
+}
+
+// MarkExperimental gates the named flag behind a runtime switch. When enabled is false
+// the flag behaves as if it were never defined: using it yields ErrUnknownFlag and it is
+// hidden from help and completion. When enabled is true the flag behaves normally.
+// The name may also be the short form of a flag, such as "x" for -x.
+func (f *FlagSet) MarkExperimental(name string, enabled bool) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.disabled = !enabled
+	}
+}
+
+// SetNameStyle sets the function FromStruct uses to derive long flag names from
+// struct field names that have no explicit `long` tag. The default is LowerCaseName;
+// use KebabCaseName for conventional multi-word flag names like --max-retries.
+// Must be called before FromStruct.
+func (f *FlagSet) SetNameStyle(style func(string) string) {
+	f.nameStyle = style
+}
+
+// SetCaseInsensitive makes long flag names match regardless of case, so --Verbose
+// and --VERBOSE both set --verbose. Long names are stored lowercased, including those
+// of flags already defined. Short flags and flag values are unaffected.
+func (f *FlagSet) SetCaseInsensitive(insensitive bool) {
+	f.caseInsensitive = insensitive
+	if !insensitive {
+		return
+	}
+	flags := make(map[string]*Flag, len(f.flags))
+	for name, flag := range f.flags {
+		flag.Name = strings.ToLower(flag.Name)
+		flags[strings.ToLower(name)] = flag
+	}
+	f.flags = flags
+}
+
+// SetFlagNormalizer sets a function applied to long flag names both when flags are
+// defined and when they are looked up, including on the command line, in config
+// files, and by Lookup. With a normalizer that maps "_" to "-", --log_level and
+// --log-level both set the flag defined as "log-level". Names of flags already
+// defined are normalized too, and help shows the normalized names.
+func (f *FlagSet) SetFlagNormalizer(normalize func(name string) string) {
+	f.normalizeName = normalize
+	flags := make(map[string]*Flag, len(f.flags))
+	for name, flag := range f.flags {
+		flag.Name = f.canonicalName(flag.Name)
+		flags[f.canonicalName(name)] = flag
+	}
+	f.flags = flags
+}
+
+// UnderscoreToHyphen is a flag normalizer that treats "_" and "-" in long flag
+// names as the same, for use with SetFlagNormalizer
+func UnderscoreToHyphen(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// canonicalName returns the form long flag names are stored and looked up in,
+// applying case insensitivity and the name normalizer
+func (f *FlagSet) canonicalName(name string) string {
+	if f.caseInsensitive {
+		name = strings.ToLower(name)
+	}
+	if f.normalizeName != nil && name != "" {
+		name = f.normalizeName(name)
+	}
+	return name
+}
+
+// SetInterspersed controls whether flags may follow non-flag arguments. It is true by default.
+// When false, parsing stops at the first non-flag argument, and it and all remaining arguments,
+// including ones that start with "-", are returned by Args and fill positional and rest fields.
+func (f *FlagSet) SetInterspersed(interspersed bool) {
+	f.noInterspersed = !interspersed
+}
+
+// SetAllowAbbrev lets long flags be abbreviated to any unique prefix, so --verb sets
+// --verbose. An exact match always wins. A prefix matching more than one flag
+// is reported as ErrAmbiguousFlag, or accumulated like an unknown flag when
+// AllowUnknownFlags is on.
+func (f *FlagSet) SetAllowAbbrev(allow bool) {
+	f.allowAbbrev = allow
+}
+
+// abbrevMatches returns the enabled long flags whose names start with prefix, sorted by name
+func (f *FlagSet) abbrevMatches(prefix string) []*Flag {
+	prefix = f.canonicalName(prefix)
+	var matches []*Flag
+	for name, flag := range f.flags {
+		if name != "" && !flag.disabled && strings.HasPrefix(name, prefix) {
+			matches = append(matches, flag)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Name < matches[j].Name
+	})
+	return matches
+}
+
+// longFlag returns the flag with the given long name, honoring case insensitivity
+// and the name normalizer
+func (f *FlagSet) longFlag(name string) (*Flag, bool) {
+	name = f.canonicalName(name)
+	flag, ok := f.flags[name]
+	return flag, ok
+}
+
+// flagByName returns the flag with the given long name, like longFlag, or if there
+// is none and name is a single character, the flag with that short form
+func (f *FlagSet) flagByName(name string) (*Flag, bool) {
+	if flag, ok := f.longFlag(name); ok {
+		return flag, true
+	}
+	if r := []rune(name); len(r) == 1 {
+		flag, ok := f.shortMap[r[0]]
+		return flag, ok
+	}
+	return nil, false
+}
+
+// Required marks the named flag as mandatory. Parse returns ErrRequiredFlag if a
+// required flag is not provided on the command line, even if it has a default value.
+func (f *FlagSet) Required(name string) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.required = true
+	}
+}
+
+// flagDependency is a constraint between flags checked after parsing. With flag set,
+// the needs flags are required whenever flag is provided. Otherwise needs is a group of
+// flags that must be provided together.
+type flagDependency struct {
+	flag  string
+	needs []string
+}
+
+// MarkRequires makes Parse fail with ErrRequiredFlag if flag is provided without
+// all of the needs flags, for example a --cert flag that needs --key.
+func (f *FlagSet) MarkRequires(flag string, needs ...string) {
+	f.dependencies = append(f.dependencies, flagDependency{flag: flag, needs: needs})
+}
+
+// MarkRequiredTogether makes Parse fail with ErrRequiredFlag if some but not all
+// of the named flags are provided.
+func (f *FlagSet) MarkRequiredTogether(names ...string) {
+	f.dependencies = append(f.dependencies, flagDependency{needs: names})
+}
+
+// SetEnv sets an environment variable to use as a fallback for the named flag.
+// During Parse, if the flag was not provided on the command line and the
+// variable is set, its value is applied to the flag. Command-line values always win.
+func (f *FlagSet) SetEnv(name string, envKey string) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.envKey = envKey
+	}
+}
+
+// SetValidator sets a function that checks the raw value of the named flag after it
+// has been set from the command line or the environment. A validation failure is
+// reported as ErrInvalidValue.
+func (f *FlagSet) SetValidator(name string, fn func(string) error) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.validator = fn
+	}
+}
+
+// SetChoices restricts the named flag to the given values. Any other value is
+// reported as ErrInvalidValue. The choices are also offered as completions.
+func (f *FlagSet) SetChoices(name string, allowed []string) {
+	if flag, ok := f.flagByName(name); ok {
+		flag.choices = allowed
+	}
+}
+
+// SetStrictPositions enables validation in FromStruct that position indices form a
+// contiguous sequence starting at 0. Gaps are allowed by default.
+func (f *FlagSet) SetStrictPositions(strict bool) {
+	f.strictPositions = strict
+}
+
+// validatePositions checks that positional fields occupy positions 0..N without gaps
+func (f *FlagSet) validatePositions() error {
+	maxPos := f.PositionalCount() - 1
+	for pos := 0; pos <= maxPos; pos++ {
+		if _, ok := f.posFields[pos]; ok {
+			continue
+		}
+		var defined []string
+		for i := 0; i <= maxPos; i++ {
+			if field, ok := f.posFields[i]; ok {
+				defined = append(defined, fmt.Sprintf("%s at %d", field.Name, i))
+			}
+		}
+		return fmt.Errorf("position indices must be contiguous: missing position %d (have %s)",
+			pos, strings.Join(defined, ", "))
+	}
+	return nil
 }
 
 // HasPositionalArgs returns true if the FlagSet has positional arguments defined
@@ -384,7 +2118,7 @@ func (f *FlagSet) HasPositionalArgs() bool {
 
 // HasRestArgs returns true if the FlagSet accepts remaining arguments
 func (f *FlagSet) HasRestArgs() bool {
-	return f.restField != nil
+	return f.restField != nil || f.restTyped.IsValid()
 }
 
 // PositionalCount returns the number of positional arguments defined
@@ -401,6 +2135,47 @@ func (f *FlagSet) PositionalCount() int {
 	return maxPos + 1
 }
 
+// positionRange returns the position of the range field, if one is defined
+func (f *FlagSet) positionRange() (int, bool) {
+	for pos, field := range f.posFields {
+		if field.Range {
+			return pos, true
+		}
+	}
+	return 0, false
+}
+
+// positionIndex returns the index in an argument list of length n for the fixed
+// position pos, or -1 if there are too few arguments to reach it. Positions after
+// a range are counted from the end of the arguments.
+func (f *FlagSet) positionIndex(pos, n int) int {
+	start, ok := f.positionRange()
+	if !ok || pos < start {
+		if pos < n {
+			return pos
+		}
+		return -1
+	}
+	idx := n - f.PositionalCount() + pos
+	if idx < start {
+		return -1
+	}
+	return idx
+}
+
+// rangeSpan returns the bounds of the arguments taken by the range field in an
+// argument list of length n: everything between the leading and trailing fixed positions
+func (f *FlagSet) rangeSpan(start, n int) (int, int) {
+	end := n - (f.PositionalCount() - 1 - start)
+	if start > n {
+		start = n
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
+
 // GetPositionalFields returns the positional fields in order
 func (f *FlagSet) GetPositionalFields() []*PositionalField {
 	if len(f.posFields) == 0 {
@@ -429,10 +2204,164 @@ func (f *FlagSet) GetPositionalFields() []*PositionalField {
 // which should not include the command name. Must be called after all flags are defined
 // and before flags are accessed by the program.
 // The return value will be ErrHelp if -help or -h were set but not defined.
+// If the flag set was configured with ExitOnError or PanicOnError, errors are
+// handled accordingly instead of being returned.
 func (f *FlagSet) Parse(arguments []string) error {
+	return f.handleError(f.parse(arguments, nil))
+}
+
+// ParseWithConfig is like Parse, but first loads flag values from the config
+// file at path. Values from the file override defaults, while values given on
+// the command line or through an environment variable override the file.
+//
+// The file is either a JSON object or lines of key=value pairs, with blank lines
+// and lines starting with # ignored. Keys are long flag names. Unknown keys are
+// an error unless SetAllowUnknownConfigKeys is enabled.
+func (f *FlagSet) ParseWithConfig(path string, arguments []string) error {
+	config, err := f.loadConfig(path)
+	if err != nil {
+		return f.handleError(err)
+	}
+	return f.handleError(f.parse(arguments, config))
+}
+
+// SetAllowUnknownConfigKeys controls whether ParseWithConfig ignores config file
+// keys that don't match a flag instead of returning ErrUnknownFlag
+func (f *FlagSet) SetAllowUnknownConfigKeys(allow bool) {
+	f.allowUnknownKeys = allow
+}
+
+// SetArgsFileExpansion controls whether Parse replaces any argument of the form
+// @path with the whitespace-separated contents of that file, as javac and similar
+// tools do. Arguments after -- are never expanded, and an args file may not
+// itself reference another args file.
+func (f *FlagSet) SetArgsFileExpansion(expand bool) {
+	f.expandArgsFiles = expand
+}
+
+// expandArgs replaces @path arguments with the contents of the named files
+func (f *FlagSet) expandArgs(arguments []string) ([]string, error) {
+	var expanded []string
+	for i, arg := range arguments {
+		if arg == "--" {
+			return append(expanded, arguments[i:]...), nil
+		}
+		if !strings.HasPrefix(arg, "@") || len(arg) == 1 {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		path := arg[1:]
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading args file %s: %w", path, err)
+		}
+		for _, fileArg := range strings.Fields(string(data)) {
+			if strings.HasPrefix(fileArg, "@") && len(fileArg) > 1 {
+				return nil, fmt.Errorf("args file %s: nested args file %s is not supported", path, fileArg)
+			}
+			expanded = append(expanded, fileArg)
+		}
+	}
+	return expanded, nil
+}
+
+// handleError applies the error handling mode to an error from parsing
+func (f *FlagSet) handleError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch f.errorHandling {
+	case ExitOnError:
+		if errors.Is(err, ErrHelp) {
+			os.Exit(0)
+		}
+		errOut := f.out
+		if errOut == nil {
+			errOut = os.Stderr
+		}
+		fmt.Fprintln(errOut, err)
+		os.Exit(2)
+	case PanicOnError:
+		panic(err)
+	}
+	return err
+}
+
+// Reset restores every flag to its default value and clears the results of the
+// previous Parse: remaining arguments, unknown flags, set-state, and positional,
+// rest, and unknown struct fields. Flag definitions are kept, so the FlagSet can
+// be parsed again as if it were freshly built. Flags whose default cannot be
+// restored are reported in the returned error, joined with errors.Join; the
+// remaining flags are still reset.
+func (f *FlagSet) Reset() error {
+	var errs []error
+	f.parsed = false
+	f.args = nil
+	f.dashIndex = -1
+	f.unknownFlags = nil
+	f.errs = nil
+	for _, flag := range f.allFlags {
+		flag.changed = false
+		flag.envSet = false
+		flag.configSet = false
+		if r, ok := flag.Value.(parseResetter); ok {
+			r.resetParse()
+		}
+		if d, ok := flag.Value.(defaultRestorer); ok {
+			d.restoreDefault()
+		} else if c, ok := flag.Value.(valueClearer); ok && flag.DefValue == "" {
+			c.clearValue()
+		} else if err := flag.Value.Set(flag.DefValue); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s (default %q): %v", ErrInvalidValue, flagDisplayName(flag), flag.DefValue, err))
+		}
+	}
+	for _, field := range f.posFields {
+		field.Value.Set(reflect.Zero(field.Value.Type()))
+	}
+	if f.restField != nil {
+		*f.restField = []string{}
+	}
+	if f.restTyped.IsValid() {
+		f.restTyped.Set(reflect.MakeSlice(f.restTyped.Type(), 0, 0))
+	}
+	if f.unknownField != nil {
+		*f.unknownField = nil
+	}
+	if f.passField != nil {
+		*f.passField = []string{}
+	}
+	return errors.Join(errs...)
+}
+
+// parse implements Parse without applying the error handling mode. Flags not set
+// by arguments or the environment take their value from config, if any.
+func (f *FlagSet) parse(arguments []string, config map[string]any) error {
 	f.parsed = true
 	f.args = nil
+	f.dashIndex = -1
+	if f.passField != nil {
+		*f.passField = []string{}
+	}
 	f.unknownFlags = nil
+	f.errs = nil
+	for _, flag := range f.allFlags {
+		flag.changed = false
+		flag.envSet = false
+		flag.configSet = false
+		if r, ok := flag.Value.(parseResetter); ok {
+			r.resetParse()
+		}
+	}
+
+	if f.expandArgsFiles {
+		expanded, err := f.expandArgs(arguments)
+		if err != nil {
+			return err
+		}
+		arguments = expanded
+	}
 
 	// Check for help flags (-h or --help) before parsing, stop at --
 	// If allowUnknownFlags is true, only show help if there are no other arguments
@@ -441,14 +2370,20 @@ func (f *FlagSet) Parse(arguments []string) error {
 		hasHelpFlag := false
 		hasOtherArgs := false
 
-		for _, arg := range arguments {
+		for i := 0; i < len(arguments); i++ {
+			arg := arguments[i]
 			if arg == "--" {
 				break
 			}
+			if f.noInterspersed && f.takesNextArg(arg) {
+				// Skip the flag's value so it isn't mistaken for the first positional
+				i++
+				continue
+			}
 			if arg == "-h" || arg == "--help" {
 				// Check if these flags are already defined
 				_, hDefined := f.shortMap['h']
-				_, helpDefined := f.flags["help"]
+				_, helpDefined := f.longFlag("help")
 
 				// If help flags are not defined, mark that we found a help flag
 				if (arg == "-h" && !hDefined) || (arg == "--help" && !helpDefined) {
@@ -457,6 +2392,10 @@ func (f *FlagSet) Parse(arguments []string) error {
 			} else if !strings.HasPrefix(arg, "-") {
 				// Found a non-flag argument
 				hasOtherArgs = true
+				// Without interspersed flags, everything from here on is positional
+				if f.noInterspersed {
+					break
+				}
 			}
 		}
 
@@ -473,14 +2412,21 @@ func (f *FlagSet) Parse(arguments []string) error {
 		arg := arguments[i]
 
 		if arg == "--" {
+			f.dashIndex = i
 			f.args = append(f.args, arguments[i+1:]...)
+			if f.passField != nil {
+				*f.passField = slices.Clone(arguments[i+1:])
+			}
 			break
 		}
 
 		if strings.HasPrefix(arg, "--") {
 			consumed, err := f.parseLongFlag(arg[2:], arguments, &i)
 			if err != nil {
-				return err
+				if err := f.fail(err); err != nil {
+					return err
+				}
+				continue
 			}
 			if consumed {
 				continue
@@ -491,26 +2437,83 @@ func (f *FlagSet) Parse(arguments []string) error {
 		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
 			err := f.parseShortFlags(arg[1:], arguments, &i)
 			if err != nil {
-				return err
+				if err := f.fail(err); err != nil {
+					return err
+				}
 			}
 			continue
 		}
 
+		if f.noInterspersed {
+			f.args = append(f.args, arguments[i:]...)
+			break
+		}
+
 		f.args = append(f.args, arg)
 	}
 
-	// Process positional arguments
-	for pos, field := range f.posFields {
-		if pos < len(f.args) {
-			if err := setFieldValue(field.Value, f.args[pos]); err != nil {
-				return fmt.Errorf("invalid value for position %d: %v", pos, err)
+	// Fall back to environment variables for flags not given on the command line
+	if err := f.applyEnv(); err != nil {
+		return err
+	}
+	if err := f.applyConfig(config); err != nil {
+		return err
+	}
+
+	// Process positional arguments in order, then report missing required ones,
+	// so errors are reported deterministically
+	var missing []int
+	for _, pos := range slices.Sorted(maps.Keys(f.posFields)) {
+		field := f.posFields[pos]
+		if field.Range {
+			start, end := f.rangeSpan(pos, len(f.args))
+			field.Value.Set(reflect.ValueOf(slices.Clone(f.args[start:end])))
+			continue
+		}
+		idx := f.positionIndex(pos, len(f.args))
+		if idx < 0 {
+			if field.Required {
+				missing = append(missing, pos)
+			}
+			continue
+		}
+		if err := setPositionalValue(field.Value, f.args[idx]); err != nil {
+			if err := f.fail(fmt.Errorf("invalid value for position %d: %v", pos, err)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, pos := range missing {
+		if err := f.fail(fmt.Errorf("%w: missing %s (position %d)", ErrTooFewArgs, f.posFields[pos].Name, pos)); err != nil {
+			return err
+		}
+	}
+
+	// In strict mode, arguments without a field to take them are an error
+	if f.strictArgs && !f.HasRestArgs() {
+		if extra := f.extraArgs(); len(extra) > 0 {
+			if err := f.fail(fmt.Errorf("%w: unexpected %s", ErrTooManyArgs, strings.Join(extra, " "))); err != nil {
+				return err
 			}
 		}
 	}
 
 	// If we have a rest field, populate it with remaining args
-	if f.restField != nil {
-		*f.restField = f.args
+	if f.HasRestArgs() {
+		rest := f.restArgs()
+		if err := f.setRest(rest); err != nil {
+			return err
+		}
+		if len(rest) < f.restMin {
+			if err := f.fail(fmt.Errorf("%w: need at least %d, got %d", ErrTooFewArgs, f.restMin, len(rest))); err != nil {
+				return err
+			}
+		}
+		if f.restMax > 0 && len(rest) > f.restMax {
+			if err := f.fail(fmt.Errorf("%w: need at most %d, got %d", ErrTooManyArgs, f.restMax, len(rest))); err != nil {
+				return err
+			}
+		}
 	}
 
 	// If we have an unknown field, populate it with unknown flags
@@ -518,7 +2521,274 @@ func (f *FlagSet) Parse(arguments []string) error {
 		*f.unknownField = f.unknownFlags
 	}
 
-	return nil
+	if err := f.checkRequired(); err != nil {
+		if err := f.fail(err); err != nil {
+			return err
+		}
+	}
+	for _, err := range f.checkDependencies() {
+		if err := f.fail(err); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(f.errs...)
+}
+
+// restArgs returns a copy of the arguments for the rest field: all non-flag
+// arguments, or with SetRestExcludesPositional, those not assigned to a positional field
+func (f *FlagSet) restArgs() []string {
+	if !f.restExcludesPos || len(f.posFields) == 0 {
+		return slices.Clone(f.args)
+	}
+
+	consumed := f.positionalIndices()
+	rest := []string{}
+	for i, arg := range f.args {
+		if !consumed[i] {
+			rest = append(rest, arg)
+		}
+	}
+	return rest
+}
+
+// positionalIndices returns the indices in Args of the arguments assigned to positional fields
+func (f *FlagSet) positionalIndices() map[int]bool {
+	consumed := make(map[int]bool)
+	for pos, field := range f.posFields {
+		if field.Range {
+			start, end := f.rangeSpan(pos, len(f.args))
+			for i := start; i < end; i++ {
+				consumed[i] = true
+			}
+		} else if idx := f.positionIndex(pos, len(f.args)); idx >= 0 {
+			consumed[idx] = true
+		}
+	}
+	return consumed
+}
+
+// extraArgs returns the arguments in Args that no positional or passthrough field takes
+func (f *FlagSet) extraArgs() []string {
+	n := len(f.args)
+	if f.passField != nil {
+		n -= len(*f.passField)
+	}
+	consumed := f.positionalIndices()
+	var extra []string
+	for i, arg := range f.args[:n] {
+		if !consumed[i] {
+			extra = append(extra, arg)
+		}
+	}
+	return extra
+}
+
+// setRest stores args in the rest field, parsing each one into the element
+// type of a typed rest field
+func (f *FlagSet) setRest(args []string) error {
+	if f.restField != nil {
+		*f.restField = args
+		return nil
+	}
+
+	rest := reflect.MakeSlice(f.restTyped.Type(), len(args), len(args))
+	for i, arg := range args {
+		if err := setFieldValue(rest.Index(i), arg); err != nil {
+			if err := f.fail(fmt.Errorf("%w: argument %d %q: %v", ErrInvalidValue, i, arg, err)); err != nil {
+				return err
+			}
+		}
+	}
+	f.restTyped.Set(rest)
+	return nil
+}
+
+// applyEnv sets flags that were not provided on the command line from their environment variables
+func (f *FlagSet) applyEnv() error {
+	for _, flag := range f.allFlags {
+		if flag.envKey == "" || flag.changed || flag.disabled {
+			continue
+		}
+		value, ok := os.LookupEnv(flag.envKey)
+		if !ok {
+			continue
+		}
+		if err := flag.set(value); err != nil {
+			if err := f.fail(fmt.Errorf("%w: %s (from $%s): %v", ErrInvalidValue, flagDisplayName(flag), flag.envKey, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		flag.envSet = true
+	}
+	return nil
+}
+
+// applyConfig sets flags that were not given on the command line or through the
+// environment from config file values, keyed by long flag name
+func (f *FlagSet) applyConfig(config map[string]any) error {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		flag, ok := f.longFlag(key)
+		if !ok || flag.disabled || flag.isSet() {
+			continue
+		}
+
+		raw := config[key]
+		if sv, ok := flag.Value.(*stringArrayValue); ok {
+			raw = joinMapArray(raw, sv.separator())
+		}
+		value, err := formatMapValue(raw)
+		if err == nil {
+			err = flag.set(value)
+		}
+		if err != nil {
+			if err := f.fail(fmt.Errorf("%w: %s (from config): %v", ErrInvalidValue, flagDisplayName(flag), err)); err != nil {
+				return err
+			}
+			continue
+		}
+		flag.configSet = true
+	}
+	return nil
+}
+
+// loadConfig reads the config file at path into values keyed by flag name,
+// checking that every key names a flag unless unknown keys are allowed
+func (f *FlagSet) loadConfig(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	config := make(map[string]any)
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", path, err)
+		}
+	} else {
+		for i, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("parsing config %s: line %d: expected key=value", path, i+1)
+			}
+			value = strings.TrimSpace(value)
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			config[strings.TrimSpace(key)] = value
+		}
+	}
+
+	if !f.allowUnknownKeys {
+		for key := range config {
+			if flag, ok := f.longFlag(key); !ok || flag.disabled {
+				return nil, fmt.Errorf("%w: %s (in config %s)", ErrUnknownFlag, key, path)
+			}
+		}
+	}
+	return config, nil
+}
+
+// isSet reports whether the flag was set on the command line, from the environment,
+// or from a config file
+func (flag *Flag) isSet() bool {
+	return flag.changed || flag.envSet || flag.configSet
+}
+
+// checkRequired returns ErrRequiredFlag listing every required flag that was not set
+// on the command line or from the environment
+func (f *FlagSet) checkRequired() error {
+	var missing []string
+	f.VisitAll(func(flag *Flag) {
+		if flag.required && !flag.isSet() {
+			missing = append(missing, flagDisplayName(flag))
+		}
+	})
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrRequiredFlag, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkDependencies returns an ErrRequiredFlag error for each dependency constraint
+// that is not satisfied
+func (f *FlagSet) checkDependencies() []error {
+	var errs []error
+	for _, dep := range f.dependencies {
+		var set, missing []string
+		for _, name := range dep.needs {
+			flag, ok := f.flagByName(name)
+			if !ok || flag.disabled {
+				continue
+			}
+			if flag.isSet() {
+				set = append(set, flagDisplayName(flag))
+			} else {
+				missing = append(missing, flagDisplayName(flag))
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		if dep.flag == "" {
+			if len(set) > 0 {
+				errs = append(errs, fmt.Errorf("%w: %s (required together with %s)", ErrRequiredFlag, strings.Join(missing, ", "), strings.Join(set, ", ")))
+			}
+			continue
+		}
+
+		if flag, ok := f.flagByName(dep.flag); ok && !flag.disabled && flag.isSet() {
+			errs = append(errs, fmt.Errorf("%w: %s (required by %s)", ErrRequiredFlag, strings.Join(missing, ", "), flagDisplayName(flag)))
+		}
+	}
+	return errs
+}
+
+// flagDisplayName returns the flag as it would be written on the command line
+func flagDisplayName(flag *Flag) string {
+	if flag.Name != "" {
+		return "--" + flag.Name
+	}
+	return fmt.Sprintf("-%c", flag.Short)
+}
+
+// takesNextArg reports whether arg is a known flag that consumes the following
+// argument as its value
+func (f *FlagSet) takesNextArg(arg string) bool {
+	if name, ok := strings.CutPrefix(arg, "--"); ok {
+		if strings.Contains(name, "=") {
+			return false
+		}
+		flag, ok := f.longFlag(name)
+		return ok && !flag.disabled && !flag.Value.IsBool() && !flag.optional
+	}
+	if !strings.HasPrefix(arg, "-") || arg == "-" {
+		return false
+	}
+	runes := []rune(arg[1:])
+	for i, r := range runes {
+		flag, ok := f.shortMap[r]
+		if !ok || flag.disabled {
+			return false
+		}
+		if !flag.Value.IsBool() {
+			// A value attached to the cluster leaves the next argument alone
+			return i == len(runes)-1 && !flag.optional
+		}
+	}
+	return false
 }
 
 func (f *FlagSet) parseLongFlag(name string, args []string, index *int) (bool, error) {
@@ -532,34 +2802,57 @@ func (f *FlagSet) parseLongFlag(name string, args []string, index *int) (bool, e
 		hasValue = true
 	}
 
-	flag, ok := f.flags[name]
-	if !ok {
+	flag, ok := f.longFlag(name)
+	if (!ok || flag.disabled) && f.allowAbbrev {
+		switch matches := f.abbrevMatches(name); {
+		case len(matches) == 1:
+			flag, ok = matches[0], true
+		case len(matches) > 1 && !f.allowUnknownFlags:
+			// With unknown flags allowed, an ambiguous prefix is accumulated
+			// below like any other flag this set does not own
+			names := make([]string, len(matches))
+			for i, m := range matches {
+				names[i] = "--" + m.Name
+			}
+			return false, &ParseError{
+				Flag: "--" + name,
+				Kind: ParseErrorAmbiguous,
+				Err:  fmt.Errorf("matches %s", strings.Join(names, ", ")),
+			}
+		}
+	}
+	if !ok || flag.disabled {
 		if f.allowUnknownFlags {
 			// Unknown flag encountered - accumulate this and all remaining args
 			f.unknownFlags = append(f.unknownFlags, args[*index:]...)
 			*index = len(args) - 1 // Skip to end
 			return true, nil
 		}
-		return false, fmt.Errorf("%w: --%s", ErrUnknownFlag, name)
+		return false, &ParseError{Flag: "--" + name, Kind: ParseErrorUnknown}
 	}
 
 	if flag.Value.IsBool() {
 		if !hasValue {
 			value = "true"
 		}
+	} else if flag.optional {
+		if !hasValue {
+			value = flag.ifPresent
+		}
 	} else {
 		if !hasValue {
 			if *index+1 >= len(args) {
-				return false, fmt.Errorf("%w: --%s", ErrMissingValue, name)
+				return false, &ParseError{Flag: "--" + name, Kind: ParseErrorMissing}
 			}
 			value = args[*index+1]
 			*index++
 		}
 	}
 
-	if err := flag.Value.Set(value); err != nil {
-		return false, fmt.Errorf("%w: --%s: %v", ErrInvalidValue, name, err)
+	if err := flag.set(value); err != nil {
+		return false, &ParseError{Flag: "--" + name, Kind: ParseErrorInvalid, Err: err}
 	}
+	flag.changed = true
 
 	return true, nil
 }
@@ -570,43 +2863,60 @@ func (f *FlagSet) parseShortFlags(shortFlags string, args []string, index *int)
 	for i := 0; i < len(runes); i++ {
 		r := runes[i]
 		flag, ok := f.shortMap[r]
-		if !ok {
+		if !ok || flag.disabled {
 			if f.allowUnknownFlags {
 				// Unknown flag encountered - accumulate this and all remaining args
 				f.unknownFlags = append(f.unknownFlags, args[*index:]...)
 				*index = len(args) - 1 // Skip to end
 				return nil
 			}
-			return fmt.Errorf("%w: -%c", ErrUnknownFlag, r)
+			return &ParseError{Flag: "-" + string(r), Kind: ParseErrorUnknown}
 		}
 
 		if flag.Value.IsBool() {
-			if err := flag.Value.Set("true"); err != nil {
-				return fmt.Errorf("%w: -%c: %v", ErrInvalidValue, r, err)
+			if err := flag.set("true"); err != nil {
+				return &ParseError{Flag: "-" + string(r), Kind: ParseErrorInvalid, Err: err}
 			}
+			flag.changed = true
 		} else {
 			// Check if there are more characters after this flag
-			if i < len(runes)-1 {
+			if i < len(runes)-1 && runes[i+1] == '=' {
+				// -o=value: strip a single "=", so -o==x sets "=x"
+				value := string(runes[i+2:])
+				if err := flag.set(value); err != nil {
+					return &ParseError{Flag: "-" + string(r), Kind: ParseErrorInvalid, Err: err}
+				}
+				flag.changed = true
+				break
+			} else if i < len(runes)-1 {
 				// Check if the next character is also a flag that needs an argument
 				nextRune := runes[i+1]
-				if nextFlag, exists := f.shortMap[nextRune]; exists && !nextFlag.Value.IsBool() {
+				if nextFlag, exists := f.shortMap[nextRune]; exists && !nextFlag.Value.IsBool() && !flag.optional {
 					// Both flags need arguments, this is an error
-					return fmt.Errorf("%w: -%c", ErrMissingValue, r)
+					return &ParseError{Flag: "-" + string(r), Kind: ParseErrorMissing}
 				}
 				// Otherwise use the rest as the value
 				value := string(runes[i+1:])
-				if err := flag.Value.Set(value); err != nil {
-					return fmt.Errorf("%w: -%c: %v", ErrInvalidValue, r, err)
+				if err := flag.set(value); err != nil {
+					return &ParseError{Flag: "-" + string(r), Kind: ParseErrorInvalid, Err: err}
 				}
+				flag.changed = true
 				break
+			} else if flag.optional {
+				// Optional values must be attached, so a bare flag takes its ifPresent value
+				if err := flag.set(flag.ifPresent); err != nil {
+					return &ParseError{Flag: "-" + string(r), Kind: ParseErrorInvalid, Err: err}
+				}
+				flag.changed = true
 			} else if *index+1 < len(args) {
 				value := args[*index+1]
 				*index++
-				if err := flag.Value.Set(value); err != nil {
-					return fmt.Errorf("%w: -%c: %v", ErrInvalidValue, r, err)
+				if err := flag.set(value); err != nil {
+					return &ParseError{Flag: "-" + string(r), Kind: ParseErrorInvalid, Err: err}
 				}
+				flag.changed = true
 			} else {
-				return fmt.Errorf("%w: -%c", ErrMissingValue, r)
+				return &ParseError{Flag: "-" + string(r), Kind: ParseErrorMissing}
 			}
 			break
 		}
@@ -615,9 +2925,21 @@ func (f *FlagSet) parseShortFlags(shortFlags string, args []string, index *int)
 	return nil
 }
 
-// Args returns the non-flag arguments.
+// Args returns the non-flag arguments. The slice is a copy, so changing it does
+// not affect the FlagSet or the rest field.
 func (f *FlagSet) Args() []string {
-	return f.args
+	return slices.Clone(f.args)
+}
+
+// TerminatorIndex returns the index of the -- terminator in the arguments given to
+// the last Parse, after any @file expansion, or -1 if there was none or Parse has
+// not been called. Together with a passthrough field, it tells an invocation
+// without -- apart from one with nothing after it.
+func (f *FlagSet) TerminatorIndex() int {
+	if !f.parsed {
+		return -1
+	}
+	return f.dashIndex
 }
 
 // Parsed reports whether f.Parse has been called.
@@ -639,13 +2961,316 @@ func (f *FlagSet) UnknownFlags() []string {
 	return f.unknownFlags
 }
 
+// ParseResult summarizes the outcome of a Parse, for diagnosing how arguments
+// were interpreted.
+type ParseResult struct {
+	SetFlags   []string       // Flags set on the command line, from the environment, or from a config file, in definition order
+	Positional map[int]string // Arguments assigned to fixed positional fields, keyed by position
+	Rest       []string       // Non-flag arguments remaining after parsing, as returned by Args
+	Unknown    []string       // Unknown flags accumulated when AllowUnknownFlags is enabled
+	DashIndex  int            // Index of the -- terminator in the arguments, or -1 if there was none
+}
+
+// ParseResult returns a summary of the last Parse. It is built on demand from
+// the state Parse already keeps, so it costs nothing unless called. Before
+// Parse, it returns an empty result with a DashIndex of -1.
+func (f *FlagSet) ParseResult() ParseResult {
+	result := ParseResult{DashIndex: -1}
+	if !f.parsed {
+		return result
+	}
+
+	for _, flag := range f.allFlags {
+		if flag.isSet() {
+			result.SetFlags = append(result.SetFlags, flagDisplayName(flag))
+		}
+	}
+	for pos, field := range f.posFields {
+		if field.Range {
+			continue
+		}
+		if idx := f.positionIndex(pos, len(f.args)); idx >= 0 {
+			if result.Positional == nil {
+				result.Positional = make(map[int]string)
+			}
+			result.Positional[pos] = f.args[idx]
+		}
+	}
+	result.Rest = f.Args()
+	result.Unknown = f.unknownFlags
+	result.DashIndex = f.TerminatorIndex()
+	return result
+}
+
+// ArgsFromMap converts a map of argument names to values into an argument list
+// suitable for Parse. Keys are matched against long flag names, short flag names
+// (single character keys), and lowercased positional field names. The special key
+// "arguments" supplies the rest arguments as an array.
+// Flags are emitted in sorted order, followed by "--" and any positional and rest arguments.
+// A positional argument omitted before one that is given is reported as ErrTooFewArgs.
+func (f *FlagSet) ArgsFromMap(m map[string]any) ([]string, error) {
+	positionalFields := f.GetPositionalFields()
+	positionalNames := make(map[string]bool)
+	for _, field := range positionalFields {
+		positionalNames[strings.ToLower(field.Name)] = true
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if key == "arguments" || positionalNames[key] {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		flag, ok := f.flagByName(key)
+		if !ok || flag.disabled {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownFlag, key)
+		}
+
+		flagName := "--" + flag.Name
+		if flag.Name == "" {
+			flagName = fmt.Sprintf("-%c", flag.Short)
+		}
+
+		raw := m[key]
+		if _, ok := flag.Value.(*stringMapValue); ok {
+			pairs, err := mapObjectArgs(key, raw)
+			if err != nil {
+				return nil, err
+			}
+			for _, pair := range pairs {
+				args = append(args, flagName, pair)
+			}
+			continue
+		}
+		if sv, ok := flag.Value.(*stringArrayValue); ok {
+			raw = joinMapArray(raw, sv.separator())
+		}
+		value, err := formatMapValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidValue, key, err)
+		}
+
+		if flag.Value.IsBool() {
+			switch {
+			case value == "true":
+				args = append(args, flagName)
+			case flag.Name != "":
+				args = append(args, flagName+"="+value)
+			case value != flag.DefValue:
+				// A short flag cannot take an attached value, so only true and
+				// the default can be expressed
+				return nil, fmt.Errorf("%w: %s: %s has no long name and can only be set to true", ErrInvalidValue, key, flagName)
+			}
+			continue
+		}
+		if flag.optional {
+			// Optional values must be attached to the flag
+			args = append(args, flagName+"="+value)
+			continue
+		}
+		args = append(args, flagName, value)
+	}
+
+	// Positional arguments are placed in position order, up to the last one provided
+	var positionalArgs []string
+	last := -1
+	for i, field := range positionalFields {
+		if _, ok := m[strings.ToLower(field.Name)]; ok {
+			last = i
+		}
+	}
+	for i := 0; i <= last; i++ {
+		val, ok := m[strings.ToLower(positionalFields[i].Name)]
+		if positionalFields[i].Range {
+			// A range contributes each element of its array, or nothing if omitted
+			if ok {
+				values, err := mapArrayArgs(strings.ToLower(positionalFields[i].Name), val)
+				if err != nil {
+					return nil, err
+				}
+				positionalArgs = append(positionalArgs, values...)
+			}
+			continue
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: missing %s, needed before %s", ErrTooFewArgs, positionalFields[i].Name, positionalFields[last].Name)
+		}
+		value, err := formatMapValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidValue, positionalFields[i].Name, err)
+		}
+		positionalArgs = append(positionalArgs, value)
+	}
+
+	// Rest arguments come last
+	if rest, ok := m["arguments"]; ok {
+		values, err := mapArrayArgs("arguments", rest)
+		if err != nil {
+			return nil, err
+		}
+		positionalArgs = append(positionalArgs, values...)
+	}
+
+	if len(positionalArgs) > 0 {
+		args = append(args, "--")
+		args = append(args, positionalArgs...)
+	}
+
+	return args, nil
+}
+
+// joinMapArray joins array values with sep so they round-trip through a
+// string array flag; other values are returned unchanged
+func joinMapArray(v any, sep string) any {
+	var items []any
+	switch vals := v.(type) {
+	case []string:
+		for _, item := range vals {
+			items = append(items, item)
+		}
+	case []any:
+		items = vals
+	default:
+		return v
+	}
+
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		part, err := formatMapValue(item)
+		if err != nil {
+			return v
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, sep)
+}
+
+// mapArrayArgs converts an array from an argument map into one argument per element
+func mapArrayArgs(key string, raw any) ([]string, error) {
+	switch vals := raw.(type) {
+	case []string:
+		return vals, nil
+	case []any:
+		args := make([]string, 0, len(vals))
+		for _, val := range vals {
+			value, err := formatMapValue(val)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrInvalidValue, key, err)
+			}
+			args = append(args, value)
+		}
+		return args, nil
+	default:
+		return nil, fmt.Errorf("%w: %s: expected an array, got %T", ErrInvalidValue, key, raw)
+	}
+}
+
+// mapObjectArgs converts an object from an argument map into key=value pairs in
+// key order. A string is passed through as a single pair.
+func mapObjectArgs(key string, raw any) ([]string, error) {
+	var obj map[string]any
+	switch vals := raw.(type) {
+	case string:
+		return []string{vals}, nil
+	case map[string]string:
+		obj = make(map[string]any, len(vals))
+		for k, v := range vals {
+			obj[k] = v
+		}
+	case map[string]any:
+		obj = vals
+	default:
+		return nil, fmt.Errorf("%w: %s: expected an object, got %T", ErrInvalidValue, key, raw)
+	}
+
+	pairs := make([]string, 0, len(obj))
+	for _, k := range slices.Sorted(maps.Keys(obj)) {
+		value, err := formatMapValue(obj[k])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidValue, key, err)
+		}
+		pairs = append(pairs, k+"="+value)
+	}
+	return pairs, nil
+}
+
+// formatMapValue converts a decoded value (such as from JSON) into its command-line form
+func formatMapValue(v any) (string, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", val), nil
+	case fmt.Stringer:
+		return val.String(), nil
+	case []string:
+		return strings.Join(val, ","), nil
+	case []any:
+		parts := make([]string, 0, len(val))
+		for _, item := range val {
+			part, err := formatMapValue(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, ","), nil
+	case nil:
+		return "", fmt.Errorf("value cannot be null")
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
+
+// isRestElem reports whether a rest field may have elements of type t: strings,
+// or numbers parsed from each argument
+func isRestElem(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setPositionalValue sets a positional field from an argument, allocating the
+// value of a pointer field
+func setPositionalValue(fieldValue reflect.Value, value string) error {
+	if fieldValue.Kind() != reflect.Ptr {
+		return setFieldValue(fieldValue, value)
+	}
+	elem := reflect.New(fieldValue.Type().Elem())
+	if err := setFieldValue(elem.Elem(), value); err != nil {
+		return err
+	}
+	fieldValue.Set(elem)
+	return nil
+}
+
 // setFieldValue sets a string value to a reflect.Value based on its type
 func setFieldValue(fieldValue reflect.Value, value string) error {
+	if v, ok := registeredValue(fieldValue); ok {
+		return v.Set(value)
+	}
+
 	switch fieldValue.Kind() {
 	case reflect.String:
 		fieldValue.SetString(value)
 	case reflect.Bool:
-		b, err := strconv.ParseBool(value)
+		b, err := parseBool(value)
 		if err != nil {
 			return err
 		}
@@ -682,19 +3307,88 @@ func setFieldValue(fieldValue reflect.Value, value string) error {
 	return nil
 }
 
+// typeRegistry maps field types to factories for their flag values. See RegisterType.
+var typeRegistry = struct {
+	sync.RWMutex
+	factories map[reflect.Type]func(reflect.Value) Value
+}{factories: make(map[reflect.Type]func(reflect.Value) Value)}
+
+// RegisterType makes FromStruct support fields of the same type as example, such as a
+// custom enum type. For each such field, factory is called with the addressable field
+// value and returns the Value that parses into it. Positional fields of the type are
+// parsed with the factory's Value as well.
+//
+// Registered types are resolved before the built-in kinds, so registering a type such as
+// time.Duration replaces its built-in handling. The match is on the exact type: registering
+// Color does not cover *Color.
+func RegisterType(example interface{}, factory func(reflect.Value) Value) {
+	typeRegistry.Lock()
+	defer typeRegistry.Unlock()
+	typeRegistry.factories[reflect.TypeOf(example)] = factory
+}
+
+// registeredValue returns the Value for fieldValue from its registered factory, if any
+func registeredValue(fieldValue reflect.Value) (Value, bool) {
+	typeRegistry.RLock()
+	factory, ok := typeRegistry.factories[fieldValue.Type()]
+	typeRegistry.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return factory(fieldValue), true
+}
+
 // FromStruct creates flag definitions from a struct's fields using struct tags.
 // The argument must be a pointer to a struct. Struct tags control how fields are parsed:
-//   - `long:"name"` - long flag name (defaults to lowercase field name)
+//   - `long:"name"` - long flag name (defaults to the field name converted by the name style, see SetNameStyle);
+//     `long:"-"` defines a short-only flag
 //   - `short:"x"` - short flag name (single character)
 //   - `default:"value"` - default value for the flag
 //   - `usage:"description"` - usage description
-//   - `position:"0"` - positional argument at index 0
-//   - `rest:"true"` - capture all remaining arguments in a []string field
+//   - `position:"0"` - positional argument at index 0 (two fields at the same index are an error);
+//     value fields are required, while pointer fields such as *string are optional and stay nil
+//     when missing. `required:"false"` makes a value field optional.
+//   - `position:"1.."` - on a []string field, the positional arguments from index 1 up to those taken
+//     by higher positions, which are counted from the end (only one range is allowed)
+//   - `rest:"true"` - capture all remaining arguments in a []string field, or parse each one
+//     into a slice of numbers such as []int or []float64
+//   - `min:"1"` - on a rest field, the minimum number of non-flag arguments (see RestWithMin)
+//   - `max:"2"` - on a rest field, the maximum number of non-flag arguments (see RestWithRange)
+//   - `passthrough:"true"` - capture the arguments after -- verbatim in a []string field
+//     (they are still included in Args and the rest field)
 //   - `unknown:"true"` - capture unknown flags in a []string field (automatically enables AllowUnknownFlags)
+//   - `append:"true"` - on a []string field, repeated flags append instead of replace
+//   - `sep:";"` - on a []string field, the separator between elements (defaults to a comma)
+//   - `count:"true"` - on an int field, count how many times the flag is given (e.g., -vvv)
+//   - `env:"VAR"` - environment variable to read when the flag is not provided on the command line
+//   - `required:"true"` - the flag must be provided on the command line or via its environment variable
+//   - `experimental:"ENV_VAR"` - only enable the flag when the environment variable is set to a true value
+//   - `choices:"a,b,c"` - restrict the flag to the listed values
+//   - `group:"Network"` - list the flag under this section in help output
+//   - `showdefault:"true"` - show the default in help output even when it is the zero value
+//   - `time:"2006-01-02"` - layout for a time.Time field (default: RFC3339)
+//   - `bytesize:"true"` - on an int64 field, accept sizes with units such as 10MB or 2GiB
+//   - `absolute:"true"` - on a *url.URL field, require a scheme and host
 //
-// Supports bool, string, int, []string, and time.Duration field types.
-// Anonymous embedded structs are recursively processed.
+// Supports bool, string, int, int64, uint, uint64, []string, []int, []float64, time.Duration,
+// time.Time, net.IP, *net.IPNet, and *url.URL field types. Nil *net.IPNet and *url.URL
+// fields are allocated and left as zero values until a value is given.
+// Pointers to bool, string, int, int64, uint, uint64, and time.Duration stay nil until
+// the flag is set or has a default, so an unset flag can be told apart from a zero value.
+// Anonymous embedded structs and struct pointers are recursively processed; nil
+// embedded pointers are allocated.
 func (f *FlagSet) FromStruct(v any) error {
+	if err := f.fromStruct(v); err != nil {
+		return err
+	}
+	if f.strictPositions {
+		return f.validatePositions()
+	}
+	return nil
+}
+
+// fromStruct registers the fields of a struct, descending into embedded structs
+func (f *FlagSet) fromStruct(v any) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return fmt.Errorf("FromStruct requires a non-nil pointer to a struct")
@@ -719,7 +3413,18 @@ func (f *FlagSet) FromStruct(v any) error {
 
 		// Check for anonymous/embedded struct fields and descend into them
 		if field.Anonymous && field.Type.Kind() == reflect.Struct {
-			if err := f.FromStruct(fieldValue.Addr().Interface()); err != nil {
+			if err := f.fromStruct(fieldValue.Addr().Interface()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Embedded struct pointers are allocated if nil and descended into the same way
+		if field.Anonymous && field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+			if fieldValue.IsNil() {
+				fieldValue.Set(reflect.New(field.Type.Elem()))
+			}
+			if err := f.fromStruct(fieldValue.Interface()); err != nil {
 				return err
 			}
 			continue
@@ -727,25 +3432,71 @@ func (f *FlagSet) FromStruct(v any) error {
 
 		// Check for "position" tag - capture positional argument
 		if posStr := field.Tag.Get("position"); posStr != "" {
-			pos, err := strconv.Atoi(posStr)
+			startStr, isRange := strings.CutSuffix(posStr, "..")
+			pos, err := strconv.Atoi(startStr)
 			if err == nil && pos >= 0 {
-				f.posFields[pos] = &PositionalField{
-					Name:  field.Name,
-					Value: fieldValue,
-					Type:  field.Type,
+				posField := &PositionalField{
+					Name:     field.Name,
+					Value:    fieldValue,
+					Type:     field.Type,
+					Usage:    field.Tag.Get("usage"),
+					Range:    isRange,
+					Required: !isRange && field.Type.Kind() != reflect.Ptr,
+				}
+				if required, err := strconv.ParseBool(field.Tag.Get("required")); err == nil {
+					posField.Required = required
+				}
+				if existing, ok := f.posFields[pos]; ok {
+					return positionConflict(pos, existing, posField)
 				}
+				if isRange {
+					if field.Type != reflect.TypeOf([]string(nil)) {
+						return fmt.Errorf("position range for field %s requires a []string field", field.Name)
+					}
+					if start, ok := f.positionRange(); ok {
+						return fmt.Errorf("position ranges are used by both %s and %s", f.posFields[start].Name, field.Name)
+					}
+				}
+				f.posFields[pos] = posField
 			}
 			continue // Don't process position field as a flag
 		}
 
 		// Check for "rest" tag - special handling for remaining arguments
 		if field.Tag.Get("rest") != "" {
-			if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String {
-				f.restField = fieldValue.Addr().Interface().(*[]string)
+			if field.Type.Kind() == reflect.Slice && isRestElem(field.Type.Elem()) {
+				if field.Type.Elem().Kind() == reflect.String {
+					f.restField = fieldValue.Addr().Interface().(*[]string)
+				} else {
+					f.restTyped = fieldValue
+				}
+				f.restMin, f.restMax = 0, 0
+				if minStr := field.Tag.Get("min"); minStr != "" {
+					minArgs, err := strconv.Atoi(minStr)
+					if err != nil || minArgs < 0 {
+						return fmt.Errorf("invalid min for field %s: %q", field.Name, minStr)
+					}
+					f.restMin = minArgs
+				}
+				if maxStr := field.Tag.Get("max"); maxStr != "" {
+					maxArgs, err := strconv.Atoi(maxStr)
+					if err != nil || maxArgs < 1 || maxArgs < f.restMin {
+						return fmt.Errorf("invalid max for field %s: %q", field.Name, maxStr)
+					}
+					f.restMax = maxArgs
+				}
 			}
 			continue // Don't process rest field as a flag
 		}
 
+		// Check for "passthrough" tag - capture the arguments after --
+		if field.Tag.Get("passthrough") != "" {
+			if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String {
+				f.passField = fieldValue.Addr().Interface().(*[]string)
+			}
+			continue // Don't process passthrough field as a flag
+		}
+
 		// Check for "unknown" tag - special handling for unknown flags
 		if field.Tag.Get("unknown") != "" {
 			if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String {
@@ -757,8 +3508,14 @@ func (f *FlagSet) FromStruct(v any) error {
 
 		// Parse struct tags
 		longName := field.Tag.Get("long")
-		if longName == "" {
-			longName = strings.ToLower(field.Name)
+		if longName == "-" {
+			longName = "" // Short-only flag
+		} else if longName == "" {
+			if f.nameStyle != nil {
+				longName = f.nameStyle(field.Name)
+			} else {
+				longName = LowerCaseName(field.Name)
+			}
 		}
 
 		shortName := field.Tag.Get("short")
@@ -771,18 +3528,38 @@ func (f *FlagSet) FromStruct(v any) error {
 			continue // No flag name provided
 		}
 
+		if f.strictRegister {
+			if err := f.checkDuplicate(longName, short); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+
 		defaultValue := field.Tag.Get("default")
 		usage := field.Tag.Get("usage")
 		if usage == "" {
 			usage = fmt.Sprintf("%s value", field.Name)
 		}
 
+		// Types registered with RegisterType take precedence over built-in kinds
+		if value, ok := registeredValue(fieldValue); ok {
+			if defaultValue != "" {
+				if err := value.Set(defaultValue); err != nil {
+					return fmt.Errorf("invalid default for field %s: %w", field.Name, err)
+				}
+			}
+			f.Var(value, longName, short, usage)
+			f.applyFieldTags(field, f.allFlags[len(f.allFlags)-1])
+			continue
+		}
+
+		defined := len(f.allFlags)
+
 		// Register the flag based on field type
 		switch field.Type.Kind() {
 		case reflect.Bool:
 			var defVal bool
 			if defaultValue != "" {
-				defVal, _ = strconv.ParseBool(defaultValue)
+				defVal, _ = parseBool(defaultValue)
 			}
 			f.BoolVar(fieldValue.Addr().Interface().(*bool), longName, short, defVal, usage)
 
@@ -790,22 +3567,140 @@ func (f *FlagSet) FromStruct(v any) error {
 			f.StringVar(fieldValue.Addr().Interface().(*string), longName, short, defaultValue, usage)
 
 		case reflect.Int:
+			if isCount, _ := strconv.ParseBool(field.Tag.Get("count")); isCount {
+				f.CountVar(fieldValue.Addr().Interface().(*int), longName, short, usage)
+				break
+			}
 			var defVal int
 			if defaultValue != "" {
 				defVal, _ = strconv.Atoi(defaultValue)
 			}
 			f.IntVar(fieldValue.Addr().Interface().(*int), longName, short, defVal, usage)
 
+		case reflect.Uint:
+			var defVal uint64
+			if defaultValue != "" {
+				defVal, _ = strconv.ParseUint(defaultValue, 10, strconv.IntSize)
+			}
+			f.UintVar(fieldValue.Addr().Interface().(*uint), longName, short, uint(defVal), usage)
+
+		case reflect.Uint64:
+			var defVal uint64
+			if defaultValue != "" {
+				defVal, _ = strconv.ParseUint(defaultValue, 10, 64)
+			}
+			f.Uint64Var(fieldValue.Addr().Interface().(*uint64), longName, short, defVal, usage)
+
 		case reflect.Slice:
-			if field.Type.Elem().Kind() == reflect.String {
+			if field.Type == reflect.TypeOf(net.IP{}) {
+				var defVal net.IP
+				if defaultValue != "" {
+					defVal = net.ParseIP(defaultValue)
+				}
+				f.IPVar(fieldValue.Addr().Interface().(*net.IP), longName, short, defVal, usage)
+				break
+			}
+			switch field.Type.Elem().Kind() {
+			case reflect.String:
+				sep := field.Tag.Get("sep")
+				if sep == "" {
+					sep = ","
+				}
 				var defVal []string
 				if defaultValue != "" {
-					defVal = strings.Split(defaultValue, ",")
+					defVal = strings.Split(defaultValue, sep)
+				}
+				appendMode, _ := strconv.ParseBool(field.Tag.Get("append"))
+				p := fieldValue.Addr().Interface().(*[]string)
+				if defVal != nil {
+					*p = defVal
+				} else {
+					*p = []string{}
+				}
+				f.Var(&stringArrayValue{value: p, sep: sep, appendMode: appendMode}, longName, short, usage)
+
+			case reflect.Int:
+				var defVal []int
+				if defaultValue != "" {
+					var v intSliceValue
+					if err := v.Set(defaultValue); err == nil {
+						defVal = v
+					}
+				}
+				f.IntSliceVar(fieldValue.Addr().Interface().(*[]int), longName, short, defVal, usage)
+
+			case reflect.Float64:
+				var defVal []float64
+				if defaultValue != "" {
+					var v float64SliceValue
+					if err := v.Set(defaultValue); err == nil {
+						defVal = v
+					}
+				}
+				f.Float64SliceVar(fieldValue.Addr().Interface().(*[]float64), longName, short, defVal, usage)
+			}
+
+		case reflect.Map:
+			if field.Type == reflect.TypeOf(map[string]string{}) {
+				f.StringMapVar(fieldValue.Addr().Interface().(*map[string]string), longName, short, usage)
+			}
+
+		case reflect.Ptr:
+			if field.Type == reflect.TypeOf(&net.IPNet{}) {
+				var defVal net.IPNet
+				if defaultValue != "" {
+					if _, n, err := net.ParseCIDR(defaultValue); err == nil {
+						defVal = *n
+					}
+				}
+				if fieldValue.IsNil() {
+					fieldValue.Set(reflect.New(field.Type.Elem()))
+				}
+				f.IPNetVar(fieldValue.Interface().(*net.IPNet), longName, short, defVal, usage)
+			} else if field.Type == reflect.TypeOf(&url.URL{}) {
+				var defVal *url.URL
+				if defaultValue != "" {
+					defVal, _ = url.Parse(defaultValue)
+				}
+				if fieldValue.IsNil() {
+					fieldValue.Set(reflect.New(field.Type.Elem()))
+				}
+				f.URLVar(fieldValue.Interface().(*url.URL), longName, short, defVal, usage)
+				if absolute, _ := strconv.ParseBool(field.Tag.Get("absolute")); absolute {
+					f.allFlags[len(f.allFlags)-1].Value.(*urlValue).absolute = true
+				}
+			} else if value, ok := newPointerValue(fieldValue); ok {
+				// Pointers to basic types stay nil unless the flag or a default sets them
+				if defaultValue != "" {
+					if err := value.Set(defaultValue); err != nil {
+						return fmt.Errorf("invalid default for field %s: %w", field.Name, err)
+					}
+				}
+				f.Var(value, longName, short, usage)
+			}
+
+		case reflect.Struct:
+			if field.Type == reflect.TypeOf(time.Time{}) {
+				layout := field.Tag.Get("time")
+				if layout == "" {
+					layout = time.RFC3339
+				}
+				var defVal time.Time
+				if defaultValue != "" {
+					defVal, _ = parseTime(defaultValue, layout, f.now())
 				}
-				f.StringArrayVar(fieldValue.Addr().Interface().(*[]string), longName, short, defVal, usage)
+				f.TimeVar(fieldValue.Addr().Interface().(*time.Time), longName, short, defVal, layout, usage)
 			}
 
 		case reflect.Int64:
+			if isByteSize, _ := strconv.ParseBool(field.Tag.Get("bytesize")); isByteSize {
+				var defVal int64
+				if defaultValue != "" {
+					defVal, _ = parseByteSize(defaultValue)
+				}
+				f.ByteSizeVar(fieldValue.Addr().Interface().(*int64), longName, short, defVal, usage)
+				break
+			}
 			// Check if it's a time.Duration
 			if field.Type == reflect.TypeOf(time.Duration(0)) {
 				var defVal time.Duration
@@ -813,64 +3708,87 @@ func (f *FlagSet) FromStruct(v any) error {
 					defVal, _ = time.ParseDuration(defaultValue)
 				}
 				f.DurationVar(fieldValue.Addr().Interface().(*time.Duration), longName, short, defVal, usage)
+			} else {
+				var defVal int64
+				if defaultValue != "" {
+					defVal, _ = strconv.ParseInt(defaultValue, 10, 64)
+				}
+				f.Int64Var(fieldValue.Addr().Interface().(*int64), longName, short, defVal, usage)
 			}
 		}
+
+		// Fields of unsupported types don't define a flag
+		if len(f.allFlags) > defined {
+			f.applyFieldTags(field, f.allFlags[defined])
+		}
 	}
 
 	return nil
 }
 
+// applyFieldTags applies the struct tags that configure a flag after it is
+// defined. It works on the flag directly so that short-only flags are covered.
+func (f *FlagSet) applyFieldTags(field reflect.StructField, flag *Flag) {
+	if envKey := field.Tag.Get("env"); envKey != "" {
+		flag.envKey = envKey
+	}
+
+	if required, _ := strconv.ParseBool(field.Tag.Get("required")); required {
+		flag.required = true
+	}
+
+	if choices := field.Tag.Get("choices"); choices != "" {
+		allowed := strings.Split(choices, ",")
+		for i := range allowed {
+			allowed[i] = strings.TrimSpace(allowed[i])
+		}
+		flag.choices = allowed
+	}
+
+	if show, _ := strconv.ParseBool(field.Tag.Get("showdefault")); show {
+		flag.showDefault = true
+	}
+
+	if group := field.Tag.Get("group"); group != "" {
+		f.setFlagGroup(flag, group)
+	}
+
+	// Gate the flag behind an environment variable if marked experimental
+	if gate := field.Tag.Get("experimental"); gate != "" {
+		enabled, _ := strconv.ParseBool(os.Getenv(gate))
+		name := flag.Name
+		if name == "" {
+			name = string(flag.Short)
+		}
+		f.MarkExperimental(name, enabled)
+	}
+}
+
 // ShowHelp displays help information for the flag set, including all defined flags
 // and their usage information.
 func (f *FlagSet) ShowHelp() {
+	out := f.output()
 	if f.name != "" {
-		fmt.Printf("Usage: %s [options]", f.name)
+		fmt.Fprintf(out, "Usage: %s [options]", f.name)
 		// Check if there are positional arguments expected
 		hasPositional := false
 		if len(f.posFields) > 0 {
 			hasPositional = true
 		}
-		if f.restField != nil {
+		if f.HasRestArgs() {
 			hasPositional = true
 		}
 		if hasPositional {
-			fmt.Print(" [arguments]")
+			fmt.Fprint(out, " [arguments]")
 		}
-		fmt.Println()
+		fmt.Fprintln(out)
 	}
 
-	// Show flags if any are defined
-	hasFlags := false
-	f.VisitAll(func(flag *Flag) {
-		if !hasFlags {
-			fmt.Println("\nOptions:")
-			hasFlags = true
-		}
-
-		// Format flag display
-		var flagStr string
-		if flag.Short != 0 && flag.Name != "" {
-			flagStr = fmt.Sprintf("  -%c, --%s", flag.Short, flag.Name)
-		} else if flag.Short != 0 {
-			flagStr = fmt.Sprintf("  -%c", flag.Short)
-		} else {
-			flagStr = fmt.Sprintf("      --%s", flag.Name)
-		}
-
-		// Add value placeholder for non-boolean flags
-		if !flag.Value.IsBool() {
-			flagStr += fmt.Sprintf(" <%s>", flag.Value.Type())
-		}
-
-		// Print flag with usage
-		if flag.Usage != "" {
-			fmt.Printf("%-30s %s", flagStr, flag.Usage)
-			if flag.DefValue != "" && flag.DefValue != "false" && flag.DefValue != "0" {
-				fmt.Printf(" (default: %s)", flag.DefValue)
-			}
-			fmt.Println()
-		} else {
-			fmt.Println(flagStr)
+	// Show flags if any are defined, by section
+	f.visitGrouped(nil, func(group string, flags []*Flag) {
+		fmt.Fprintf(out, "\n%s:\n", group)
+		for _, flag := range flags {
+			printFlagHelp(out, flag, terminalWidth())
 		}
 	})
 }
@@ -885,3 +3803,16 @@ func ParseStruct(v any, arguments []string) error {
 	}
 	return fs.Parse(arguments)
 }
+
+// ParseStructArgs is like ParseStruct but also returns the non-flag arguments.
+// This is useful when a struct has no rest field but the caller still needs the leftover arguments.
+func ParseStructArgs(v any, arguments []string) ([]string, error) {
+	fs := NewFlagSet("")
+	if err := fs.FromStruct(v); err != nil {
+		return nil, err
+	}
+	if err := fs.Parse(arguments); err != nil {
+		return nil, err
+	}
+	return fs.Args(), nil
+}
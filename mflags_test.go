@@ -2,8 +2,16 @@ package mflags
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"net"
+	"net/url"
 	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -162,6 +170,59 @@ func TestBoolFlagWithExplicitValue(t *testing.T) {
 	assert.Empty(t, fs.Args())
 }
 
+func TestBoolFlagWordValues(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bool
+	}{
+		{"yes", true},
+		{"YES", true},
+		{"y", true},
+		{"Y", true},
+		{"on", true},
+		{"On", true},
+		{"no", false},
+		{"No", false},
+		{"n", false},
+		{"N", false},
+		{"off", false},
+		{"OFF", false},
+		{"true", true},
+		{"0", false},
+	}
+
+	for _, tt := range tests {
+		fs := NewFlagSet("test")
+		verbose := fs.Bool("verbose", 'v', !tt.expected, "verbose output")
+		err := fs.Parse([]string{"--verbose=" + tt.value})
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.expected, *verbose, tt.value)
+	}
+
+	fs := NewFlagSet("test")
+	fs.Bool("verbose", 'v', false, "verbose output")
+	err := fs.Parse([]string{"--verbose=maybe"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	// Struct fields and positionals accept the same words
+	type Config struct {
+		Force  bool  `long:"force" default:"yes"`
+		Enable bool  `position:"0"`
+		Debug  *bool `long:"debug"`
+	}
+	config := &Config{}
+	err = ParseStruct(config, []string{"on", "--debug=off"})
+	assert.NoError(t, err)
+	assert.True(t, config.Force)
+	assert.True(t, config.Enable)
+	if assert.NotNil(t, config.Debug) {
+		assert.False(t, *config.Debug)
+	}
+
+	err = ParseStruct(&Config{}, []string{"maybe"})
+	assert.Error(t, err)
+}
+
 func TestDefaultValues(t *testing.T) {
 	fs := NewFlagSet("test")
 	verbose := fs.Bool("verbose", 'v', true, "verbose output")
@@ -878,16 +939,54 @@ func TestPositionMissing(t *testing.T) {
 	err := fs.FromStruct(config)
 	assert.NoError(t, err)
 
-	// Only provide first position
+	// Only provide first position; value positionals are required
 	err = fs.Parse([]string{"run", "--verbose"})
-	assert.NoError(t, err)
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+	assert.ErrorContains(t, err, "missing Target (position 1)")
 
 	assert.Equal(t, "run", config.Command)
-	assert.Equal(t, "", config.Target) // Missing position gets zero value
-	assert.Equal(t, 0, config.Count)   // Missing position gets zero value
 	assert.True(t, config.Verbose)
 }
 
+type ConfigWithOptionalPosition struct {
+	Command string  `position:"0"`
+	Target  *string `position:"1"`
+	Count   int     `position:"2" required:"false"`
+	Limit   *int    `position:"3"`
+}
+
+func TestPositionOptional(t *testing.T) {
+	config := &ConfigWithOptionalPosition{}
+	fs := NewFlagSet("test")
+
+	err := fs.FromStruct(config)
+	assert.NoError(t, err)
+
+	// Pointer positionals stay nil and required:"false" keeps the zero value
+	err = fs.Parse([]string{"run"})
+	assert.NoError(t, err)
+	assert.Equal(t, "run", config.Command)
+	assert.Nil(t, config.Target)
+	assert.Equal(t, 0, config.Count)
+
+	err = fs.Parse([]string{"run", "web", "3"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, config.Target) {
+		assert.Equal(t, "web", *config.Target)
+	}
+	assert.Equal(t, 3, config.Count)
+
+	err = fs.Parse(nil)
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+	assert.ErrorContains(t, err, "missing Command (position 0)")
+
+	schema := fs.JSONSchema()
+	assert.Equal(t, []string{"command"}, schema.Required)
+	assert.Equal(t, "string", schema.Properties["target"].Type)
+	assert.Equal(t, "integer", schema.Properties["count"].Type)
+	assert.Equal(t, "integer", schema.Properties["limit"].Type)
+}
+
 type ConfigWithGaps struct {
 	First  string `position:"0"`
 	Third  string `position:"2"`
@@ -969,6 +1068,35 @@ func TestPositionInvalidValue(t *testing.T) {
 	assert.Contains(t, err.Error(), "invalid value for position 2")
 }
 
+func TestPositionInvalidValueOrder(t *testing.T) {
+	type Config struct {
+		A int `position:"0"`
+		B int `position:"1"`
+		C int `position:"2"`
+		D int `position:"3"`
+	}
+	args := []string{"a", "b", "c", "d"}
+
+	// Errors are reported in position order, every time
+	for range 20 {
+		fs := NewFlagSet("test")
+		assert.NoError(t, fs.FromStruct(&Config{}))
+		err := fs.Parse(args)
+		assert.ErrorContains(t, err, "invalid value for position 0")
+
+		fs = NewFlagSet("test")
+		fs.SetCollectErrors(true)
+		assert.NoError(t, fs.FromStruct(&Config{}))
+		assert.Error(t, fs.Parse(args))
+		errs := fs.Errors()
+		if assert.Len(t, errs, 4) {
+			for i, err := range errs {
+				assert.ErrorContains(t, err, fmt.Sprintf("invalid value for position %d", i))
+			}
+		}
+	}
+}
+
 type ConfigWithHighPosition struct {
 	Item string `position:"10"`
 }
@@ -981,9 +1109,9 @@ func TestPositionHigherThanArgs(t *testing.T) {
 	assert.NoError(t, err)
 
 	err = fs.Parse([]string{"one", "two", "three"})
-	assert.NoError(t, err)
+	assert.ErrorIs(t, err, ErrTooFewArgs)
 
-	// Position 10 doesn't exist, so field remains at zero value
+	// Position 10 is required but missing, so Parse fails and the field is left unset
 	assert.Equal(t, "", config.Item)
 }
 
@@ -1108,6 +1236,51 @@ func TestFromStructEmbeddedShortFlags(t *testing.T) {
 	assert.Equal(t, "shortapp", config.AppName)
 }
 
+type EmbeddedPointerConfig struct {
+	*DatabaseConfig
+	*ServerConfig
+	AppName string `long:"app-name" short:"a" default:"myapp" usage:"Application name"`
+}
+
+func TestFromStructEmbeddedPointer(t *testing.T) {
+	config := &EmbeddedPointerConfig{}
+	fs := NewFlagSet("test")
+
+	err := fs.FromStruct(config)
+	assert.NoError(t, err)
+	assert.NotNil(t, config.DatabaseConfig)
+	assert.NotNil(t, config.ServerConfig)
+
+	err = fs.Parse([]string{
+		"--db-host", "db.example.com",
+		"--server-port", "9000",
+		"-v",
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "db.example.com", config.Host)
+	assert.Equal(t, 5432, config.DatabaseConfig.Port)
+	assert.Equal(t, 9000, config.ServerConfig.Port)
+	assert.True(t, config.Verbose)
+	assert.Equal(t, "myapp", config.AppName)
+}
+
+func TestFromStructEmbeddedPointerExisting(t *testing.T) {
+	shared := &DatabaseConfig{}
+	config := &EmbeddedPointerConfig{DatabaseConfig: shared}
+	fs := NewFlagSet("test")
+
+	err := fs.FromStruct(config)
+	assert.NoError(t, err)
+
+	err = fs.Parse([]string{"--db-port", "3306"})
+	assert.NoError(t, err)
+
+	// An existing embedded pointer is reused rather than replaced
+	assert.Same(t, shared, config.DatabaseConfig)
+	assert.Equal(t, 3306, shared.Port)
+}
+
 // Tests for AllowUnknownFlags feature
 
 func TestAllowUnknownFlagsLong(t *testing.T) {
@@ -1797,3 +1970,2436 @@ func TestShortOnlyFlags(t *testing.T) {
 		assert.True(t, *debug)
 	})
 }
+
+func TestArgsFromMap(t *testing.T) {
+	type Config struct {
+		Verbose bool     `long:"verbose" short:"v"`
+		Color   bool     `long:"color" default:"true"`
+		Count   int      `long:"count"`
+		Tags    []string `long:"tags"`
+		Source  string   `position:"0"`
+		Dest    string   `position:"1"`
+		Files   []string `rest:"true"`
+	}
+
+	config := &Config{}
+	fs := NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(config))
+	quiet := fs.Bool("", 'q', false, "quiet")
+
+	args, err := fs.ArgsFromMap(map[string]any{
+		"verbose":   true,
+		"color":     false,
+		"count":     float64(1000000),
+		"tags":      []any{"a", "b"},
+		"q":         true,
+		"source":    "-src",
+		"dest":      "dst",
+		"arguments": []any{"x", float64(2)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--color=false", "--count", "1000000", "-q", "--tags", "a,b", "--verbose",
+		"--", "-src", "dst", "x", "2",
+	}, args)
+
+	assert.NoError(t, fs.Parse(args))
+	assert.True(t, config.Verbose)
+	assert.False(t, config.Color)
+	assert.Equal(t, 1000000, config.Count)
+	assert.Equal(t, []string{"a", "b"}, config.Tags)
+	assert.True(t, *quiet)
+	assert.Equal(t, "-src", config.Source)
+	assert.Equal(t, "dst", config.Dest)
+
+	_, err = fs.ArgsFromMap(map[string]any{"missing": "x"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	_, err = fs.ArgsFromMap(map[string]any{"count": map[string]any{}})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	// A short-only bool can be set to true or left at its default, but nothing else
+	loud := fs.Bool("", 'L', true, "loud")
+	fs.Count("", 'x', "debug level")
+	args, err = fs.ArgsFromMap(map[string]any{"q": false, "L": true, "x": 0, "source": "s", "dest": "d"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-L", "--", "s", "d"}, args)
+	assert.NoError(t, fs.Parse(args))
+	assert.True(t, *loud)
+
+	_, err = fs.ArgsFromMap(map[string]any{"L": false})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), "-L has no long name")
+
+	_, err = fs.ArgsFromMap(map[string]any{"x": 2})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	// A positional argument cannot be skipped to reach a later one
+	_, err = fs.ArgsFromMap(map[string]any{"dest": "dst"})
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+	assert.Contains(t, err.Error(), "missing Source")
+}
+
+func TestTimeFlag(t *testing.T) {
+	now := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+
+	fs := NewFlagSet("test")
+	fs.SetClock(func() time.Time { return now })
+	start := fs.Time("start", 's', time.Time{}, "", "start time")
+	day := fs.Time("day", 'd', time.Time{}, "2006-01-02", "day")
+
+	err := fs.Parse([]string{"--start", "2024-01-02T15:04:05Z", "-d", "2024-02-01"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), *start)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), *day)
+	assert.Equal(t, "2024-02-01", fs.Lookup("day").Value.String())
+
+	tests := []struct {
+		input    string
+		expected time.Time
+	}{
+		{"now", now},
+		{"today", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"tomorrow", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"+1h", now.Add(time.Hour)},
+		{"-30m", now.Add(-30 * time.Minute)},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			err := fs.Parse([]string{"--start", test.input})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, *start)
+		})
+	}
+
+	err = fs.Parse([]string{"--start", "not-a-time"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestTimeFlagFromStruct(t *testing.T) {
+	type Config struct {
+		Since time.Time `long:"since" default:"yesterday"`
+		Until time.Time `long:"until"`
+	}
+
+	now := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	fs := NewFlagSet("test")
+	fs.SetClock(func() time.Time { return now })
+
+	config := &Config{}
+	assert.NoError(t, fs.FromStruct(config))
+	assert.NoError(t, fs.Parse([]string{"--until", "+2h"}))
+
+	assert.Equal(t, time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC), config.Since)
+	assert.Equal(t, now.Add(2*time.Hour), config.Until)
+}
+
+func TestTimeFlagLayoutTag(t *testing.T) {
+	type Config struct {
+		Date  time.Time `long:"date" time:"2006-01-02" default:"2024-01-02"`
+		Start time.Time `long:"start"`
+	}
+
+	config := &Config{}
+	fs := NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(config))
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), config.Date)
+	assert.Equal(t, "2024-01-02", fs.Lookup("date").DefValue)
+
+	err := fs.Parse([]string{"--date", "2024-06-30", "--start", "2024-01-02T15:04:05Z"})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC), config.Date)
+	assert.Equal(t, time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), config.Start)
+
+	// String round-trips through the same layout
+	assert.Equal(t, "2024-06-30", fs.Lookup("date").Value.String())
+	assert.Equal(t, "2024-01-02T15:04:05Z", fs.Lookup("start").Value.String())
+
+	err = fs.Parse([]string{"--date", "2024-01-02T15:04:05Z"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestParseStructArgs(t *testing.T) {
+	type Config struct {
+		Verbose bool   `long:"verbose" short:"v"`
+		Name    string `long:"name"`
+	}
+
+	config := &Config{}
+	args, err := ParseStructArgs(config, []string{"-v", "first", "--name", "test", "second"})
+	assert.NoError(t, err)
+	assert.True(t, config.Verbose)
+	assert.Equal(t, "test", config.Name)
+	assert.Equal(t, []string{"first", "second"}, args)
+
+	_, err = ParseStructArgs(config, []string{"--unknown"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+}
+
+func TestExperimentalFlags(t *testing.T) {
+	fs := NewFlagSet("test")
+	turbo := fs.Bool("turbo", 't', false, "enable turbo mode")
+	fs.Bool("verbose", 'v', false, "verbose output")
+
+	fs.MarkExperimental("turbo", false)
+
+	err := fs.Parse([]string{"--turbo"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+	err = fs.Parse([]string{"-t"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	// Disabled flags are hidden from completion and help
+	assert.Equal(t, []string{"--verbose"}, fs.GetLongFlags())
+	assert.Equal(t, []string{"-v"}, fs.GetShortFlags())
+	var values []string
+	for _, c := range fs.GetFlagCompletions("") {
+		values = append(values, c.Value)
+	}
+	assert.Equal(t, []string{"--verbose", "-v"}, values)
+
+	old := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	fs.ShowHelp()
+	w.Close()
+	os.Stdout = old
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	assert.NotContains(t, buf.String(), "turbo")
+
+	// Once enabled, the flag behaves normally
+	fs.MarkExperimental("turbo", true)
+	err = fs.Parse([]string{"--turbo"})
+	assert.NoError(t, err)
+	assert.True(t, *turbo)
+
+	// Short-only flags are named by their short form
+	fast := fs.Bool("", 'f', false, "go fast")
+	fs.MarkExperimental("f", false)
+	err = fs.Parse([]string{"-f"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+	fs.MarkExperimental("f", true)
+	err = fs.Parse([]string{"-f"})
+	assert.NoError(t, err)
+	assert.True(t, *fast)
+}
+
+func TestExperimentalStructTag(t *testing.T) {
+	type Config struct {
+		Turbo bool `long:"turbo" experimental:"MFLAGS_TEST_TURBO"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"--turbo"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	t.Setenv("MFLAGS_TEST_TURBO", "1")
+	config = &Config{}
+	err = ParseStruct(config, []string{"--turbo"})
+	assert.NoError(t, err)
+	assert.True(t, config.Turbo)
+
+	type ShortConfig struct {
+		Fast bool `long:"-" short:"f" experimental:"MFLAGS_TEST_FAST"`
+	}
+
+	err = ParseStruct(&ShortConfig{}, []string{"-f"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	t.Setenv("MFLAGS_TEST_FAST", "true")
+	shortConfig := &ShortConfig{}
+	err = ParseStruct(shortConfig, []string{"-f"})
+	assert.NoError(t, err)
+	assert.True(t, shortConfig.Fast)
+}
+
+func TestKebabCaseName(t *testing.T) {
+	tests := map[string]string{
+		"Verbose":     "verbose",
+		"MaxRetries":  "max-retries",
+		"HTTPServer":  "http-server",
+		"UserID":      "user-id",
+		"LogLevel2":   "log-level2",
+		"APIKeyValue": "api-key-value",
+		"Log_Level":   "log-level",
+		"HTTP_Port":   "http-port",
+		"max__depth":  "max-depth",
+		"_Internal_":  "internal",
+	}
+	for input, expected := range tests {
+		assert.Equal(t, expected, KebabCaseName(input), input)
+	}
+}
+
+func TestFromStructNameStyle(t *testing.T) {
+	type Config struct {
+		MaxRetries int    `default:"3"`
+		LogLevel   string `default:"info"`
+		DryRun     bool
+		Output     string `long:"out"`
+	}
+
+	// Default style lowercases field names
+	fs := NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(&Config{}))
+	assert.NotNil(t, fs.Lookup("maxretries"))
+	assert.Nil(t, fs.Lookup("max-retries"))
+
+	// Kebab style inserts hyphens at word boundaries
+	config := &Config{}
+	fs = NewFlagSet("test")
+	fs.SetNameStyle(KebabCaseName)
+	assert.NoError(t, fs.FromStruct(config))
+
+	err := fs.Parse([]string{"--max-retries", "5", "--log-level", "debug", "--dry-run", "--out", "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, config.MaxRetries)
+	assert.Equal(t, "debug", config.LogLevel)
+	assert.True(t, config.DryRun)
+	assert.Equal(t, "x", config.Output)
+}
+
+func TestStrictPositions(t *testing.T) {
+	type GapConfig struct {
+		Source string `position:"0"`
+		Dest   string `position:"2"`
+	}
+
+	// Gaps are allowed by default
+	fs := NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(&GapConfig{}))
+
+	fs = NewFlagSet("test")
+	fs.SetStrictPositions(true)
+	err := fs.FromStruct(&GapConfig{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing position 1")
+	assert.Contains(t, err.Error(), "Source at 0")
+	assert.Contains(t, err.Error(), "Dest at 2")
+
+	// Contiguous positions, including ones from embedded structs, are accepted
+	type Base struct {
+		Source string `position:"0"`
+	}
+	type Config struct {
+		Base
+		Dest string `position:"1"`
+	}
+	fs = NewFlagSet("test")
+	fs.SetStrictPositions(true)
+	assert.NoError(t, fs.FromStruct(&Config{}))
+
+	fs = NewFlagSet("test")
+	fs.SetStrictPositions(true)
+	assert.NoError(t, fs.FromStruct(&ConfigWithGaps{}))
+}
+
+func TestUintFlags(t *testing.T) {
+	fs := NewFlagSet("test")
+	port := fs.Uint("port", 'p', 8080, "port")
+	size := fs.Uint64("size", 's', 0, "size")
+
+	err := fs.Parse([]string{"-p", "9000", "--size", "18446744073709551615"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(9000), *port)
+	assert.Equal(t, uint64(18446744073709551615), *size)
+	assert.Equal(t, "8080", fs.Lookup("port").DefValue)
+
+	err = fs.Parse([]string{"--port", "-5"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	err = fs.Parse([]string{"--size", "abc"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestUintFlagsFromStruct(t *testing.T) {
+	type Config struct {
+		Port uint   `long:"port" default:"8080"`
+		Size uint64 `long:"size" default:"1024"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(8080), config.Port)
+	assert.Equal(t, uint64(1024), config.Size)
+
+	err = ParseStruct(config, []string{"--port", "443", "--size", "4096"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint(443), config.Port)
+	assert.Equal(t, uint64(4096), config.Size)
+
+	err = ParseStruct(config, []string{"--port", "-5"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestInt64Flag(t *testing.T) {
+	fs := NewFlagSet("test")
+	bytes := fs.Int64("bytes", 'b', 0, "byte count")
+
+	err := fs.Parse([]string{"--bytes", "9223372036854775807"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9223372036854775807), *bytes)
+
+	err = fs.Parse([]string{"-b", "-42"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-42), *bytes)
+
+	err = fs.Parse([]string{"--bytes", "1.5"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestInt64FromStruct(t *testing.T) {
+	type Config struct {
+		Bytes   int64         `long:"bytes" default:"5000000000"`
+		Timeout time.Duration `long:"timeout" default:"5s"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5000000000), config.Bytes)
+	assert.Equal(t, 5*time.Second, config.Timeout)
+
+	err = ParseStruct(config, []string{"--bytes", "123", "--timeout", "1m"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(123), config.Bytes)
+	assert.Equal(t, time.Minute, config.Timeout)
+}
+
+func TestRequiredFlags(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.String("name", 'n', "", "name")
+	fs.Int("count", 'c', 1, "count")
+	fs.Bool("verbose", 'v', false, "verbose")
+	fs.Required("name")
+	fs.Required("count")
+
+	err := fs.Parse([]string{"-v"})
+	assert.ErrorIs(t, err, ErrRequiredFlag)
+	assert.Contains(t, err.Error(), "--count, --name")
+
+	err = fs.Parse([]string{"--name", "x"})
+	assert.ErrorIs(t, err, ErrRequiredFlag)
+	assert.Contains(t, err.Error(), "--count")
+	assert.NotContains(t, err.Error(), "--name")
+
+	// Setting a flag explicitly to its default still counts as provided
+	err = fs.Parse([]string{"-n", "x", "--count", "1"})
+	assert.NoError(t, err)
+}
+
+func TestRequiredStructTag(t *testing.T) {
+	type Config struct {
+		Target string `long:"target" required:"true"`
+		Debug  bool   `long:"debug"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"--debug"})
+	assert.ErrorIs(t, err, ErrRequiredFlag)
+	assert.Contains(t, err.Error(), "--target")
+
+	err = ParseStruct(config, []string{"--target", "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", config.Target)
+}
+
+func TestEnvFallback(t *testing.T) {
+	t.Setenv("MFLAGS_TEST_NAME", "from-env")
+	t.Setenv("MFLAGS_TEST_TIMEOUT", "3s")
+	t.Setenv("MFLAGS_TEST_TAGS", "a,b")
+
+	fs := NewFlagSet("test")
+	name := fs.String("name", 'n', "default", "name")
+	timeout := fs.Duration("timeout", 0, time.Second, "timeout")
+	tags := fs.StringArray("tags", 0, nil, "tags")
+	fs.SetEnv("name", "MFLAGS_TEST_NAME")
+	fs.SetEnv("timeout", "MFLAGS_TEST_TIMEOUT")
+	fs.SetEnv("tags", "MFLAGS_TEST_TAGS")
+
+	err := fs.Parse([]string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", *name)
+	assert.Equal(t, 3*time.Second, *timeout)
+	assert.Equal(t, []string{"a", "b"}, *tags)
+
+	// Command-line values win over the environment
+	err = fs.Parse([]string{"--name", "from-flag"})
+	assert.NoError(t, err)
+	assert.Equal(t, "from-flag", *name)
+
+	t.Setenv("MFLAGS_TEST_TIMEOUT", "bogus")
+	err = fs.Parse([]string{})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), "MFLAGS_TEST_TIMEOUT")
+}
+
+func TestEnvStructTag(t *testing.T) {
+	type Config struct {
+		Token string `long:"token" env:"MFLAGS_TEST_TOKEN" required:"true"`
+		Port  int    `long:"port" env:"MFLAGS_TEST_PORT" default:"80"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{})
+	assert.ErrorIs(t, err, ErrRequiredFlag)
+
+	t.Setenv("MFLAGS_TEST_TOKEN", "secret")
+	t.Setenv("MFLAGS_TEST_PORT", "8080")
+	config = &Config{}
+	err = ParseStruct(config, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", config.Token)
+	assert.Equal(t, 8080, config.Port)
+}
+
+func TestCountFlag(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{}, 0},
+		{[]string{"-v"}, 1},
+		{[]string{"-vvv"}, 3},
+		{[]string{"--verbose", "--verbose"}, 2},
+		{[]string{"-vv", "--verbose", "-qv"}, 4},
+		{[]string{"--verbose=5"}, 5},
+		{[]string{"-vv", "--verbose=false"}, 0},
+		{[]string{"--verbose=false", "-v"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			fs := NewFlagSet("test")
+			verbose := fs.Count("verbose", 'v', "verbosity level")
+			fs.Bool("quiet", 'q', false, "quiet")
+
+			err := fs.Parse(append(test.args, "file.txt"))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, *verbose)
+			assert.Equal(t, []string{"file.txt"}, fs.Args())
+		})
+	}
+}
+
+func TestCountStructTag(t *testing.T) {
+	type Config struct {
+		Verbose int `long:"verbose" short:"v" count:"true"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"-vvv", "arg"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, config.Verbose)
+}
+
+func TestStringSliceAppends(t *testing.T) {
+	fs := NewFlagSet("test")
+	tags := fs.StringSlice("tags", 't', []string{"default"}, "tags")
+	labels := fs.StringArray("labels", 'l', nil, "labels")
+
+	err := fs.Parse([]string{"--tags", "a,b", "-t", "c", "--labels", "x", "--labels", "y"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, *tags)
+	// StringArray keeps replace semantics
+	assert.Equal(t, []string{"y"}, *labels)
+
+	// A new Parse starts over instead of appending to the previous result
+	err = fs.Parse([]string{"--tags", "d"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d"}, *tags)
+}
+
+func TestAppendStructTag(t *testing.T) {
+	type Config struct {
+		Tags []string `long:"tags" append:"true" default:"x"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"--tags", "a", "--tags", "b,c"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, config.Tags)
+}
+
+func TestStringArraySep(t *testing.T) {
+	fs := NewFlagSet("test")
+	paths := fs.StringArraySep("path", 'p', ";", nil, "search paths")
+	csv := fs.StringArraySep("csv", 0, "", nil, "comma fallback")
+
+	err := fs.Parse([]string{"--path", `C:\a,b;D:\c`, "--csv", "x,y"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`C:\a,b`, `D:\c`}, *paths)
+	assert.Equal(t, []string{"x", "y"}, *csv)
+
+	// String joins with the same separator for round-tripping
+	assert.Equal(t, `C:\a,b;D:\c`, fs.Lookup("path").Value.String())
+	assert.Equal(t, "value;...", fs.Lookup("path").Value.Type())
+
+	args, err := fs.ArgsFromMap(map[string]any{"path": []any{"e", "f,g"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--path", "e;f,g"}, args)
+}
+
+func TestSepStructTag(t *testing.T) {
+	type Config struct {
+		Dirs []string `long:"dirs" sep:":" default:"/usr/bin:/bin"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/usr/bin", "/bin"}, config.Dirs)
+
+	err = ParseStruct(config, []string{"--dirs", "/opt/a,b:/opt/c"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/opt/a,b", "/opt/c"}, config.Dirs)
+}
+
+func TestNumericSliceFlags(t *testing.T) {
+	fs := NewFlagSet("test")
+	ports := fs.IntSlice("ports", 'p', nil, "ports")
+	weights := fs.Float64Slice("weights", 'w', []float64{1}, "weights")
+
+	assert.Equal(t, []int{}, *ports)
+	assert.Equal(t, []float64{1}, *weights)
+
+	err := fs.Parse([]string{"--ports", "80,443,8080", "-w", "0.5,1.25"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{80, 443, 8080}, *ports)
+	assert.Equal(t, []float64{0.5, 1.25}, *weights)
+	assert.Equal(t, "80,443,8080", fs.Lookup("ports").Value.String())
+
+	err = fs.Parse([]string{"--ports", "80,http,443"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), `"http"`)
+
+	err = fs.Parse([]string{"--weights", "1,x"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), `"x"`)
+}
+
+func TestNumericSlicesFromStruct(t *testing.T) {
+	type Config struct {
+		Ports   []int     `long:"ports" default:"80,443"`
+		Weights []float64 `long:"weights"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"--weights", "0.1,0.9"})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{80, 443}, config.Ports)
+	assert.Equal(t, []float64{0.1, 0.9}, config.Weights)
+}
+
+func TestErrorHandling(t *testing.T) {
+	fs := NewFlagSet("test")
+	assert.Equal(t, ContinueOnError, fs.ErrorHandling())
+	err := fs.Parse([]string{"--unknown"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	fs = NewFlagSetWithErrorHandling("test", PanicOnError)
+	assert.Equal(t, PanicOnError, fs.ErrorHandling())
+	assert.Panics(t, func() {
+		fs.Parse([]string{"--unknown"})
+	})
+
+	fs.SetErrorHandling(ContinueOnError)
+	assert.NotPanics(t, func() {
+		fs.Parse([]string{"--unknown"})
+	})
+}
+
+func TestExitOnError(t *testing.T) {
+	if os.Getenv("MFLAGS_TEST_EXIT") == "1" {
+		fs := NewFlagSetWithErrorHandling("test", ExitOnError)
+		fs.Parse([]string{"--unknown"})
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestExitOnError$")
+	cmd.Env = append(os.Environ(), "MFLAGS_TEST_EXIT=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if assert.ErrorAs(t, err, &exitErr) {
+		assert.Equal(t, 2, exitErr.ExitCode())
+	}
+	assert.Contains(t, stderr.String(), "unknown flag: --unknown")
+}
+
+func TestSetOutput(t *testing.T) {
+	t.Run("help goes to configured writer", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.String("name", 'n', "", "the name")
+
+		var buf bytes.Buffer
+		fs.SetOutput(&buf)
+		fs.ShowHelp()
+
+		assert.Contains(t, buf.String(), "Usage: test [options]")
+		assert.Contains(t, buf.String(), "--name")
+	})
+
+	t.Run("completions go to configured writer", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.Bool("verbose", 'v', false, "verbose output")
+
+		var buf bytes.Buffer
+		fs.SetOutput(&buf)
+		fs.PrintBashCompletions([]string{"--v"})
+		assert.Equal(t, "--verbose\n", buf.String())
+
+		buf.Reset()
+		fs.PrintZshCompletions(nil)
+		assert.Equal(t, "--verbose:verbose output\n-v:verbose output\n", buf.String())
+	})
+
+	t.Run("completion script goes to configured writer", func(t *testing.T) {
+		fs := NewFlagSet("test")
+
+		var buf bytes.Buffer
+		fs.SetOutput(&buf)
+		assert.True(t, fs.HandleCompletion([]string{"--generate-bash-completion"}))
+		assert.Equal(t, fs.GenerateBashCompletion("test"), buf.String())
+	})
+}
+
+func TestValidator(t *testing.T) {
+	validatePort := func(s string) error {
+		port, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("port %d out of range 1-65535", port)
+		}
+		return nil
+	}
+
+	t.Run("SetValidator", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		port := fs.Int("port", 'p', 80, "port")
+		fs.SetValidator("port", validatePort)
+
+		err := fs.Parse([]string{"--port", "8080"})
+		assert.NoError(t, err)
+		assert.Equal(t, 8080, *port)
+
+		err = fs.Parse([]string{"--port", "70000"})
+		assert.ErrorIs(t, err, ErrInvalidValue)
+		assert.Contains(t, err.Error(), "--port: port 70000 out of range 1-65535")
+
+		err = fs.Parse([]string{"-p", "0"})
+		assert.ErrorIs(t, err, ErrInvalidValue)
+		assert.Contains(t, err.Error(), "-p: port 0 out of range")
+	})
+
+	t.Run("VarValidated", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		port := 80
+		fs.VarValidated((*intValue)(&port), "port", 0, "port", validatePort)
+
+		err := fs.Parse([]string{"--port=443"})
+		assert.NoError(t, err)
+		assert.Equal(t, 443, port)
+
+		err = fs.Parse([]string{"--port=-1"})
+		assert.ErrorIs(t, err, ErrInvalidValue)
+	})
+
+	t.Run("env values are validated", func(t *testing.T) {
+		t.Setenv("MFLAGS_TEST_PORT", "99999")
+
+		fs := NewFlagSet("test")
+		fs.Int("port", 0, 80, "port")
+		fs.SetEnv("port", "MFLAGS_TEST_PORT")
+		fs.SetValidator("port", validatePort)
+
+		err := fs.Parse([]string{})
+		assert.ErrorIs(t, err, ErrInvalidValue)
+		assert.Contains(t, err.Error(), "--port (from $MFLAGS_TEST_PORT): port 99999 out of range")
+	})
+}
+
+func TestChoices(t *testing.T) {
+	t.Run("SetChoices", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		level := fs.String("log-level", 0, "info", "log level")
+		fs.SetChoices("log-level", []string{"debug", "info", "warn", "error"})
+
+		err := fs.Parse([]string{"--log-level", "warn"})
+		assert.NoError(t, err)
+		assert.Equal(t, "warn", *level)
+
+		err = fs.Parse([]string{"--log-level", "trace"})
+		assert.ErrorIs(t, err, ErrInvalidValue)
+		assert.Contains(t, err.Error(), "valid choices: debug, info, warn, error")
+	})
+
+	t.Run("struct tag", func(t *testing.T) {
+		type Config struct {
+			Format string `long:"format" choices:"json, text" default:"text"`
+		}
+
+		config := &Config{}
+		err := ParseStruct(config, []string{"--format=json"})
+		assert.NoError(t, err)
+		assert.Equal(t, "json", config.Format)
+
+		err = ParseStruct(&Config{}, []string{"--format=xml"})
+		assert.ErrorIs(t, err, ErrInvalidValue)
+		assert.Contains(t, err.Error(), "valid choices: json, text")
+	})
+}
+
+func TestParseError(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.Int("count", 'c', 0, "count")
+	fs.String("name", 'n', "", "name")
+
+	tests := []struct {
+		args     []string
+		flag     string
+		kind     ParseErrorKind
+		sentinel error
+		message  string
+	}{
+		{[]string{"--bogus"}, "--bogus", ParseErrorUnknown, ErrUnknownFlag, "unknown flag: --bogus"},
+		{[]string{"-x"}, "-x", ParseErrorUnknown, ErrUnknownFlag, "unknown flag: -x"},
+		{[]string{"--name"}, "--name", ParseErrorMissing, ErrMissingValue, "flag needs an argument: --name"},
+		{[]string{"-n"}, "-n", ParseErrorMissing, ErrMissingValue, "flag needs an argument: -n"},
+		{[]string{"--count", "abc"}, "--count", ParseErrorInvalid, ErrInvalidValue, "invalid flag value: --count: "},
+		{[]string{"-cabc"}, "-c", ParseErrorInvalid, ErrInvalidValue, "invalid flag value: -c: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			err := fs.Parse(tt.args)
+			assert.ErrorIs(t, err, tt.sentinel)
+			assert.Contains(t, err.Error(), tt.message)
+
+			var parseErr *ParseError
+			if assert.True(t, errors.As(err, &parseErr)) {
+				assert.Equal(t, tt.flag, parseErr.Flag)
+				assert.Equal(t, tt.kind, parseErr.Kind)
+			}
+		})
+	}
+
+	t.Run("underlying error", func(t *testing.T) {
+		err := fs.Parse([]string{"--count", "abc"})
+		var numErr *strconv.NumError
+		assert.True(t, errors.As(err, &numErr))
+	})
+}
+
+func TestCollectErrors(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.Int("count", 'c', 0, "count")
+	fs.String("name", 'n', "", "name")
+	fs.String("token", 0, "", "token")
+	fs.Required("token")
+	verbose := fs.Bool("verbose", 'v', false, "verbose")
+	fs.SetCollectErrors(true)
+
+	err := fs.Parse([]string{"--bogus", "--count", "abc", "-x", "-v", "--name"})
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.ErrorIs(t, err, ErrMissingValue)
+	assert.ErrorIs(t, err, ErrRequiredFlag)
+	assert.True(t, *verbose, "valid flags after an error are still parsed")
+
+	errs := fs.Errors()
+	assert.Len(t, errs, 5)
+	assert.EqualError(t, errs[0], "unknown flag: --bogus")
+	assert.ErrorIs(t, errs[1], ErrInvalidValue)
+	assert.EqualError(t, errs[2], "unknown flag: -x")
+	assert.EqualError(t, errs[3], "flag needs an argument: --name")
+	assert.EqualError(t, errs[4], "required flag not provided: --token")
+
+	// A clean parse resets the collected errors
+	err = fs.Parse([]string{"--token", "secret"})
+	assert.NoError(t, err)
+	assert.Empty(t, fs.Errors())
+
+	// Help still stops immediately
+	fs.SetOutput(io.Discard)
+	err = fs.Parse([]string{"--bogus", "--help"})
+	assert.ErrorIs(t, err, ErrHelp)
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	fs := NewFlagSet("test")
+	verbose := fs.Bool("verbose", 'v', false, "verbose")
+	fs.SetCaseInsensitive(true)
+	output := fs.String("Output", 'o', "", "output")
+	upper := fs.Bool("upper", 'V', false, "upper")
+
+	err := fs.Parse([]string{"--Verbose", "--OUTPUT=Mixed.TXT"})
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, "Mixed.TXT", *output, "values keep their case")
+	assert.Equal(t, "output", fs.Lookup("OUTPUT").Name)
+
+	// Short flags stay case-sensitive
+	err = fs.Parse([]string{"-V"})
+	assert.NoError(t, err)
+	assert.True(t, *upper)
+
+	// Case-sensitive by default
+	fs2 := NewFlagSet("test")
+	fs2.Bool("verbose", 0, false, "verbose")
+	err = fs2.Parse([]string{"--Verbose"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+}
+
+func TestAllowAbbrev(t *testing.T) {
+	newFlags := func() (*FlagSet, *bool, *bool, *string) {
+		fs := NewFlagSet("test")
+		verbose := fs.Bool("verbose", 0, false, "verbose")
+		version := fs.Bool("version", 0, false, "version")
+		output := fs.String("output", 'o', "", "output")
+		fs.SetAllowAbbrev(true)
+		return fs, verbose, version, output
+	}
+
+	t.Run("unique prefix", func(t *testing.T) {
+		fs, verbose, _, output := newFlags()
+		err := fs.Parse([]string{"--verb", "--out=file.txt"})
+		assert.NoError(t, err)
+		assert.True(t, *verbose)
+		assert.Equal(t, "file.txt", *output)
+	})
+
+	t.Run("ambiguous prefix", func(t *testing.T) {
+		fs, _, _, _ := newFlags()
+		err := fs.Parse([]string{"--ver"})
+		assert.ErrorIs(t, err, ErrAmbiguousFlag)
+		assert.EqualError(t, err, "ambiguous flag: --ver: matches --verbose, --version")
+
+		var parseErr *ParseError
+		assert.True(t, errors.As(err, &parseErr))
+		assert.Equal(t, ParseErrorAmbiguous, parseErr.Kind)
+	})
+
+	t.Run("exact match wins", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.SetAllowAbbrev(true)
+		all := fs.Bool("all", 0, false, "all")
+		fs.Bool("all-namespaces", 0, false, "all namespaces")
+
+		err := fs.Parse([]string{"--all"})
+		assert.NoError(t, err)
+		assert.True(t, *all)
+	})
+
+	t.Run("unknown flags are still accumulated", func(t *testing.T) {
+		fs, _, _, _ := newFlags()
+		fs.AllowUnknownFlags(true)
+		err := fs.Parse([]string{"--verb", "--color", "auto"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"--color", "auto"}, fs.UnknownFlags())
+	})
+
+	t.Run("ambiguous prefix is accumulated with unknown flags", func(t *testing.T) {
+		fs, verbose, version, output := newFlags()
+		fs.AllowUnknownFlags(true)
+		err := fs.Parse([]string{"--out=x", "--ver", "now"})
+		assert.NoError(t, err)
+		assert.Equal(t, "x", *output)
+		assert.False(t, *verbose)
+		assert.False(t, *version)
+		assert.Equal(t, []string{"--ver", "now"}, fs.UnknownFlags())
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.Bool("verbose", 0, false, "verbose")
+		err := fs.Parse([]string{"--verb"})
+		assert.ErrorIs(t, err, ErrUnknownFlag)
+	})
+}
+
+func TestShortFlagEquals(t *testing.T) {
+	fs := NewFlagSet("test")
+	verbose := fs.Bool("verbose", 'v', false, "verbose")
+	output := fs.String("output", 'o', "", "output")
+
+	err := fs.Parse([]string{"-o=foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", *output)
+
+	err = fs.Parse([]string{"-vo=bar"})
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, "bar", *output)
+
+	err = fs.Parse([]string{"-o==x"})
+	assert.NoError(t, err)
+	assert.Equal(t, "=x", *output)
+
+	err = fs.Parse([]string{"-o="})
+	assert.NoError(t, err)
+	assert.Equal(t, "", *output)
+
+	// Attached values without = are unchanged
+	err = fs.Parse([]string{"-obaz"})
+	assert.NoError(t, err)
+	assert.Equal(t, "baz", *output)
+}
+
+func TestSetInterspersed(t *testing.T) {
+	t.Run("default is interspersed", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		verbose := fs.Bool("verbose", 'v', false, "verbose")
+		err := fs.Parse([]string{"pod", "-v", "ls"})
+		assert.NoError(t, err)
+		assert.True(t, *verbose)
+		assert.Equal(t, []string{"pod", "ls"}, fs.Args())
+	})
+
+	t.Run("stops at first non-flag", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.SetInterspersed(false)
+		verbose := fs.Bool("verbose", 'v', false, "verbose")
+		container := fs.String("container", 'c', "", "container")
+
+		err := fs.Parse([]string{"-c", "app", "pod", "-v", "ls", "--all", "--", "x"})
+		assert.NoError(t, err)
+		assert.Equal(t, "app", *container)
+		assert.False(t, *verbose)
+		assert.Equal(t, []string{"pod", "-v", "ls", "--all", "--", "x"}, fs.Args())
+	})
+
+	t.Run("positional and rest fields", func(t *testing.T) {
+		type ExecConfig struct {
+			TTY     bool     `long:"tty" short:"t"`
+			Pod     string   `position:"0"`
+			Command []string `rest:"true"`
+		}
+
+		config := &ExecConfig{}
+		fs := NewFlagSet("exec")
+		fs.SetInterspersed(false)
+		err := fs.FromStruct(config)
+		assert.NoError(t, err)
+
+		err = fs.Parse([]string{"-t", "mypod", "sh", "-c", "echo hi"})
+		assert.NoError(t, err)
+		assert.True(t, config.TTY)
+		assert.Equal(t, "mypod", config.Pod)
+		assert.Equal(t, []string{"mypod", "sh", "-c", "echo hi"}, config.Command)
+	})
+
+	t.Run("help after first non-flag is positional", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.SetInterspersed(false)
+		fs.SetOutput(io.Discard)
+		fs.String("container", 'c', "", "container")
+
+		err := fs.Parse([]string{"pod", "ls", "-h"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"pod", "ls", "-h"}, fs.Args())
+
+		err = fs.Parse([]string{"-c", "app", "pod", "--help"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"pod", "--help"}, fs.Args())
+
+		err = fs.Parse([]string{"-c", "app", "-h", "pod"})
+		assert.ErrorIs(t, err, ErrHelp)
+	})
+}
+
+func TestFlagDependencies(t *testing.T) {
+	t.Run("MarkRequires", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.String("cert", 0, "", "certificate")
+		fs.String("key", 0, "", "private key")
+		fs.String("ca", 0, "", "CA bundle")
+		fs.MarkRequires("cert", "key", "ca")
+
+		err := fs.Parse([]string{})
+		assert.NoError(t, err, "unset flag has no requirements")
+
+		err = fs.Parse([]string{"--cert", "c.pem"})
+		assert.ErrorIs(t, err, ErrRequiredFlag)
+		assert.EqualError(t, err, "required flag not provided: --key, --ca (required by --cert)")
+
+		err = fs.Parse([]string{"--cert", "c.pem", "--key", "k.pem", "--ca", "ca.pem"})
+		assert.NoError(t, err)
+
+		// Only one direction is required
+		err = fs.Parse([]string{"--key", "k.pem"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("MarkRequiredTogether", func(t *testing.T) {
+		fs := NewFlagSet("test")
+		fs.String("user", 'u', "", "user")
+		fs.String("password", 'p', "", "password")
+		fs.MarkRequiredTogether("user", "password")
+
+		err := fs.Parse([]string{})
+		assert.NoError(t, err)
+
+		err = fs.Parse([]string{"-p", "secret"})
+		assert.ErrorIs(t, err, ErrRequiredFlag)
+		assert.EqualError(t, err, "required flag not provided: --user (required together with --password)")
+
+		err = fs.Parse([]string{"-u", "admin", "-p", "secret"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("with required and env", func(t *testing.T) {
+		t.Setenv("MFLAGS_TEST_KEY", "k.pem")
+
+		fs := NewFlagSet("test")
+		fs.String("cert", 0, "", "certificate")
+		fs.String("key", 0, "", "private key")
+		fs.Required("cert")
+		fs.SetEnv("key", "MFLAGS_TEST_KEY")
+		fs.MarkRequires("cert", "key")
+
+		err := fs.Parse([]string{})
+		assert.ErrorIs(t, err, ErrRequiredFlag)
+		assert.EqualError(t, err, "required flag not provided: --cert")
+
+		err = fs.Parse([]string{"--cert", "c.pem"})
+		assert.NoError(t, err, "dependency satisfied from the environment")
+	})
+}
+
+func TestByteSizeFlag(t *testing.T) {
+	fs := NewFlagSet("test")
+	size := fs.ByteSize("size", 's', 1<<20, "size")
+	assert.Equal(t, int64(1<<20), *size)
+	assert.Equal(t, "1MiB", fs.Lookup("size").DefValue)
+
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"512", 512},
+		{"512B", 512},
+		{"10MB", 10_000_000},
+		{"10mb", 10_000_000},
+		{"2GiB", 2 << 30},
+		{"1.5KiB", 1536},
+		{"4 KB", 4000},
+	}
+	for _, tt := range tests {
+		err := fs.Parse([]string{"--size", tt.input})
+		assert.NoError(t, err, tt.input)
+		assert.Equal(t, tt.want, *size, tt.input)
+	}
+
+	for _, bad := range []string{"10M", "5k", "1XB", "MB", "-1MB", "99999999999TiB"} {
+		err := fs.Parse([]string{"--size", bad})
+		assert.ErrorIs(t, err, ErrInvalidValue, bad)
+	}
+
+	formats := map[int64]string{
+		0:             "0",
+		1023:          "1023B",
+		1024:          "1KiB",
+		1000:          "1KB",
+		10_000_000:    "10MB",
+		2 << 30:       "2GiB",
+		1536:          "1536B",
+		3 * (1 << 40): "3TiB",
+	}
+	for n, want := range formats {
+		v := byteSizeValue(n)
+		assert.Equal(t, want, v.String())
+	}
+}
+
+func TestByteSizeFromStruct(t *testing.T) {
+	type Config struct {
+		MaxUpload int64 `long:"max-upload" bytesize:"true" default:"10MB"`
+		Limit     int64 `long:"limit"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"--max-upload", "2GiB", "--limit", "100"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2<<30), config.MaxUpload)
+	assert.Equal(t, int64(100), config.Limit)
+
+	config = &Config{}
+	err = ParseStruct(config, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10_000_000), config.MaxUpload)
+}
+
+func TestIPFlags(t *testing.T) {
+	fs := NewFlagSet("test")
+	bind := fs.IP("bind", 'b', net.IPv4(127, 0, 0, 1), "bind address")
+	_, defNet, _ := net.ParseCIDR("10.0.0.0/8")
+	allow := fs.IPNet("allow", 0, *defNet, "allowed network")
+
+	assert.Equal(t, "127.0.0.1", fs.Lookup("bind").DefValue)
+	assert.Equal(t, "10.0.0.0/8", fs.Lookup("allow").DefValue)
+
+	err := fs.Parse([]string{"--bind", "::1", "--allow=192.168.1.7/24"})
+	assert.NoError(t, err)
+	assert.True(t, bind.Equal(net.IPv6loopback))
+	assert.Equal(t, "192.168.1.0/24", allow.String())
+
+	err = fs.Parse([]string{"--bind", "300.1.1.1"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), `"300.1.1.1"`)
+
+	err = fs.Parse([]string{"--allow", "10.0.0.0"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), `"10.0.0.0"`)
+}
+
+func TestIPFlagsFromStruct(t *testing.T) {
+	type Config struct {
+		Bind    net.IP     `long:"bind" default:"0.0.0.0"`
+		Allow   *net.IPNet `long:"allow"`
+		Private *net.IPNet `long:"private" default:"172.16.0.0/12"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"--allow", "2001:db8::/32"})
+	assert.NoError(t, err)
+	assert.Equal(t, "0.0.0.0", config.Bind.String())
+	assert.Equal(t, "2001:db8::/32", config.Allow.String())
+	assert.Equal(t, "172.16.0.0/12", config.Private.String())
+}
+
+func TestURLFlag(t *testing.T) {
+	def, _ := url.Parse("https://example.com/api")
+	fs := NewFlagSet("test")
+	endpoint := fs.URL("endpoint", 'e', def, "endpoint")
+	proxy := fs.URL("proxy", 0, nil, "proxy")
+
+	assert.Equal(t, "https://example.com/api", fs.Lookup("endpoint").DefValue)
+	assert.Equal(t, "", fs.Lookup("proxy").DefValue)
+
+	err := fs.Parse([]string{"-e", "http://localhost:8080/v1?x=1", "--proxy", "relative/path"})
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:8080", endpoint.Host)
+	assert.Equal(t, "http://localhost:8080/v1?x=1", fs.Lookup("endpoint").Value.String())
+	assert.Equal(t, "relative/path", proxy.Path)
+
+	err = fs.Parse([]string{"--endpoint", "http://[::1"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	fs.RequireAbsoluteURL("endpoint")
+	for _, bad := range []string{"not a url", "example.com/path", "/just/a/path"} {
+		err = fs.Parse([]string{"--endpoint", bad})
+		assert.ErrorIs(t, err, ErrInvalidValue, bad)
+		assert.Contains(t, err.Error(), "must be absolute", bad)
+	}
+}
+
+func TestURLFlagFromStruct(t *testing.T) {
+	type Config struct {
+		Server *url.URL `long:"server" absolute:"true" default:"https://api.example.com"`
+		Link   *url.URL `long:"link"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"--link", "docs/index.html"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://api.example.com", config.Server.String())
+	assert.Equal(t, "docs/index.html", config.Link.String())
+
+	err = ParseStruct(&Config{}, []string{"--server", "api.example.com"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+}
+
+type testColor int
+
+const (
+	testColorRed testColor = iota
+	testColorGreen
+	testColorBlue
+)
+
+var testColorNames = []string{"red", "green", "blue"}
+
+type testColorValue struct {
+	c *testColor
+}
+
+func (v *testColorValue) Set(s string) error {
+	for i, name := range testColorNames {
+		if s == name {
+			*v.c = testColor(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown color %q", s)
+}
+
+func (v *testColorValue) String() string {
+	return testColorNames[*v.c]
+}
+
+func (v *testColorValue) IsBool() bool {
+	return false
+}
+
+func (v *testColorValue) Type() string {
+	return "color"
+}
+
+func TestRegisterType(t *testing.T) {
+	RegisterType(testColor(0), func(v reflect.Value) Value {
+		return &testColorValue{c: v.Addr().Interface().(*testColor)}
+	})
+
+	type Config struct {
+		Color      testColor `long:"color" default:"green"`
+		Background testColor `long:"background"`
+		Fill       testColor `position:"0"`
+		Count      int       `long:"count"`
+	}
+
+	config := &Config{}
+	fs := NewFlagSet("test")
+	err := fs.FromStruct(config)
+	assert.NoError(t, err)
+	assert.Equal(t, testColorGreen, config.Color)
+	assert.Equal(t, "green", fs.Lookup("color").DefValue)
+	assert.Equal(t, "color", fs.Lookup("color").Value.Type())
+
+	err = fs.Parse([]string{"--color", "blue", "--count", "3", "red"})
+	assert.NoError(t, err)
+	assert.Equal(t, testColorBlue, config.Color)
+	assert.Equal(t, testColorRed, config.Background)
+	assert.Equal(t, testColorRed, config.Fill)
+	assert.Equal(t, 3, config.Count, "built-in kinds are unaffected")
+
+	err = fs.Parse([]string{"--background", "purple"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), `unknown color "purple"`)
+
+	err = fs.Parse([]string{"green"})
+	assert.NoError(t, err)
+	assert.Equal(t, testColorGreen, config.Fill)
+}
+
+func TestChangedAndVisit(t *testing.T) {
+	t.Setenv("MFLAGS_TEST_REGION", "eu")
+
+	fs := NewFlagSet("test")
+	fs.Int("port", 'p', 8080, "port")
+	fs.String("host", 0, "localhost", "host")
+	fs.Bool("verbose", 'v', false, "verbose")
+	fs.String("region", 0, "us", "region")
+	fs.SetEnv("region", "MFLAGS_TEST_REGION")
+
+	visited := func() []string {
+		var names []string
+		fs.Visit(func(f *Flag) {
+			names = append(names, f.Name)
+		})
+		return names
+	}
+
+	// Passing the default value still counts as set
+	err := fs.Parse([]string{"--port", "8080", "-v"})
+	assert.NoError(t, err)
+	assert.True(t, fs.Changed("port"))
+	assert.True(t, fs.Changed("verbose"))
+	assert.False(t, fs.Changed("host"))
+	assert.True(t, fs.Changed("region"), "set from the environment")
+	assert.False(t, fs.Changed("missing"))
+	assert.Equal(t, []string{"port", "region", "verbose"}, visited())
+
+	// State is reset on each Parse
+	err = fs.Parse([]string{"--host", "example.com"})
+	assert.NoError(t, err)
+	assert.False(t, fs.Changed("port"))
+	assert.Equal(t, []string{"host", "region"}, visited())
+}
+
+func TestReset(t *testing.T) {
+	fs := NewFlagSet("test")
+	name := fs.String("name", 'n', "default", "name")
+	verbose := fs.Count("verbose", 'v', "verbosity")
+	tags := fs.StringArray("tags", 't', []string{"a"}, "tags")
+	ports := fs.IntSlice("ports", 0, nil, "ports")
+	var target string
+	fs.StringPosVar(&target, "target", 0, "", "target")
+	var rest []string
+	fs.Rest(&rest, "rest")
+
+	err := fs.Parse([]string{"--name", "x", "-vv", "--tags", "b,c", "--ports", "80", "host", "extra"})
+	assert.NoError(t, err)
+	assert.Equal(t, "x", *name)
+	assert.Equal(t, 2, *verbose)
+	assert.Equal(t, "host", target)
+	assert.Equal(t, []string{"host", "extra"}, rest)
+
+	assert.NoError(t, fs.Reset())
+	assert.False(t, fs.Parsed())
+	assert.Equal(t, "default", *name)
+	assert.Equal(t, 0, *verbose)
+	assert.Equal(t, []string{"a"}, *tags)
+	assert.Empty(t, *ports)
+	assert.Equal(t, "", target)
+	assert.Empty(t, rest)
+	assert.Empty(t, fs.Args())
+	assert.False(t, fs.Changed("name"))
+	assert.NotNil(t, fs.Lookup("name"))
+
+	err = fs.Parse([]string{"-v"})
+	assert.NoError(t, err)
+	assert.Equal(t, "default", *name)
+	assert.Equal(t, 1, *verbose)
+	assert.Equal(t, []string{"a"}, *tags)
+}
+
+func TestResetInvalidDefault(t *testing.T) {
+	fs := NewFlagSet("test")
+	name := fs.String("name", 'n', "default", "name")
+	var color testColor
+	fs.Var(&testColorValue{c: &color}, "color", 0, "color")
+	fs.Lookup("color").DefValue = "purple"
+
+	err := fs.Parse([]string{"--name", "x", "--color", "blue"})
+	assert.NoError(t, err)
+
+	// The failing default is reported, and the other flags are still reset
+	err = fs.Reset()
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Contains(t, err.Error(), "--color")
+	assert.Contains(t, err.Error(), "purple")
+	assert.Equal(t, "default", *name)
+	assert.False(t, fs.Changed("color"))
+}
+
+func TestJSONSchema(t *testing.T) {
+	type copyConfig struct {
+		Source  string   `position:"0" usage:"File to copy"`
+		Force   bool     `long:"force" short:"f" usage:"Overwrite existing files"`
+		Mode    string   `long:"mode" default:"0644" required:"true" usage:"File mode"`
+		Retries int      `long:"retries" usage:"Retry count"`
+		Files   []string `rest:"true"`
+	}
+
+	fs := NewFlagSet("copy")
+	err := fs.FromStruct(&copyConfig{})
+	assert.NoError(t, err)
+
+	schema := fs.JSONSchema()
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, Property{Type: "boolean", Description: "Overwrite existing files"}, schema.Properties["force"])
+	assert.Equal(t, Property{Type: "string", Description: "File mode", Default: "0644"}, schema.Properties["mode"])
+	assert.Equal(t, "integer", schema.Properties["retries"].Type)
+	assert.Equal(t, Property{Type: "string", Description: "File to copy"}, schema.Properties["source"])
+	assert.Equal(t, "array", schema.Properties["arguments"].Type)
+	assert.Equal(t, []string{"mode", "source"}, schema.Required)
+
+	// A nil FlagSet has an empty schema
+	var none *FlagSet
+	assert.Empty(t, none.JSONSchema().Properties)
+}
+
+func TestParseWithConfig(t *testing.T) {
+	type serverConfig struct {
+		Host    string   `long:"host" default:"localhost"`
+		Port    int      `long:"port" default:"8080"`
+		Debug   bool     `long:"debug"`
+		Tags    []string `long:"tags"`
+		Workers int      `long:"workers" default:"4"`
+	}
+
+	dir := t.TempDir()
+	kvPath := dir + "/server.conf"
+	err := os.WriteFile(kvPath, []byte("# server settings\nhost = example.com\nport=9000\n\ndebug=true\ntags=\"a,b\"\n"), 0o644)
+	assert.NoError(t, err)
+
+	config := &serverConfig{}
+	fs := NewFlagSet("server")
+	assert.NoError(t, fs.FromStruct(config))
+
+	// Command-line values win over the file, which wins over struct defaults
+	err = fs.ParseWithConfig(kvPath, []string{"--port", "7000"})
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", config.Host)
+	assert.Equal(t, 7000, config.Port)
+	assert.True(t, config.Debug)
+	assert.Equal(t, []string{"a", "b"}, config.Tags)
+	assert.Equal(t, 4, config.Workers)
+	assert.True(t, fs.Changed("host"))
+	assert.False(t, fs.Changed("workers"))
+
+	// JSON files work the same way
+	jsonPath := dir + "/server.json"
+	err = os.WriteFile(jsonPath, []byte(`{"host": "json.example.com", "workers": 8, "tags": ["x", "y"]}`), 0o644)
+	assert.NoError(t, err)
+
+	config = &serverConfig{}
+	fs = NewFlagSet("server")
+	assert.NoError(t, fs.FromStruct(config))
+	err = fs.ParseWithConfig(jsonPath, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "json.example.com", config.Host)
+	assert.Equal(t, 8080, config.Port)
+	assert.Equal(t, 8, config.Workers)
+	assert.Equal(t, []string{"x", "y"}, config.Tags)
+
+	// Unknown keys are an error unless allowed
+	unknownPath := dir + "/unknown.conf"
+	err = os.WriteFile(unknownPath, []byte("host=a\ncolour=blue\n"), 0o644)
+	assert.NoError(t, err)
+
+	fs = NewFlagSet("server")
+	assert.NoError(t, fs.FromStruct(&serverConfig{}))
+	err = fs.ParseWithConfig(unknownPath, nil)
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+	assert.Contains(t, err.Error(), "colour")
+
+	fs.SetAllowUnknownConfigKeys(true)
+	err = fs.ParseWithConfig(unknownPath, nil)
+	assert.NoError(t, err)
+
+	// Invalid values and malformed files are reported
+	badPath := dir + "/bad.conf"
+	err = os.WriteFile(badPath, []byte("port=lots\n"), 0o644)
+	assert.NoError(t, err)
+	err = fs.ParseWithConfig(badPath, nil)
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	err = os.WriteFile(badPath, []byte("port\n"), 0o644)
+	assert.NoError(t, err)
+	err = fs.ParseWithConfig(badPath, nil)
+	assert.ErrorContains(t, err, "line 1")
+
+	err = fs.ParseWithConfig(dir+"/missing.conf", nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestParseWithConfigSatisfiesRequired(t *testing.T) {
+	path := t.TempDir() + "/token.conf"
+	err := os.WriteFile(path, []byte("token=secret\n"), 0o644)
+	assert.NoError(t, err)
+
+	fs := NewFlagSet("test")
+	token := fs.String("token", 0, "", "API token")
+	fs.Required("token")
+
+	err = fs.ParseWithConfig(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", *token)
+}
+
+func TestArgsFileExpansion(t *testing.T) {
+	dir := t.TempDir()
+	argsPath := dir + "/args.txt"
+	err := os.WriteFile(argsPath, []byte("--verbose\n--name  build\n  -c 3\n"), 0o644)
+	assert.NoError(t, err)
+
+	newFlagSet := func() (*FlagSet, *bool, *string, *int) {
+		fs := NewFlagSet("test")
+		verbose := fs.Bool("verbose", 'v', false, "Verbose output")
+		name := fs.String("name", 'n', "", "Name")
+		count := fs.Int("count", 'c', 1, "Count")
+		return fs, verbose, name, count
+	}
+
+	// Disabled by default, so @-prefixed arguments are left alone
+	fs, verbose, _, _ := newFlagSet()
+	err = fs.Parse([]string{"@" + argsPath})
+	assert.NoError(t, err)
+	assert.False(t, *verbose)
+	assert.Equal(t, []string{"@" + argsPath}, fs.Args())
+
+	fs, verbose, name, count := newFlagSet()
+	fs.SetArgsFileExpansion(true)
+	err = fs.Parse([]string{"@" + argsPath, "file1", "--", "@" + argsPath})
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, "build", *name)
+	assert.Equal(t, 3, *count)
+	assert.Equal(t, []string{"file1", "@" + argsPath}, fs.Args())
+
+	// A lone @ is an ordinary argument
+	fs, _, _, _ = newFlagSet()
+	fs.SetArgsFileExpansion(true)
+	err = fs.Parse([]string{"@"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@"}, fs.Args())
+
+	// Missing files are reported
+	fs, _, _, _ = newFlagSet()
+	fs.SetArgsFileExpansion(true)
+	err = fs.Parse([]string{"@" + dir + "/missing.txt"})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Contains(t, err.Error(), "missing.txt")
+
+	// Nested args files are rejected
+	nestedPath := dir + "/nested.txt"
+	err = os.WriteFile(nestedPath, []byte("--verbose @"+argsPath+"\n"), 0o644)
+	assert.NoError(t, err)
+
+	fs, _, _, _ = newFlagSet()
+	fs.SetArgsFileExpansion(true)
+	err = fs.Parse([]string{"@" + nestedPath})
+	assert.ErrorContains(t, err, "nested args file")
+}
+
+func TestParseResult(t *testing.T) {
+	type deployConfig struct {
+		Verbose bool     `long:"verbose" short:"v"`
+		Region  string   `long:"region" env:"TEST_PARSE_RESULT_REGION"`
+		Count   int      `long:"count"`
+		Target  string   `position:"0" required:"false"`
+		Rest    []string `rest:"true"`
+	}
+
+	t.Setenv("TEST_PARSE_RESULT_REGION", "eu-west")
+
+	config := &deployConfig{}
+	fs := NewFlagSet("deploy")
+	assert.NoError(t, fs.FromStruct(config))
+
+	result := fs.ParseResult()
+	assert.Empty(t, result.SetFlags)
+	assert.Equal(t, -1, result.DashIndex)
+
+	err := fs.Parse([]string{"-v", "prod", "--", "--extra", "arg"})
+	assert.NoError(t, err)
+
+	result = fs.ParseResult()
+	assert.Equal(t, []string{"--verbose", "--region"}, result.SetFlags)
+	assert.Equal(t, map[int]string{0: "prod"}, result.Positional)
+	assert.Equal(t, []string{"prod", "--extra", "arg"}, result.Rest)
+	assert.Empty(t, result.Unknown)
+	assert.Equal(t, 2, result.DashIndex)
+
+	// Without a terminator, DashIndex is -1
+	fs.AllowUnknownFlags(true)
+	err = fs.Parse([]string{"--count", "2", "--force"})
+	assert.NoError(t, err)
+
+	result = fs.ParseResult()
+	assert.Equal(t, []string{"--region", "--count"}, result.SetFlags)
+	assert.Empty(t, result.Positional)
+	assert.Equal(t, []string{"--force"}, result.Unknown)
+	assert.Equal(t, -1, result.DashIndex)
+}
+
+func TestFromStructShortOnlyFlag(t *testing.T) {
+	type archiveConfig struct {
+		Extract bool   `long:"-" short:"x" usage:"Extract files"`
+		File    string `long:"-" short:"f" env:"TEST_ARCHIVE_FILE" required:"true" usage:"Archive file"`
+		Verbose bool   `short:"v"`
+	}
+
+	config := &archiveConfig{}
+	fs := NewFlagSet("archive")
+	assert.NoError(t, fs.FromStruct(config))
+
+	assert.Nil(t, fs.Lookup("extract"))
+	assert.Nil(t, fs.Lookup("-"))
+	assert.NotNil(t, fs.Lookup("verbose"))
+	assert.Equal(t, []string{"--verbose"}, fs.GetLongFlags())
+	assert.Equal(t, []string{"-f", "-v", "-x"}, fs.GetShortFlags())
+
+	err := fs.Parse([]string{"-x", "-f", "backup.tar"})
+	assert.NoError(t, err)
+	assert.True(t, config.Extract)
+	assert.Equal(t, "backup.tar", config.File)
+
+	err = fs.Parse([]string{"--extract", "-f", "backup.tar"})
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	// Tags still apply to short-only flags
+	err = fs.Parse([]string{"-x"})
+	assert.ErrorIs(t, err, ErrRequiredFlag)
+
+	t.Setenv("TEST_ARCHIVE_FILE", "env.tar")
+	config = &archiveConfig{}
+	fs = NewFlagSet("archive")
+	assert.NoError(t, fs.FromStruct(config))
+	err = fs.Parse(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "env.tar", config.File)
+
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	fs.ShowHelp()
+	assert.Contains(t, buf.String(), "  -x")
+	assert.Contains(t, buf.String(), "  -f <string>")
+	assert.NotContains(t, buf.String(), "--extract")
+	assert.NotContains(t, buf.String(), "---")
+
+	// Short-only flags are reached by their short name
+	assert.NoError(t, fs.Parse([]string{"-x"}))
+	if assert.NotNil(t, fs.Lookup("x")) {
+		assert.Equal(t, 'x', fs.Lookup("x").Short)
+	}
+	assert.True(t, fs.Changed("x"))
+	assert.Equal(t, SourceFlag, fs.Source("x"))
+	assert.Equal(t, SourceEnv, fs.Source("f"))
+	assert.False(t, fs.Changed("v"))
+}
+
+func TestShortOnlyFlagAccessors(t *testing.T) {
+	fs := NewFlagSet("archive")
+	mode := fs.String("", 'm', "fast", "mode")
+	fs.Bool("", 'q', false, "quiet")
+	fs.SetChoices("m", []string{"fast", "slow"})
+	fs.SetValidator("m", func(v string) error {
+		if v == "slow" {
+			return errors.New("too slow")
+		}
+		return nil
+	})
+	fs.SetEnv("q", "TEST_ARCHIVE_QUIET")
+	fs.Required("m")
+
+	err := fs.Parse(nil)
+	assert.ErrorIs(t, err, ErrRequiredFlag)
+
+	err = fs.Parse([]string{"-m", "other"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	err = fs.Parse([]string{"-m", "slow"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	t.Setenv("TEST_ARCHIVE_QUIET", "true")
+	err = fs.Parse([]string{"-m", "fast"})
+	assert.NoError(t, err)
+	assert.Equal(t, SourceEnv, fs.Source("q"))
+
+	assert.ErrorIs(t, fs.Set("m", "slow"), ErrInvalidValue)
+	assert.NoError(t, fs.Set("m", "fast"))
+	assert.Equal(t, "fast", *mode)
+	value, err := fs.GetString("m")
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", value)
+}
+
+func TestFromStructPointerFields(t *testing.T) {
+	type queryConfig struct {
+		Name    *string        `long:"name"`
+		Limit   *int           `long:"limit"`
+		Offset  *int64         `long:"offset" default:"10"`
+		Verbose *bool          `long:"verbose" short:"v"`
+		Timeout *time.Duration `long:"timeout"`
+		Max     *uint          `long:"max"`
+	}
+
+	config := &queryConfig{}
+	fs := NewFlagSet("query")
+	assert.NoError(t, fs.FromStruct(config))
+
+	// Defaults populate the pointee; other fields stay nil until set
+	err := fs.Parse([]string{"--limit", "0", "-v"})
+	assert.NoError(t, err)
+	assert.Nil(t, config.Name)
+	assert.Nil(t, config.Timeout)
+	assert.Nil(t, config.Max)
+	if assert.NotNil(t, config.Limit) {
+		assert.Equal(t, 0, *config.Limit)
+	}
+	if assert.NotNil(t, config.Offset) {
+		assert.Equal(t, int64(10), *config.Offset)
+	}
+	if assert.NotNil(t, config.Verbose) {
+		assert.True(t, *config.Verbose)
+	}
+
+	err = fs.Parse([]string{"--name", "alice", "--timeout", "5s", "--max", "3"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, config.Name) {
+		assert.Equal(t, "alice", *config.Name)
+	}
+	if assert.NotNil(t, config.Timeout) {
+		assert.Equal(t, 5*time.Second, *config.Timeout)
+	}
+	if assert.NotNil(t, config.Max) {
+		assert.Equal(t, uint(3), *config.Max)
+	}
+
+	err = fs.Parse([]string{"--limit", "many"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	// Reset returns unset pointers to nil and defaults to their value
+	fs.Reset()
+	assert.Nil(t, config.Name)
+	assert.Nil(t, config.Limit)
+	if assert.NotNil(t, config.Offset) {
+		assert.Equal(t, int64(10), *config.Offset)
+	}
+
+	// Invalid defaults are reported
+	type badConfig struct {
+		Port *int `long:"port" default:"http"`
+	}
+	fs = NewFlagSet("bad")
+	assert.Error(t, fs.FromStruct(&badConfig{}))
+}
+
+func TestStrictRegistration(t *testing.T) {
+	// Lenient by default: the later definition wins
+	fs := NewFlagSet("test")
+	fs.String("target", 't', "", "Target")
+	fs.Duration("timeout", 't', 0, "Timeout")
+	assert.Equal(t, "timeout", fs.shortMap['t'].Name)
+
+	fs = NewFlagSet("test")
+	fs.SetStrictRegistration(true)
+	fs.String("target", 't', "", "Target")
+
+	assert.PanicsWithError(t, "flag already defined: -t for --timeout is already used by --target", func() {
+		fs.Duration("timeout", 't', 0, "Timeout")
+	})
+	assert.PanicsWithError(t, "flag already defined: --target", func() {
+		fs.Bool("target", 0, false, "Target again")
+	})
+	assert.NotPanics(t, func() {
+		fs.Bool("verbose", 'v', false, "Verbose output")
+	})
+
+	type bigConfig struct {
+		Target  string        `long:"target" short:"t"`
+		Timeout time.Duration `long:"timeout" short:"t"`
+	}
+
+	fs = NewFlagSet("test")
+	fs.SetStrictRegistration(true)
+	err := fs.FromStruct(&bigConfig{})
+	assert.ErrorIs(t, err, ErrDuplicateFlag)
+	assert.ErrorContains(t, err, "field Timeout")
+	assert.ErrorContains(t, err, "--target")
+
+	fs = NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(&bigConfig{}))
+}
+
+func TestFromStructDuplicatePosition(t *testing.T) {
+	type copyConfig struct {
+		Source string `position:"0"`
+		Dest   string `position:"1"`
+		Mode   string `position:"1"`
+	}
+
+	fs := NewFlagSet("copy")
+	err := fs.FromStruct(&copyConfig{})
+	assert.EqualError(t, err, "position 1 is used by both Dest and Mode")
+
+	// Gaps are still allowed
+	type gapConfig struct {
+		First string `position:"0"`
+		Third string `position:"2"`
+	}
+	fs = NewFlagSet("gap")
+	assert.NoError(t, fs.FromStruct(&gapConfig{}))
+}
+
+func TestStrictRegistrationPositional(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.StringPos("source", 0, "", "Source")
+	assert.NotPanics(t, func() {
+		fs.IntPos("count", 0, 0, "Count")
+	})
+
+	fs = NewFlagSet("test")
+	fs.SetStrictRegistration(true)
+	fs.StringPos("source", 0, "", "Source")
+	assert.PanicsWithError(t, "position 0 is used by both source and count", func() {
+		fs.IntPos("count", 0, 0, "Count")
+	})
+}
+
+func TestRestWithMin(t *testing.T) {
+	var files []string
+	fs := NewFlagSet("cat")
+	verbose := fs.Bool("verbose", 'v', false, "Verbose output")
+	fs.RestWithMin(&files, 1, "Files to print")
+
+	err := fs.Parse([]string{"-v"})
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+	assert.NotErrorIs(t, err, ErrMissingValue)
+	assert.ErrorContains(t, err, "need at least 1, got 0")
+
+	err = fs.Parse([]string{"-v", "a.txt", "b.txt"})
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, files)
+}
+
+func TestFromStructRestMin(t *testing.T) {
+	type copyConfig struct {
+		Force   bool     `long:"force"`
+		Sources []string `rest:"true" min:"2"`
+	}
+
+	config := &copyConfig{}
+	fs := NewFlagSet("copy")
+	assert.NoError(t, fs.FromStruct(config))
+
+	err := fs.Parse([]string{"--force", "a"})
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+
+	err = fs.Parse([]string{"a", "--force", "dest"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "dest"}, config.Sources)
+
+	type badConfig struct {
+		Rest []string `rest:"true" min:"some"`
+	}
+	fs = NewFlagSet("bad")
+	assert.ErrorContains(t, fs.FromStruct(&badConfig{}), "invalid min for field Rest")
+}
+
+func TestFromStructTypedRest(t *testing.T) {
+	type sumConfig struct {
+		Verbose bool  `long:"verbose" short:"v"`
+		Numbers []int `rest:"true" min:"1"`
+	}
+
+	config := &sumConfig{}
+	fs := NewFlagSet("sum")
+	assert.NoError(t, fs.FromStruct(config))
+	assert.True(t, fs.HasRestArgs())
+
+	err := fs.Parse([]string{"1", "-v", "2", "3"})
+	assert.NoError(t, err)
+	assert.True(t, config.Verbose)
+	assert.Equal(t, []int{1, 2, 3}, config.Numbers)
+
+	err = fs.Parse([]string{"1", "two"})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.ErrorContains(t, err, `argument 1 "two"`)
+
+	err = fs.Parse(nil)
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+
+	fs.Reset()
+	assert.Empty(t, config.Numbers)
+
+	schema := fs.JSONSchema()
+	if assert.NotNil(t, schema.Properties["arguments"].Items) {
+		assert.Equal(t, "integer", schema.Properties["arguments"].Items.Type)
+	}
+
+	type avgConfig struct {
+		Values []float64 `rest:"true"`
+	}
+	avg := &avgConfig{}
+	fs = NewFlagSet("avg")
+	assert.NoError(t, fs.FromStruct(avg))
+	err = fs.Parse([]string{"1.5", "2", "--", "-3.25"})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{1.5, 2, -3.25}, avg.Values)
+}
+
+func TestFromStructPositionRange(t *testing.T) {
+	type convertConfig struct {
+		Command string   `position:"0"`
+		Inputs  []string `position:"1.." usage:"Input files"`
+		Output  string   `position:"2"`
+		Force   bool     `long:"force"`
+	}
+
+	config := &convertConfig{}
+	fs := NewFlagSet("convert")
+	fs.SetStrictPositions(true)
+	assert.NoError(t, fs.FromStruct(config))
+
+	err := fs.Parse([]string{"merge", "a.txt", "--force", "b.txt", "c.txt", "out.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "merge", config.Command)
+	assert.Equal(t, []string{"a.txt", "b.txt", "c.txt"}, config.Inputs)
+	assert.Equal(t, "out.txt", config.Output)
+	assert.True(t, config.Force)
+	assert.Equal(t, map[int]string{0: "merge", 2: "out.txt"}, fs.ParseResult().Positional)
+
+	// Trailing positions are filled before the range, which may be empty
+	config = &convertConfig{}
+	fs = NewFlagSet("convert")
+	assert.NoError(t, fs.FromStruct(config))
+	err = fs.Parse([]string{"merge", "out.txt"})
+	assert.NoError(t, err)
+	assert.Equal(t, "merge", config.Command)
+	assert.Empty(t, config.Inputs)
+	assert.Equal(t, "out.txt", config.Output)
+
+	config = &convertConfig{}
+	fs = NewFlagSet("convert")
+	assert.NoError(t, fs.FromStruct(config))
+	err = fs.Parse([]string{"merge"})
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+	assert.Equal(t, "merge", config.Command)
+	assert.Empty(t, config.Inputs)
+	assert.Empty(t, config.Output)
+
+	// Ranges round-trip through tool arguments
+	args, err := fs.ArgsFromMap(map[string]any{
+		"command": "merge",
+		"inputs":  []any{"a.txt", "b.txt"},
+		"output":  "out.txt",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--", "merge", "a.txt", "b.txt", "out.txt"}, args)
+
+	schema := fs.JSONSchema()
+	assert.Equal(t, "array", schema.Properties["inputs"].Type)
+	assert.NotContains(t, schema.Required, "inputs")
+	assert.Contains(t, schema.Required, "output")
+}
+
+func TestFromStructPositionRangeErrors(t *testing.T) {
+	type notSlice struct {
+		Inputs string `position:"0.."`
+	}
+	fs := NewFlagSet("test")
+	assert.EqualError(t, fs.FromStruct(&notSlice{}), "position range for field Inputs requires a []string field")
+
+	type twoRanges struct {
+		First  []string `position:"0.."`
+		Middle string   `position:"1"`
+		Second []string `position:"2.."`
+	}
+	fs = NewFlagSet("test")
+	assert.EqualError(t, fs.FromStruct(&twoRanges{}), "position ranges are used by both First and Second")
+
+	type overlap struct {
+		Command string   `position:"1"`
+		Inputs  []string `position:"1.."`
+	}
+	fs = NewFlagSet("test")
+	assert.EqualError(t, fs.FromStruct(&overlap{}), "position 1 is used by both Command and Inputs")
+}
+
+func TestFromStructPassthrough(t *testing.T) {
+	type execConfig struct {
+		Container string   `long:"container" short:"c"`
+		Pod       string   `position:"0"`
+		Command   []string `passthrough:"true"`
+	}
+
+	config := &execConfig{}
+	fs := NewFlagSet("exec")
+	assert.NoError(t, fs.FromStruct(config))
+
+	err := fs.Parse([]string{"web-1", "-c", "app", "--", "sh", "-c", "echo --hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "web-1", config.Pod)
+	assert.Equal(t, "app", config.Container)
+	assert.Equal(t, []string{"sh", "-c", "echo --hi"}, config.Command)
+	assert.Equal(t, []string{"web-1", "sh", "-c", "echo --hi"}, fs.Args())
+
+	// Without --, the passthrough field is empty
+	err = fs.Parse([]string{"web-1", "extra"})
+	assert.NoError(t, err)
+	assert.Empty(t, config.Command)
+
+	err = fs.Parse([]string{"web-1", "--"})
+	assert.NoError(t, err)
+	assert.Empty(t, config.Command)
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/app.conf"
+	err := os.WriteFile(path, []byte("host=config.example.com\nport=9000\nuser=admin\n"), 0o644)
+	assert.NoError(t, err)
+	t.Setenv("MFLAGS_TEST_PORT", "9100")
+	t.Setenv("MFLAGS_TEST_USER", "env-user")
+
+	fs := NewFlagSet("test")
+	fs.String("host", 0, "localhost", "host")
+	fs.Int("port", 0, 8080, "port")
+	fs.String("user", 0, "", "user")
+	fs.Bool("debug", 0, false, "debug")
+	fs.SetEnv("port", "MFLAGS_TEST_PORT")
+	fs.SetEnv("user", "MFLAGS_TEST_USER")
+
+	assert.Equal(t, SourceDefault, fs.Source("host"))
+
+	err = fs.ParseWithConfig(path, []string{"--user", "cli-user"})
+	assert.NoError(t, err)
+	assert.Equal(t, SourceConfig, fs.Source("host"))
+	assert.Equal(t, SourceEnv, fs.Source("port"))
+	assert.Equal(t, SourceFlag, fs.Source("user"))
+	assert.Equal(t, SourceDefault, fs.Source("debug"))
+	assert.Equal(t, SourceDefault, fs.Source("missing"))
+	assert.Equal(t, "9100", fs.Lookup("port").Value.String())
+
+	assert.Equal(t, "flag", SourceFlag.String())
+	assert.Equal(t, "env", SourceEnv.String())
+	assert.Equal(t, "config", SourceConfig.String())
+	assert.Equal(t, "default", SourceDefault.String())
+
+	// The state is reset by the next Parse
+	err = fs.Parse(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, SourceEnv, fs.Source("user"))
+	assert.Equal(t, SourceDefault, fs.Source("host"))
+}
+
+func TestStringMap(t *testing.T) {
+	fs := NewFlagSet("test")
+	labels := fs.StringMap("label", 'l', "labels")
+	assert.Equal(t, map[string]string{}, *labels)
+
+	err := fs.Parse([]string{"--label", "app=web", "-l", "tier=front=end", "--label=app=api", "--label", "empty="})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "api", "tier": "front=end", "empty": ""}, *labels)
+	assert.Equal(t, "app=api,empty=,tier=front=end", fs.Lookup("label").Value.String())
+
+	// A new Parse starts over instead of adding to the previous result
+	err = fs.Parse([]string{"--label", "env=prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, *labels)
+
+	for _, bad := range []string{"novalue", "=value"} {
+		err = fs.Parse([]string{"--label", bad})
+		assert.ErrorIs(t, err, ErrInvalidValue, bad)
+	}
+
+	fs.Reset()
+	assert.Equal(t, map[string]string{}, *labels)
+}
+
+func TestFromStructStringMap(t *testing.T) {
+	type Config struct {
+		Headers map[string]string `long:"header" short:"H" usage:"HTTP headers"`
+	}
+
+	config := &Config{}
+	err := ParseStruct(config, []string{"-H", "Accept=text/plain", "-H", "X-Trace=1"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Accept": "text/plain", "X-Trace": "1"}, config.Headers)
+
+	fs := NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(&Config{}))
+	args, err := fs.ArgsFromMap(map[string]any{"header": map[string]any{"b": "2", "a": 1}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--header", "a=1", "--header", "b=2"}, args)
+
+	_, err = fs.ArgsFromMap(map[string]any{"header": []any{"a=1"}})
+	assert.ErrorIs(t, err, ErrInvalidValue)
+
+	schema := fs.JSONSchema()
+	assert.Equal(t, Property{
+		Type:                 "object",
+		Description:          "HTTP headers",
+		AdditionalProperties: &Property{Type: "string"},
+	}, schema.Properties["header"])
+
+	// A map already in the struct is the default, replaced by the first occurrence
+	config = &Config{Headers: map[string]string{"Accept": "*/*", "X-Note": "a,b"}}
+	fs = NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(config))
+	assert.NoError(t, fs.Parse(nil))
+	assert.Equal(t, map[string]string{"Accept": "*/*", "X-Note": "a,b"}, config.Headers)
+	assert.NoError(t, fs.Parse([]string{"-H", "Accept=text/plain"}))
+	assert.Equal(t, map[string]string{"Accept": "text/plain"}, config.Headers)
+
+	fs.Reset()
+	assert.Equal(t, map[string]string{"Accept": "*/*", "X-Note": "a,b"}, config.Headers)
+
+	assert.Equal(t, map[string]string{"Accept": "*/*", "X-Note": "a,b"}, fs.JSONSchema().Properties["header"].Default)
+}
+
+func TestStringOptional(t *testing.T) {
+	fs := NewFlagSet("test")
+	color := fs.StringOptional("color", 'c', "always", "auto", "when to use color")
+	verbose := fs.Bool("verbose", 'v', false, "verbose output")
+
+	tests := []struct {
+		args     []string
+		expected string
+		rest     []string
+	}{
+		{nil, "auto", nil},
+		{[]string{"--color"}, "always", nil},
+		{[]string{"--color=never"}, "never", nil},
+		{[]string{"--color", "never"}, "always", []string{"never"}},
+		{[]string{"-c"}, "always", nil},
+		{[]string{"-c=never"}, "never", nil},
+		{[]string{"-cnever"}, "never", nil},
+		{[]string{"-c", "file.txt"}, "always", []string{"file.txt"}},
+		{[]string{"--color="}, "", nil},
+	}
+	for _, tt := range tests {
+		err := fs.Parse(tt.args)
+		assert.NoError(t, err, tt.args)
+		assert.Equal(t, tt.expected, *color, tt.args)
+		assert.Equal(t, tt.rest, fs.Args(), tt.args)
+	}
+
+	// A bare optional flag can be bundled before other short flags
+	err := fs.Parse([]string{"-vc"})
+	assert.NoError(t, err)
+	assert.True(t, *verbose)
+	assert.Equal(t, "always", *color)
+
+	// Map values are attached so they aren't read as positionals
+	args, err := fs.ArgsFromMap(map[string]any{"color": "never"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--color=never"}, args)
+
+	var buf bytes.Buffer
+	fs.SetOutput(&buf)
+	fs.ShowHelp()
+	assert.Contains(t, buf.String(), "-c, --color[=<string>]")
+}
+
+func TestSet(t *testing.T) {
+	fs := NewFlagSet("test")
+	port := fs.Int("port", 'p', 8080, "port")
+	mode := fs.String("mode", 0, "fast", "mode")
+	fs.SetChoices("mode", []string{"fast", "safe"})
+
+	// A value set before Parse acts as a default
+	assert.NoError(t, fs.Set("port", "9000"))
+	assert.Equal(t, 9000, *port)
+	assert.NoError(t, fs.Parse(nil))
+	assert.Equal(t, 9000, *port)
+	assert.False(t, fs.Changed("port"))
+
+	assert.NoError(t, fs.Parse([]string{"-p", "7000"}))
+	assert.NoError(t, fs.Set("mode", "safe"))
+	assert.Equal(t, "safe", *mode)
+	assert.True(t, fs.Changed("mode"))
+	assert.Equal(t, SourceFlag, fs.Source("mode"))
+	assert.Equal(t, 7000, *port)
+
+	err := fs.Set("missing", "x")
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+	assert.EqualError(t, err, "unknown flag: --missing")
+
+	err = fs.Set("port", "abc")
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	err = fs.Set("mode", "reckless")
+	assert.ErrorIs(t, err, ErrInvalidValue)
+	assert.Equal(t, "safe", *mode)
+}
+
+func TestTypedGetters(t *testing.T) {
+	type Config struct {
+		Retries *int `long:"retries"`
+	}
+	config := &Config{}
+	fs := NewFlagSet("test")
+	assert.NoError(t, fs.FromStruct(config))
+	fs.String("name", 'n', "default", "name")
+	fs.Int("port", 'p', 8080, "port")
+	fs.Count("verbose", 'v', "verbosity")
+	fs.Bool("debug", 0, false, "debug")
+	fs.Duration("timeout", 0, time.Second, "timeout")
+	tags := fs.StringSlice("tags", 0, nil, "tags")
+
+	err := fs.Parse([]string{"-n", "api", "-vv", "--debug", "--timeout", "5s", "--tags", "a,b", "--retries", "3"})
+	assert.NoError(t, err)
+
+	name, err := fs.GetString("name")
+	assert.NoError(t, err)
+	assert.Equal(t, "api", name)
+
+	port, err := fs.GetInt("port")
+	assert.NoError(t, err)
+	assert.Equal(t, 8080, port)
+
+	verbose, err := fs.GetInt("verbose")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, verbose)
+
+	retries, err := fs.GetInt("retries")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, retries)
+
+	debug, err := fs.GetBool("debug")
+	assert.NoError(t, err)
+	assert.True(t, debug)
+
+	timeout, err := fs.GetDuration("timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, timeout)
+
+	got, err := fs.GetStringArray("tags")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, got)
+	got[0] = "changed"
+	assert.Equal(t, []string{"a", "b"}, *tags)
+
+	_, err = fs.GetString("missing")
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	_, err = fs.GetBool("port")
+	assert.EqualError(t, err, "flag --port has type int, not bool")
+	_, err = fs.GetInt("name")
+	assert.Error(t, err)
+	_, err = fs.GetDuration("debug")
+	assert.Error(t, err)
+	_, err = fs.GetStringArray("timeout")
+	assert.Error(t, err)
+}
+
+func TestFlagNormalizer(t *testing.T) {
+	fs := NewFlagSet("test")
+	level := fs.String("log_level", 0, "info", "log level")
+	fs.SetFlagNormalizer(UnderscoreToHyphen)
+	dryRun := fs.Bool("dry_run", 0, false, "dry run")
+	maxDepth := fs.Int("max-depth", 0, 1, "max depth")
+
+	// Flags defined before and after the normalizer are stored normalized
+	assert.Equal(t, "log-level", fs.Lookup("log_level").Name)
+	assert.Equal(t, "dry-run", fs.Lookup("dry-run").Name)
+
+	err := fs.Parse([]string{"--log_level", "debug", "--dry-run", "--max_depth=3"})
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", *level)
+	assert.True(t, *dryRun)
+	assert.Equal(t, 3, *maxDepth)
+	assert.True(t, fs.Changed("max_depth"))
+
+	// Names that only differ by normalization are duplicates
+	fs.SetStrictRegistration(true)
+	assert.Panics(t, func() {
+		fs.Bool("dry-run", 0, false, "again")
+	})
+
+	// Config file keys go through the normalizer too
+	path := t.TempDir() + "/app.conf"
+	assert.NoError(t, os.WriteFile(path, []byte("log_level=warn\n"), 0o644))
+	err = fs.ParseWithConfig(path, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", *level)
+
+	// Normalization combines with case insensitivity and abbreviations
+	fs.SetCaseInsensitive(true)
+	fs.SetAllowAbbrev(true)
+	err = fs.Parse([]string{"--Log_Lev", "error"})
+	assert.NoError(t, err)
+	assert.Equal(t, "error", *level)
+}
+
+func TestFlagNormalizerByName(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.SetFlagNormalizer(UnderscoreToHyphen)
+	fs.SetCaseInsensitive(true)
+	level := fs.String("log-level", 0, "info", "log level")
+	fs.Int("max-depth", 0, 0, "max depth")
+	fs.URL("base-url", 0, nil, "base URL")
+	fs.Bool("new-ui", 0, false, "new UI")
+
+	// Helpers that take a flag name accept any spelling the parser accepts
+	fs.SetEnv("log_level", "TEST_NORMALIZER_LEVEL")
+	fs.Required("MAX_DEPTH")
+	fs.SetChoices("log_level", []string{"info", "debug"})
+	fs.SetValidator("Log_Level", func(string) error { return nil })
+	fs.ShowDefault("max_depth")
+	fs.SetFlagGroup("base_url", "Network")
+	fs.RequireAbsoluteURL("base_url")
+	fs.MarkExperimental("new_ui", false)
+	fs.SetCompletionDirective("base_url", DirectiveNoFileComp)
+	fs.SetCompletionFunc("log_level", func(string) []string { return nil })
+
+	flag := fs.Lookup("log-level")
+	assert.Equal(t, "TEST_NORMALIZER_LEVEL", flag.envKey)
+	assert.Equal(t, []string{"info", "debug"}, flag.choices)
+	assert.NotNil(t, flag.validator)
+	assert.NotNil(t, flag.completionFunc)
+	assert.True(t, fs.Lookup("max-depth").required)
+	assert.True(t, fs.Lookup("max-depth").showDefault)
+	assert.Equal(t, "Network", fs.Lookup("base-url").group)
+	assert.Equal(t, DirectiveNoFileComp, fs.Lookup("base-url").directive)
+	assert.True(t, fs.Lookup("base-url").Value.(*urlValue).absolute)
+	assert.True(t, fs.Lookup("new-ui").disabled)
+
+	t.Setenv("TEST_NORMALIZER_LEVEL", "debug")
+	err := fs.Parse([]string{"--max_depth", "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, "debug", *level)
+
+	// Completion looks up value flags the same way
+	completions := fs.GetFlagCompletions("--log_level=d")
+	if assert.Len(t, completions, 1) {
+		assert.Equal(t, "--log_level=debug", completions[0].Value)
+	}
+	assert.Equal(t, flag, fs.valueFlag("--LOG_LEVEL"))
+
+	// ArgsFromMap keys go through the normalizer too
+	args, err := fs.ArgsFromMap(map[string]any{"log_level": "debug"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--log-level", "debug"}, args)
+}
+
+func TestRestWithRange(t *testing.T) {
+	var paths []string
+	fs := NewFlagSet("move")
+	fs.RestWithRange(&paths, 1, 2, "Source and destination")
+
+	err := fs.Parse(nil)
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+
+	err = fs.Parse([]string{"src", "dst"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"src", "dst"}, paths)
+
+	err = fs.Parse([]string{"src", "dst", "extra"})
+	assert.ErrorIs(t, err, ErrTooManyArgs)
+	assert.NotErrorIs(t, err, ErrTooFewArgs)
+	assert.EqualError(t, err, "too many arguments: need at most 2, got 3")
+
+	// A max of 0 means no limit
+	fs = NewFlagSet("cat")
+	fs.RestWithRange(&paths, 0, 0, "Files")
+	assert.NoError(t, fs.Parse([]string{"a", "b", "c"}))
+
+	// Impossible ranges are programming errors
+	assert.PanicsWithValue(t, "RestWithRange: max 1 is less than min 2", func() {
+		fs.RestWithRange(&paths, 2, 1, "Files")
+	})
+	assert.PanicsWithValue(t, "RestWithRange: max cannot be negative, got -1", func() {
+		fs.RestWithRange(&paths, 0, -1, "Files")
+	})
+	assert.PanicsWithValue(t, "RestWithMin: min cannot be negative, got -1", func() {
+		fs.RestWithMin(&paths, -1, "Files")
+	})
+
+	// Redefining the rest field clears the earlier limits
+	fs = NewFlagSet("move")
+	fs.RestWithRange(&paths, 1, 2, "Source and destination")
+	fs.RestWithMin(&paths, 1, "Files")
+	assert.NoError(t, fs.Parse([]string{"a", "b", "c"}))
+	fs.Rest(&paths, "Files")
+	assert.NoError(t, fs.Parse(nil))
+}
+
+func TestFromStructRestMax(t *testing.T) {
+	type moveConfig struct {
+		Force bool     `long:"force"`
+		Paths []string `rest:"true" min:"2" max:"2"`
+	}
+
+	config := &moveConfig{}
+	fs := NewFlagSet("move")
+	assert.NoError(t, fs.FromStruct(config))
+
+	assert.ErrorIs(t, fs.Parse([]string{"a"}), ErrTooFewArgs)
+	assert.ErrorIs(t, fs.Parse([]string{"a", "b", "c", "--force"}), ErrTooManyArgs)
+	assert.NoError(t, fs.Parse([]string{"a", "--force", "b"}))
+	assert.Equal(t, []string{"a", "b"}, config.Paths)
+
+	type badMaxConfig struct {
+		Rest []string `rest:"true" max:"0"`
+	}
+	fs = NewFlagSet("bad")
+	assert.ErrorContains(t, fs.FromStruct(&badMaxConfig{}), "invalid max for field Rest")
+
+	type maxBelowMinConfig struct {
+		Rest []string `rest:"true" min:"2" max:"1"`
+	}
+	fs = NewFlagSet("bad")
+	assert.ErrorContains(t, fs.FromStruct(&maxBelowMinConfig{}), "invalid max for field Rest")
+}
@@ -500,3 +500,140 @@ func TestDoubleHyphenEndsFlags(t *testing.T) {
 	assert.Equal(t, "-v", *command)
 	assert.Equal(t, "-f", *arg1)
 }
+
+func TestArgsReturnsCopy(t *testing.T) {
+	fs := NewFlagSet("test")
+
+	var files []string
+	fs.Rest(&files, "Files")
+
+	err := fs.Parse([]string{"a.txt", "b.txt"})
+	require.NoError(t, err)
+
+	args := fs.Args()
+	args[0] = "changed.txt"
+
+	assert.Equal(t, []string{"a.txt", "b.txt"}, files)
+	assert.Equal(t, []string{"a.txt", "b.txt"}, fs.Args())
+
+	// Changing the rest field doesn't affect Args either
+	files[1] = "other.txt"
+	assert.Equal(t, []string{"a.txt", "b.txt"}, fs.Args())
+}
+
+func TestRestExcludesPositional(t *testing.T) {
+	// By default the rest field includes positional arguments, as a separate copy
+	fs := NewFlagSet("test")
+	cmd := fs.StringPos("command", 0, "", "Command to run")
+	var args []string
+	fs.Rest(&args, "Command arguments")
+
+	err := fs.Parse([]string{"echo", "hello", "world"})
+	require.NoError(t, err)
+	assert.Equal(t, "echo", *cmd)
+	assert.Equal(t, []string{"echo", "hello", "world"}, args)
+
+	args[0] = "changed"
+	assert.Equal(t, []string{"echo", "hello", "world"}, fs.Args())
+
+	// With exclusion, arguments consumed by positional fields are left out
+	fs = NewFlagSet("test")
+	cmd = fs.StringPos("command", 0, "", "Command to run")
+	fs.Rest(&args, "Command arguments")
+	fs.SetRestExcludesPositional(true)
+
+	err = fs.Parse([]string{"echo", "--", "hello", "-n"})
+	require.NoError(t, err)
+	assert.Equal(t, "echo", *cmd)
+	assert.Equal(t, []string{"hello", "-n"}, args)
+	assert.Equal(t, []string{"echo", "hello", "-n"}, fs.Args())
+
+	err = fs.Parse([]string{"echo"})
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	// The minimum applies to the arguments left after the positional fields
+	fs = NewFlagSet("test")
+	fs.StringPos("command", 0, "", "Command to run")
+	fs.RestWithMin(&args, 1, "Command arguments")
+	fs.SetRestExcludesPositional(true)
+
+	err = fs.Parse([]string{"echo"})
+	assert.ErrorIs(t, err, ErrTooFewArgs)
+}
+
+func TestTerminatorIndex(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.Bool("verbose", 'v', false, "Verbose output")
+	assert.Equal(t, -1, fs.TerminatorIndex())
+
+	// No terminator
+	err := fs.Parse([]string{"-v", "run"})
+	require.NoError(t, err)
+	assert.Equal(t, -1, fs.TerminatorIndex())
+
+	// Terminator with nothing after it
+	err = fs.Parse([]string{"-v", "run", "--"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, fs.TerminatorIndex())
+	assert.Equal(t, []string{"run"}, fs.Args())
+
+	// Terminator followed by arguments; only the first -- counts
+	err = fs.Parse([]string{"--", "-v", "--"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, fs.TerminatorIndex())
+	assert.Equal(t, []string{"-v", "--"}, fs.Args())
+
+	fs.Reset()
+	assert.Equal(t, -1, fs.TerminatorIndex())
+}
+
+func TestStrictArgs(t *testing.T) {
+	fs := NewFlagSet("test")
+	fs.Bool("verbose", 'v', false, "Verbose output")
+	name := fs.StringPos("name", 0, "", "Name")
+
+	// Extra arguments are kept by default
+	err := fs.Parse([]string{"api", "extra"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api", "extra"}, fs.Args())
+
+	fs.SetStrictArgs(true)
+	err = fs.Parse([]string{"api", "-v"})
+	require.NoError(t, err)
+	assert.Equal(t, "api", *name)
+
+	err = fs.Parse([]string{"api", "extra", "-v", "more"})
+	assert.ErrorIs(t, err, ErrTooManyArgs)
+	assert.EqualError(t, err, "too many arguments: unexpected extra more")
+
+	// A FlagSet without positionals accepts no arguments
+	fs = NewFlagSet("test")
+	fs.SetStrictArgs(true)
+	require.NoError(t, fs.Parse(nil))
+	assert.ErrorIs(t, fs.Parse([]string{"x"}), ErrTooManyArgs)
+
+	// A rest field takes everything
+	var rest []string
+	fs.Rest(&rest, "Arguments")
+	require.NoError(t, fs.Parse([]string{"x", "y"}))
+	assert.Equal(t, []string{"x", "y"}, rest)
+}
+
+func TestFromStructStrictArgsPassthrough(t *testing.T) {
+	type Config struct {
+		Target string   `position:"0"`
+		Extra  []string `passthrough:"true"`
+	}
+	var config Config
+	fs := NewFlagSet("test")
+	require.NoError(t, fs.FromStruct(&config))
+	fs.SetStrictArgs(true)
+
+	err := fs.Parse([]string{"build", "--", "-x", "y"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"-x", "y"}, config.Extra)
+
+	err = fs.Parse([]string{"build", "other", "--", "-x"})
+	assert.ErrorIs(t, err, ErrTooManyArgs)
+}
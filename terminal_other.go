@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || dragonfly)
+
+package mflags
+
+// stdoutWidth reports that the terminal size is unknown on this platform, so
+// the COLUMNS environment variable or the default width is used
+func stdoutWidth() (int, bool) {
+	return 0, false
+}
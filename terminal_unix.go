@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd || netbsd || dragonfly
+
+package mflags
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// stdoutWidth returns the width of the terminal attached to standard output,
+// or false if standard output is not a terminal
+func stdoutWidth() (int, bool) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, os.Stdout.Fd(),
+		uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Col == 0 {
+		return 0, false
+	}
+	return int(ws.Col), true
+}